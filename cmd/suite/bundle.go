@@ -0,0 +1,461 @@
+// Package main: deployment bundle — build/<mode>/ outputs, starter files, README and manifest as a .zip or .tar.gz (/bundle, /api/bundle).
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/soulteary/the-gate/internal/composegen"
+)
+
+// bundleStarterFiles 为部署包中相对路径文件（按文件名）的初始内容来源，相对项目根目录。
+var bundleStarterFiles = map[string]string{
+	"data.json": "fixtures/warden/data.json",
+}
+
+// bundleModeOrder 为 README 中启动各 mode 的顺序：config/modes.yaml 中的定义顺序（三分开时 herald、warden 先于 stargate），其后为 swarm、k8s。
+func bundleModeOrder(defs []composegen.ModeDef) []string {
+	return append(composegen.ModeNames(defs), "swarm", "k8s")
+}
+
+// bundleStackName 为 swarm 模式 docker stack deploy 的 stack 名。
+const bundleStackName = "the-gate"
+
+// bundleEntry 为归档中的一个文件；Dir 为 true 时为目录（Name 以 / 结尾、无 Data），用于固定 secrets/ 等目录解压后的权限。
+type bundleEntry struct {
+	Name string
+	Data []byte
+	Perm int64
+	Dir  bool
+}
+
+// bundleManifest 为部署包中的 manifest.json：生成时间、modes、非默认选项、镜像汇总与各 mode 的部署要求。
+type bundleManifest struct {
+	GeneratedAt string                                    `json:"generatedAt"`
+	Modes       []string                                  `json:"modes"`
+	Options     map[string]interface{}                    `json:"options,omitempty"`
+	Images      []string                                  `json:"images"`
+	Outputs     map[string]*composegen.DeployRequirements `json:"outputs"`
+}
+
+// orderedBundleModes 按 order 排列 gen 中的 modes，未知 mode 按名称排在最后。
+func orderedBundleModes(gen *composegen.Generated, order []string) []string {
+	rank := func(m string) int {
+		for i, o := range order {
+			if o == m {
+				return i
+			}
+		}
+		return len(order)
+	}
+	modes := make([]string, 0, len(gen.Composes))
+	for m := range gen.Composes {
+		modes = append(modes, m)
+	}
+	sort.Slice(modes, func(i, j int) bool {
+		ri, rj := rank(modes[i]), rank(modes[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return modes[i] < modes[j]
+	})
+	return modes
+}
+
+// manifestOptions 将 options 转为 manifest 中的键值（与 /api/generate 的 options 同名），省略未设置项与 envOverrides（值可能含密钥，已写入 .env）；
+// 通道选项仅保留 providers 中声明的键（session 中的其他 Web UI 键不写入）。
+func manifestOptions(o *composeGenOptionsJSON, providers []composegen.Provider) map[string]interface{} {
+	if o == nil {
+		return nil
+	}
+	clone := *o
+	clone.EnvOverrides = nil
+	clone.Providers = make(map[string]string)
+	for _, k := range composegen.ProviderOptionKeys(providers) {
+		if v, ok := o.Providers[k]; ok {
+			clone.Providers[k] = v
+		}
+	}
+	b, err := json.Marshal(clone)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	for k, v := range m {
+		if v == nil || v == "" {
+			delete(m, k)
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
+
+// buildBundle 汇总部署包内容：各 mode 的清单、.env 与附加文件，所需的初始文件（如 warden 的 data.json），README.md 与 manifest.json。
+func buildBundle(root string, gen *composegen.Generated, options *composeGenOptionsJSON, now time.Time) ([]bundleEntry, error) {
+	snap, err := snapshotFor(root)
+	if err != nil {
+		return nil, err
+	}
+	modes := orderedBundleModes(gen, bundleModeOrder(snap.Source.Modes))
+	manifest := bundleManifest{
+		GeneratedAt: now.UTC().Format(time.RFC3339),
+		Modes:       modes,
+		Options:     manifestOptions(options, snap.Source.Providers),
+		Images:      []string{},
+		Outputs:     make(map[string]*composegen.DeployRequirements, len(modes)),
+	}
+	var entries []bundleEntry
+	images := make(map[string]bool)
+	for _, mode := range modes {
+		req, err := composegen.Requirements(gen, mode)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Outputs[mode] = req
+		for _, img := range req.Images {
+			images[img] = true
+		}
+		dir := path.Join("build", mode)
+		entries = append(entries,
+			bundleEntry{Name: path.Join(dir, composegen.OutputFileName(mode)), Data: gen.Composes[mode], Perm: 0o644},
+			bundleEntry{Name: path.Join(dir, ".env"), Data: gen.EnvFor(mode), Perm: 0o600},
+		)
+		subdirs := make(map[string]bool)
+		for _, rel := range sortedKeys(gen.Files[mode]) {
+			if sub := path.Dir(rel); sub != "." && !subdirs[sub] {
+				subdirs[sub] = true
+				entries = append(entries, bundleEntry{Name: path.Join(dir, sub) + "/", Perm: int64(composegen.SecretsDirPerm), Dir: true})
+			}
+			entries = append(entries, bundleEntry{Name: path.Join(dir, rel), Data: gen.Files[mode][rel], Perm: int64(composegen.GeneratedFilePerm(rel))})
+		}
+		for _, f := range req.Files {
+			src, ok := bundleStarterFiles[path.Base(f)]
+			if !ok {
+				continue
+			}
+			b, err := os.ReadFile(filepath.Join(root, src))
+			if err != nil {
+				return nil, fmt.Errorf("read starter %s: %w", src, err)
+			}
+			entries = append(entries, bundleEntry{Name: path.Join(dir, f), Data: b, Perm: 0o644})
+		}
+	}
+	for img := range images {
+		manifest.Images = append(manifest.Images, img)
+	}
+	sort.Strings(manifest.Images)
+	mb, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	readme := bundleReadme(manifest)
+	return append([]bundleEntry{
+		{Name: "README.md", Data: []byte(readme), Perm: 0o644},
+		{Name: "manifest.json", Data: append(mb, '\n'), Perm: 0o644},
+	}, entries...), nil
+}
+
+// bundleReadme 生成部署包 README：按 manifest 中各 mode 的要求给出 network create、初始文件与 up/down 命令。
+func bundleReadme(m bundleManifest) string {
+	var sb strings.Builder
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&sb, format+"\n", args...)
+	}
+	line("# The Gate deployment bundle")
+	line("")
+	line("Generated %s for modes: %s.", m.GeneratedAt, strings.Join(m.Modes, ", "))
+	line("")
+	line("Run the commands below from the directory that contains this README. Each `build/<mode>/` holds the manifest and the `.env` it reads;")
+	line("docker compose loads `.env` from the compose file's directory, so keep them together.")
+	line("`.env` (and `secrets/`, if present) contain API keys and passwords: do not commit or share them.")
+	line("Files under `secrets/` are world-readable so that containers running as a non-root user can read the bind mount; the directory itself is")
+	line("owner-only (0700), so extract with a tool that keeps directory permissions (`tar -xpzf`, `unzip`) or `chmod 700 build/*/secrets` afterwards.")
+	line("")
+
+	var composeNetworks []string
+	seen := make(map[string]bool)
+	var starters []string
+	for _, mode := range m.Modes {
+		req := m.Outputs[mode]
+		if mode != "swarm" {
+			for _, n := range req.Networks {
+				if !seen[n] {
+					seen[n] = true
+					composeNetworks = append(composeNetworks, n)
+				}
+			}
+		}
+		for _, f := range req.Files {
+			if src, ok := bundleStarterFiles[path.Base(f)]; ok {
+				starters = append(starters, fmt.Sprintf("- `build/%s/%s`: copied from `%s`", mode, f, src))
+			} else {
+				starters = append(starters, fmt.Sprintf("- `build/%s/%s`: not included, provide it before starting", mode, f))
+			}
+		}
+	}
+	if len(starters) > 0 {
+		line("## Files to review")
+		line("")
+		line("The outputs mount these files; the bundled copies are test data (e.g. the Warden user list), edit them before going live.")
+		line("")
+		for _, s := range starters {
+			line("%s", s)
+		}
+		line("")
+	}
+	if len(composeNetworks) > 0 {
+		line("## Networks")
+		line("")
+		line("Create the external networks once (skip any that already exist):")
+		line("")
+		line("```sh")
+		for _, n := range composeNetworks {
+			line("docker network create %s", n)
+		}
+		line("```")
+		line("")
+	}
+
+	line("## Start")
+	line("")
+	for _, mode := range m.Modes {
+		req := m.Outputs[mode]
+		file := "build/" + mode + "/" + composegen.OutputFileName(mode)
+		line("### %s", mode)
+		line("")
+		switch mode {
+		case "k8s":
+			line("```sh")
+			line("kubectl apply -f %s", file)
+			for _, cm := range sortedStringKeys(req.ConfigMaps) {
+				line("kubectl -n %s create configmap %s --from-file=%s=build/k8s/%s", req.Namespace, cm, req.ConfigMaps[cm], req.ConfigMaps[cm])
+			}
+			line("```")
+			line("")
+			line("Middleware / IngressRoute resources need the Traefik CRDs (traefik.io/v1alpha1) installed in the cluster.")
+		case "swarm":
+			line("docker stack deploy does not read `.env`; export it first. The node must be a swarm manager (`docker swarm init`).")
+			line("")
+			line("```sh")
+			for _, n := range req.Networks {
+				line("docker network create --driver overlay --attachable %s", n)
+			}
+			line("set -a; . build/swarm/.env; set +a")
+			line("docker stack deploy -c %s %s", file, bundleStackName)
+			line("```")
+		default:
+			if len(req.Builds) > 0 {
+				line("Build contexts are relative to `build/%s/` (%s): extract this bundle in the stargate-suite checkout next to the service sources.", mode, strings.Join(sortedStringValues(req.Builds), ", "))
+				line("")
+			}
+			line("```sh")
+			if len(req.Builds) > 0 {
+				line("docker compose -f %s up -d --build", file)
+			} else {
+				line("docker compose -f %s up -d", file)
+			}
+			line("```")
+		}
+		line("")
+	}
+
+	line("## Stop")
+	line("")
+	line("```sh")
+	for i := len(m.Modes) - 1; i >= 0; i-- {
+		mode := m.Modes[i]
+		file := "build/" + mode + "/" + composegen.OutputFileName(mode)
+		switch mode {
+		case "k8s":
+			line("kubectl delete -f %s", file)
+		case "swarm":
+			line("docker stack rm %s", bundleStackName)
+		default:
+			line("docker compose -f %s down", file)
+		}
+	}
+	line("```")
+	line("")
+
+	if len(m.Images) > 0 {
+		line("## Images")
+		line("")
+		line("Pull ahead of time with `docker pull`; per-mode details are in `manifest.json`.")
+		line("")
+		for _, img := range m.Images {
+			line("- `%s`", img)
+		}
+		line("")
+	}
+	return sb.String()
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedStringValues(m map[string]string) []string {
+	seen := make(map[string]bool, len(m))
+	var vals []string
+	for _, v := range m {
+		if !seen[v] {
+			seen[v] = true
+			vals = append(vals, v)
+		}
+	}
+	sort.Strings(vals)
+	return vals
+}
+
+// writeBundleZip 将 entries 写为 zip。
+func writeBundleZip(w io.Writer, entries []bundleEntry, now time.Time) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		h := &zip.FileHeader{Name: e.Name, Method: zip.Deflate, Modified: now}
+		if e.Dir {
+			h.Method = zip.Store
+			h.SetMode(os.ModeDir | os.FileMode(e.Perm))
+		} else {
+			h.SetMode(os.FileMode(e.Perm))
+		}
+		f, err := zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(e.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeBundleTarGz 将 entries 写为 tar.gz。
+func writeBundleTarGz(w io.Writer, entries []bundleEntry, now time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		h := &tar.Header{Name: e.Name, Mode: e.Perm, Size: int64(len(e.Data)), ModTime: now, Typeflag: tar.TypeReg}
+		if e.Dir {
+			h.Typeflag = tar.TypeDir
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := tw.Write(e.Data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// bundleFormat 读取 ?format=（zip 或 tar.gz，默认 zip）。
+func bundleFormat(r *http.Request) (string, error) {
+	switch f := r.URL.Query().Get("format"); f {
+	case "", "zip":
+		return "zip", nil
+	case "tar.gz", "tgz":
+		return "tar.gz", nil
+	default:
+		return "", fmt.Errorf("unsupported format %q (zip, tar.gz)", f)
+	}
+}
+
+// writeBundleResponse 打包 gen 并作为附件返回；先在内存中完成归档，出错时仍可返回 500 而非截断的文件。
+func writeBundleResponse(w http.ResponseWriter, format string, gen *composegen.Generated, options *composeGenOptionsJSON) {
+	now := time.Now()
+	entries, err := buildBundle(projectRoot(), gen, options, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bundle: %v\n", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	var buf bytes.Buffer
+	contentType := "application/zip"
+	if format == "tar.gz" {
+		contentType = "application/gzip"
+		err = writeBundleTarGz(&buf, entries, now)
+	} else {
+		err = writeBundleZip(&buf, entries, now)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bundle: %v\n", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="the-gate-bundle.`+format+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(buf.Bytes())
+}
+
+// handleBundle 按当前会话生成并下载部署包（GET /bundle?format=zip|tar.gz）。
+func handleBundle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format, err := bundleFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sess, ok := GetSession(r.Context())
+	if !ok || sess == nil || len(sess.Modes) == 0 {
+		http.Redirect(w, r, "/wizard/step-1", http.StatusFound)
+		return
+	}
+	gen, err := generateForSession(projectRoot(), sess)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generate: %v\n", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	o := &composeGenOptionsJSON{}
+	FillComposeGenOptionsFromMap(o, sess.Options)
+	writeBundleResponse(w, format, gen, o)
+}
+
+// handleBundleAPI 按 /api/generate 的请求体生成并返回部署包（POST /api/bundle?format=zip|tar.gz）。
+func handleBundleAPI(w http.ResponseWriter, r *http.Request) {
+	format, err := bundleFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, ok := decodeGenerateRequest(w, r)
+	if !ok {
+		return
+	}
+	gen, err := generateFromRequest(projectRoot(), req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "generate: %v\n", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeBundleResponse(w, format, gen, req.Options)
+}
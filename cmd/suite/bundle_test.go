@@ -0,0 +1,142 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestBuildBundle 确保部署包按 mode 顺序包含各清单、.env（0600）、secrets/（目录 0700、文件 0644）、warden 的 data.json 初始文件、README 与 manifest，
+// README 给出各 mode 的启动与逆序停止命令，manifest 不含 envOverrides；zip 与 tar.gz 内容一致。
+func TestBuildBundle(t *testing.T) {
+	root := filepath.Join("..", "..")
+	exposePorts, secretsFiles := true, true
+	req := &generateRequest{
+		Modes: []string{"k8s", "image", "swarm"},
+		Options: &composeGenOptionsJSON{
+			ExposePorts:  &exposePorts,
+			SecretsFiles: &secretsFiles,
+			EnvOverrides: map[string]string{"HERALD_API_KEY": "bundle-test-key", "WARDEN_REDIS_PASSWORD": "bundle-redis-pw"},
+			Providers:    map[string]string{"smtpEnabled": "true", "unknownUiKey": "x"},
+		},
+	}
+	gen, err := generateFromRequest(root, req)
+	if err != nil {
+		t.Fatalf("generateFromRequest: %v", err)
+	}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries, err := buildBundle(root, gen, req.Options, now)
+	if err != nil {
+		t.Fatalf("buildBundle: %v", err)
+	}
+
+	files := make(map[string]bundleEntry, len(entries))
+	var names []string
+	for _, e := range entries {
+		files[e.Name] = e
+		names = append(names, e.Name)
+	}
+	for _, want := range []string{
+		"README.md", "manifest.json",
+		"build/image/docker-compose.yml", "build/image/.env", "build/image/data.json",
+		"build/swarm/docker-compose.yml", "build/swarm/.env",
+		"build/k8s/k8s.yaml", "build/k8s/.env",
+	} {
+		if _, ok := files[want]; !ok {
+			t.Errorf("bundle missing %s; have %v", want, names)
+		}
+	}
+	if names[0] != "README.md" || names[1] != "manifest.json" || names[2] != "build/image/docker-compose.yml" {
+		t.Errorf("entry order = %v, want README, manifest, then image first", names)
+	}
+	if e := files["build/image/.env"]; e.Perm != 0o600 || !bytes.Contains(e.Data, []byte("HERALD_API_KEY=bundle-test-key")) {
+		t.Errorf("image .env perm %o, content:\n%s", e.Perm, e.Data)
+	}
+	// compose 绑定挂载 secrets 文件时保留权限：文件对容器内非 root 用户可读，目录仅属主可进入
+	if d, f := files["build/image/secrets/"], files["build/image/secrets/warden_redis_password"]; !d.Dir || d.Perm != 0o700 || f.Perm != 0o644 || string(f.Data) != "bundle-redis-pw" {
+		t.Errorf("image secrets dir %+v, file perm %o", d, f.Perm)
+	}
+
+	var manifest bundleManifest
+	if err := json.Unmarshal(files["manifest.json"].Data, &manifest); err != nil {
+		t.Fatalf("manifest.json: %v", err)
+	}
+	if strings.Join(manifest.Modes, ",") != "image,swarm,k8s" || manifest.GeneratedAt != "2026-01-02T03:04:05Z" || len(manifest.Images) == 0 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if _, ok := manifest.Options["envOverrides"]; ok || manifest.Options["smtpEnabled"] != true || manifest.Options["unknownUiKey"] != nil {
+		t.Errorf("manifest options = %v, want smtpEnabled only among channel keys and no envOverrides", manifest.Options)
+	}
+
+	readme := string(files["README.md"].Data)
+	for _, want := range []string{
+		"docker compose -f build/image/docker-compose.yml up -d\n",
+		"set -a; . build/swarm/.env; set +a\ndocker stack deploy -c build/swarm/docker-compose.yml the-gate\n",
+		"kubectl apply -f build/k8s/k8s.yaml\n",
+		"- `build/image/data.json`: copied from `fixtures/warden/data.json`",
+		"kubectl delete -f build/k8s/k8s.yaml\ndocker stack rm the-gate\ndocker compose -f build/image/docker-compose.yml down\n",
+	} {
+		if !strings.Contains(readme, want) {
+			t.Errorf("README missing %q:\n%s", want, readme)
+		}
+	}
+	if strings.Contains(readme, "bundle-test-key") {
+		t.Error("README must not contain secret values")
+	}
+
+	var zipBuf, tgzBuf bytes.Buffer
+	if err := writeBundleZip(&zipBuf, entries, now); err != nil {
+		t.Fatalf("writeBundleZip: %v", err)
+	}
+	if err := writeBundleTarGz(&tgzBuf, entries, now); err != nil {
+		t.Fatalf("writeBundleTarGz: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()))
+	if err != nil {
+		t.Fatalf("zip: %v", err)
+	}
+	if len(zr.File) != len(entries) {
+		t.Errorf("zip has %d files, want %d", len(zr.File), len(entries))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if e := files[f.Name]; !bytes.Equal(data, e.Data) || int64(f.Mode().Perm()) != e.Perm {
+			t.Errorf("zip %s differs (mode %v)", f.Name, f.Mode())
+		}
+	}
+	gz, err := gzip.NewReader(&tgzBuf)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	n := 0
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		if e := files[h.Name]; !bytes.Equal(data, e.Data) || h.Mode != e.Perm {
+			t.Errorf("tar %s differs (mode %o)", h.Name, h.Mode)
+		}
+		n++
+	}
+	if n != len(entries) {
+		t.Errorf("tar has %d files, want %d", n, len(entries))
+	}
+}
@@ -1,14 +1,20 @@
-// Package main: /api/generate request types and scenario presets (Web UI only).
+// Package main: gen command, /api/generate request types and scenario presets.
 package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/soulteary/cli-kit/configutil"
 	"github.com/soulteary/the-gate/internal/composegen"
+	"gopkg.in/yaml.v3"
 )
 
 type scenarioPreset struct {
@@ -23,26 +29,12 @@ type scenarioPreset struct {
 	RiskNoteEn    string                 `json:"riskNoteEn"`
 	Modes         []string               `json:"modes"`
 	EnvOverrides  map[string]string      `json:"envOverrides"`
-	Options       map[string]interface{} `json:"options"` // 通用键值；通过 scenarioOptionSetters 映射到 composegen.Options
+	Options       map[string]interface{} `json:"options"` // 通用键值；通过 scenarioOptionSetters 映射到 composegen.Options，其余为 Herald 通道选项（Options.Providers）
 }
 
 // scenarioOptionSetters 将 scenarios.json 的 option 键映射到 Options 字段；新增选项时在此表与 config 各加一项即可，无需改结构体。
+// Herald 通道的开关（如 includeSmtp）不在此表，由 config/providers.yaml 声明，见 setProviderOption。
 var scenarioOptionSetters = map[string]func(*composegen.Options, interface{}){
-	"includeDingTalk": func(opts *composegen.Options, v interface{}) {
-		if b, ok := toBool(v); ok {
-			opts.IncludeDingTalk = b
-		}
-	},
-	"includeSmtp": func(opts *composegen.Options, v interface{}) {
-		if b, ok := toBool(v); ok {
-			opts.IncludeSmtp = b
-		}
-	},
-	"useOwlmailForSmtp": func(opts *composegen.Options, v interface{}) {
-		if b, ok := toBool(v); ok {
-			opts.UseOwlmailForSmtp = b
-		}
-	},
 	"includeTotp": func(opts *composegen.Options, v interface{}) {
 		if b, ok := toBool(v); ok {
 			opts.IncludeTotp = b
@@ -105,6 +97,11 @@ func applyScenePresetToOptions(opts *composegen.Options, scene *scenarioPreset)
 	for key, val := range scene.Options {
 		if setter, ok := scenarioOptionSetters[key]; ok {
 			setter(opts, val)
+		} else if v, ok := providerOptionValue(val); ok {
+			if opts.Providers == nil {
+				opts.Providers = make(map[string]string)
+			}
+			opts.Providers[providerOptionKey(key)] = v
 		}
 	}
 }
@@ -121,17 +118,22 @@ type composeGenOptionsJSON struct {
 	HealthCheckStartPeriod        string            `json:"healthCheckStartPeriod"`
 	TraefikNetwork                *bool             `json:"traefikNetwork"`
 	TraefikNetworkName            string            `json:"traefikNetworkName"`
+	BundledTraefik                *bool             `json:"bundledTraefik"`
+	TraefikEntrypointHTTP         string            `json:"traefikEntrypointHttp"`
+	TraefikEntrypointHTTPS        string            `json:"traefikEntrypointHttps"`
+	TraefikHTTPMiddlewares        string            `json:"traefikHttpMiddlewares"`
+	TraefikHTTPSMiddlewares       string            `json:"traefikHttpsMiddlewares"`
+	TraefikCertResolver           string            `json:"traefikCertResolver"`
+	TraefikRouterPriority         string            `json:"traefikRouterPriority"`
+	TraefikAuthMiddleware         string            `json:"traefikAuthMiddleware"`
+	TraefikDynamicFile            *bool             `json:"traefikDynamicFile"`
+	TraefikStripLabels            *bool             `json:"traefikStripLabels"`
 	ExposePorts                   *bool             `json:"exposePorts"`
 	PortHerald                    string            `json:"portHerald"`
 	PortWarden                    string            `json:"portWarden"`
 	PortHeraldRedis               string            `json:"portHeraldRedis"`
 	PortHeraldTotp                string            `json:"portHeraldTotp"`
-	PortHeraldSmtp                string            `json:"portHeraldSmtp"`
-	PortOwlmail                   string            `json:"portOwlmail"`
 	ContainerNamePrefix           string            `json:"containerNamePrefix"`
-	DingtalkEnabled               *bool             `json:"dingtalkEnabled"`
-	SmtpEnabled                   *bool             `json:"smtpEnabled"`
-	SmtpUseOwlmail                *bool             `json:"smtpUseOwlmail"`
 	TotpEnabled                   *bool             `json:"totpEnabled"`
 	EnvOverrides                  map[string]string `json:"envOverrides"`
 	UseNamedVolume                *bool             `json:"useNamedVolume"`
@@ -139,6 +141,107 @@ type composeGenOptionsJSON struct {
 	WardenRedisDataPath           string            `json:"wardenRedisDataPath"`
 	SessionStorageRedisUseBuiltin *bool             `json:"sessionStorageRedisUseBuiltin"`
 	DisableWardenRedisService     *bool             `json:"disableWardenRedisService"`
+	SwarmReplicas                 string            `json:"swarmReplicas"`
+	SecretsFiles                  *bool             `json:"secretsFiles"`
+	// Providers 为 Herald 通道选项（config/providers.yaml 中的 option / portOption，如 smtpEnabled、portOwlmail），
+	// JSON 中与其他选项同级，见 UnmarshalJSON / MarshalJSON
+	Providers map[string]string `json:"-"`
+}
+
+// UnmarshalJSON 解码已声明的字段，其余键作为 Herald 通道选项放入 Providers（旧键按 legacyOptionKeys 改写）。
+func (o *composeGenOptionsJSON) UnmarshalJSON(b []byte) error {
+	type plain composeGenOptionsJSON
+	if err := json.Unmarshal(b, (*plain)(o)); err != nil {
+		return err
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	fields := composeGenJSONFields()
+	for k, v := range raw {
+		if !fields[k] {
+			o.setProviderOption(k, v)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON 将 Providers 与其他选项同级输出；开关值输出为布尔。
+func (o composeGenOptionsJSON) MarshalJSON() ([]byte, error) {
+	type plain composeGenOptionsJSON
+	b, err := json.Marshal(plain(o))
+	if err != nil || len(o.Providers) == 0 {
+		return b, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range o.Providers {
+		if _, ok := m[k]; ok {
+			continue
+		}
+		if bv, err := strconv.ParseBool(v); err == nil {
+			m[k] = bv
+		} else {
+			m[k] = v
+		}
+	}
+	return json.Marshal(m)
+}
+
+// composeGenJSONFields 返回 composeGenOptionsJSON 已声明字段的 json 键。
+func composeGenJSONFields() map[string]bool {
+	t := reflect.TypeOf(composeGenOptionsJSON{})
+	out := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := jsonFieldName(t.Field(i)); name != "" {
+			out[name] = true
+		}
+	}
+	return out
+}
+
+// jsonFieldName 返回字段的 json 键；无标签或为 "-" 时返回空串。
+func jsonFieldName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// setProviderOption 将未在 optionToComposeGenJSONSetters 中的 option 作为 Herald 通道选项记入 Providers。
+func (o *composeGenOptionsJSON) setProviderOption(key string, v interface{}) {
+	val, ok := providerOptionValue(v)
+	if !ok {
+		return
+	}
+	if o.Providers == nil {
+		o.Providers = make(map[string]string)
+	}
+	o.Providers[providerOptionKey(key)] = val
+}
+
+// providerOptionKey 将 scenarios.json 风格的旧键（如 includeSmtp）改写为 Web UI 键（smtpEnabled），见 legacyOptionKeys。
+func providerOptionKey(key string) string {
+	if k, ok := legacyOptionKeys[key]; ok {
+		return k
+	}
+	return key
+}
+
+// providerOptionValue 将 option 值转为 composegen.Options.Providers 的取值：布尔为 "true" / "false"，字符串与数字去除首尾空白。
+func providerOptionValue(v interface{}) (string, bool) {
+	if b, ok := toBool(v); ok {
+		return strconv.FormatBool(b), true
+	}
+	switch v.(type) {
+	case string, float64, int:
+		return optStr(v), true
+	}
+	return "", false
 }
 
 // optionToComposeGenJSONSetters 将 session/API 的 option 键统一映射到 composeGenOptionsJSON；新增选项时在此表与 config 各加一项即可。
@@ -153,24 +256,24 @@ var optionToComposeGenJSONSetters = map[string]func(*composeGenOptionsJSON, inte
 			o.TraefikNetwork = &b
 		}
 	},
-	"exposePorts": func(o *composeGenOptionsJSON, v interface{}) {
+	"bundledTraefik": func(o *composeGenOptionsJSON, v interface{}) {
 		if b, ok := toBool(v); ok {
-			o.ExposePorts = &b
+			o.BundledTraefik = &b
 		}
 	},
-	"dingtalkEnabled": func(o *composeGenOptionsJSON, v interface{}) {
+	"traefikDynamicFile": func(o *composeGenOptionsJSON, v interface{}) {
 		if b, ok := toBool(v); ok {
-			o.DingtalkEnabled = &b
+			o.TraefikDynamicFile = &b
 		}
 	},
-	"smtpEnabled": func(o *composeGenOptionsJSON, v interface{}) {
+	"traefikStripLabels": func(o *composeGenOptionsJSON, v interface{}) {
 		if b, ok := toBool(v); ok {
-			o.SmtpEnabled = &b
+			o.TraefikStripLabels = &b
 		}
 	},
-	"smtpUseOwlmail": func(o *composeGenOptionsJSON, v interface{}) {
+	"exposePorts": func(o *composeGenOptionsJSON, v interface{}) {
 		if b, ok := toBool(v); ok {
-			o.SmtpUseOwlmail = &b
+			o.ExposePorts = &b
 		}
 	},
 	"totpEnabled": func(o *composeGenOptionsJSON, v interface{}) {
@@ -193,32 +296,55 @@ var optionToComposeGenJSONSetters = map[string]func(*composeGenOptionsJSON, inte
 			o.DisableWardenRedisService = &b
 		}
 	},
-	"traefikNetworkName":     func(o *composeGenOptionsJSON, v interface{}) { o.TraefikNetworkName = optStr(v) },
-	"heraldRedisDataPath":    func(o *composeGenOptionsJSON, v interface{}) { o.HeraldRedisDataPath = optStr(v) },
-	"wardenRedisDataPath":    func(o *composeGenOptionsJSON, v interface{}) { o.WardenRedisDataPath = optStr(v) },
-	"portHerald":             func(o *composeGenOptionsJSON, v interface{}) { o.PortHerald = optStr(v) },
-	"portWarden":             func(o *composeGenOptionsJSON, v interface{}) { o.PortWarden = optStr(v) },
-	"containerNamePrefix":    func(o *composeGenOptionsJSON, v interface{}) { o.ContainerNamePrefix = optStr(v) },
-	"healthCheckInterval":    func(o *composeGenOptionsJSON, v interface{}) { o.HealthCheckInterval = optStr(v) },
-	"healthCheckStartPeriod": func(o *composeGenOptionsJSON, v interface{}) { o.HealthCheckStartPeriod = optStr(v) },
-	"portHeraldRedis":        func(o *composeGenOptionsJSON, v interface{}) { o.PortHeraldRedis = optStr(v) },
-	"portHeraldTotp":         func(o *composeGenOptionsJSON, v interface{}) { o.PortHeraldTotp = optStr(v) },
-	"portHeraldSmtp":         func(o *composeGenOptionsJSON, v interface{}) { o.PortHeraldSmtp = optStr(v) },
-	"portOwlmail":            func(o *composeGenOptionsJSON, v interface{}) { o.PortOwlmail = optStr(v) },
+	"secretsFiles": func(o *composeGenOptionsJSON, v interface{}) {
+		if b, ok := toBool(v); ok {
+			o.SecretsFiles = &b
+		}
+	},
+	// scenarios.json 中的 option 键（与上方 Web UI 键含义相同），便于场景预设直接填充
+	"includeTotp": func(o *composeGenOptionsJSON, v interface{}) {
+		if b, ok := toBool(v); ok {
+			o.TotpEnabled = &b
+		}
+	},
+	"stargateSessionRedisUseBuiltin": func(o *composeGenOptionsJSON, v interface{}) {
+		if b, ok := toBool(v); ok {
+			o.SessionStorageRedisUseBuiltin = &b
+		}
+	},
+	"traefikNetworkName":      func(o *composeGenOptionsJSON, v interface{}) { o.TraefikNetworkName = optStr(v) },
+	"traefikEntrypointHttp":   func(o *composeGenOptionsJSON, v interface{}) { o.TraefikEntrypointHTTP = optStr(v) },
+	"traefikEntrypointHttps":  func(o *composeGenOptionsJSON, v interface{}) { o.TraefikEntrypointHTTPS = optStr(v) },
+	"traefikHttpMiddlewares":  func(o *composeGenOptionsJSON, v interface{}) { o.TraefikHTTPMiddlewares = optStr(v) },
+	"traefikHttpsMiddlewares": func(o *composeGenOptionsJSON, v interface{}) { o.TraefikHTTPSMiddlewares = optStr(v) },
+	"traefikCertResolver":     func(o *composeGenOptionsJSON, v interface{}) { o.TraefikCertResolver = optStr(v) },
+	"traefikRouterPriority":   func(o *composeGenOptionsJSON, v interface{}) { o.TraefikRouterPriority = optStr(v) },
+	"traefikAuthMiddleware":   func(o *composeGenOptionsJSON, v interface{}) { o.TraefikAuthMiddleware = optStr(v) },
+	"heraldRedisDataPath":     func(o *composeGenOptionsJSON, v interface{}) { o.HeraldRedisDataPath = optStr(v) },
+	"wardenRedisDataPath":     func(o *composeGenOptionsJSON, v interface{}) { o.WardenRedisDataPath = optStr(v) },
+	"portHerald":              func(o *composeGenOptionsJSON, v interface{}) { o.PortHerald = optStr(v) },
+	"portWarden":              func(o *composeGenOptionsJSON, v interface{}) { o.PortWarden = optStr(v) },
+	"containerNamePrefix":     func(o *composeGenOptionsJSON, v interface{}) { o.ContainerNamePrefix = optStr(v) },
+	"healthCheckInterval":     func(o *composeGenOptionsJSON, v interface{}) { o.HealthCheckInterval = optStr(v) },
+	"healthCheckStartPeriod":  func(o *composeGenOptionsJSON, v interface{}) { o.HealthCheckStartPeriod = optStr(v) },
+	"portHeraldRedis":         func(o *composeGenOptionsJSON, v interface{}) { o.PortHeraldRedis = optStr(v) },
+	"portHeraldTotp":          func(o *composeGenOptionsJSON, v interface{}) { o.PortHeraldTotp = optStr(v) },
+	"swarmReplicas":           func(o *composeGenOptionsJSON, v interface{}) { o.SwarmReplicas = optStr(v) },
 }
 
 func optStr(v interface{}) string {
 	switch x := v.(type) {
 	case string:
 		return strings.TrimSpace(x)
-	case float64:
+	case float64, int:
 		return strings.TrimSpace(fmt.Sprintf("%v", x))
 	default:
 		return ""
 	}
 }
 
-// FillComposeGenOptionsFromMap 根据 option 键值映射填充 composeGenOptionsJSON，供 session 与 API 共用。
+// FillComposeGenOptionsFromMap 根据 option 键值映射填充 composeGenOptionsJSON，供 session 与 API 共用；
+// 不在 optionToComposeGenJSONSetters 中的键作为 Herald 通道选项（见 setProviderOption）。
 func FillComposeGenOptionsFromMap(o *composeGenOptionsJSON, m map[string]interface{}) {
 	if o == nil || m == nil {
 		return
@@ -226,6 +352,8 @@ func FillComposeGenOptionsFromMap(o *composeGenOptionsJSON, m map[string]interfa
 	for key, val := range m {
 		if setter, ok := optionToComposeGenJSONSetters[key]; ok {
 			setter(o, val)
+		} else {
+			o.setProviderOption(key, val)
 		}
 	}
 }
@@ -251,6 +379,15 @@ func reqOptionsToComposegen(o *composeGenOptionsJSON) *composegen.Options {
 	} else {
 		opts.TraefikNetwork = true
 	}
+	if o.BundledTraefik != nil {
+		opts.BundledTraefik = *o.BundledTraefik
+	}
+	if o.TraefikDynamicFile != nil {
+		opts.TraefikDynamicFile = *o.TraefikDynamicFile
+	}
+	if o.TraefikStripLabels != nil {
+		opts.TraefikStripLabels = *o.TraefikStripLabels
+	}
 	if o.ExposePorts != nil {
 		opts.ExposePorts = *o.ExposePorts
 	} else {
@@ -260,8 +397,14 @@ func reqOptionsToComposegen(o *composeGenOptionsJSON) *composegen.Options {
 	opts.PortWarden = strings.TrimSpace(o.PortWarden)
 	opts.PortHeraldRedis = strings.TrimSpace(o.PortHeraldRedis)
 	opts.PortHeraldTotp = strings.TrimSpace(o.PortHeraldTotp)
-	opts.PortHeraldSmtp = strings.TrimSpace(o.PortHeraldSmtp)
-	opts.PortOwlmail = strings.TrimSpace(o.PortOwlmail)
+	opts.SwarmReplicas = strings.TrimSpace(o.SwarmReplicas)
+	opts.TraefikEntrypointHTTP = strings.TrimSpace(o.TraefikEntrypointHTTP)
+	opts.TraefikEntrypointHTTPS = strings.TrimSpace(o.TraefikEntrypointHTTPS)
+	opts.TraefikHTTPMiddlewares = strings.TrimSpace(o.TraefikHTTPMiddlewares)
+	opts.TraefikHTTPSMiddlewares = strings.TrimSpace(o.TraefikHTTPSMiddlewares)
+	opts.TraefikCertResolver = strings.TrimSpace(o.TraefikCertResolver)
+	opts.TraefikRouterPriority = strings.TrimSpace(o.TraefikRouterPriority)
+	opts.TraefikAuthMiddleware = strings.TrimSpace(o.TraefikAuthMiddleware)
 	if opts.TraefikNetworkName == "" {
 		opts.TraefikNetworkName = "traefik"
 	}
@@ -288,20 +431,14 @@ func reqOptionsToComposegen(o *composeGenOptionsJSON) *composegen.Options {
 	} else {
 		opts.DisableWardenRedisService = false
 	}
-	if o.DingtalkEnabled != nil {
-		opts.IncludeDingTalk = *o.DingtalkEnabled
-	} else {
-		opts.IncludeDingTalk = false
+	if o.SecretsFiles != nil {
+		opts.SecretsFiles = *o.SecretsFiles
 	}
-	if o.SmtpEnabled != nil {
-		opts.IncludeSmtp = *o.SmtpEnabled
-	} else {
-		opts.IncludeSmtp = false
-	}
-	if o.SmtpUseOwlmail != nil {
-		opts.UseOwlmailForSmtp = *o.SmtpUseOwlmail
-	} else {
-		opts.UseOwlmailForSmtp = false
+	if len(o.Providers) > 0 {
+		opts.Providers = make(map[string]string, len(o.Providers))
+		for k, v := range o.Providers {
+			opts.Providers[k] = v
+		}
 	}
 	if o.TotpEnabled != nil {
 		opts.IncludeTotp = *o.TotpEnabled
@@ -320,3 +457,412 @@ func reqOptionsToComposegen(o *composeGenOptionsJSON) *composegen.Options {
 	}
 	return opts
 }
+
+// loadProviders 读取 config/providers.yaml 中的 Herald 通道描述（作为 composegen.Source.Providers）；文件缺失时返回 nil，使用内置定义。
+func loadProviders(root string) ([]composegen.Provider, error) {
+	return composegen.LoadProviders(filepath.Join(root, providersYAMLPath))
+}
+
+// loadModeDefs 读取 config/modes.yaml 中的 mode 定义（作为 composegen.Source.Modes）；文件缺失时返回 nil，使用内置定义。
+// gen 未指定 modes 且未选择场景时生成其中全部 mode。
+func loadModeDefs(root string) ([]composegen.ModeDef, error) {
+	return composegen.LoadModes(filepath.Join(root, modesYAMLPath))
+}
+
+// envFlag 收集可重复的 -env KEY=VALUE。
+type envFlag map[string]string
+
+func (e envFlag) String() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+e[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+func (e envFlag) Set(v string) error {
+	idx := strings.Index(v, "=")
+	if idx <= 0 {
+		return fmt.Errorf("expected KEY=VALUE, got %q", v)
+	}
+	e[strings.TrimSpace(v[:idx])] = v[idx+1:]
+	return nil
+}
+
+// optionFlagFallbackHelp 为 config-sections.yaml 中没有同名条目的选项（或无法读取该文件时）提供 flag 说明。
+var optionFlagFallbackHelp = map[string]string{
+	"useNamedVolume":            "Store Herald / Warden Redis data in named volumes; when false, bind-mount heraldRedisDataPath / wardenRedisDataPath.",
+	"disableWardenRedisService": "Remove the warden-redis service, its volume and the Warden Redis variables (Warden without Redis).",
+}
+
+// loadOptionFlagHelp 返回 gen 选项 flag 的说明：config/config-sections.yaml 中同名选项（id，含 redisPaths 的路径项）的 descKey
+// 在 config/i18n/en.yaml 中的文案，其余取 optionFlagFallbackHelp。
+func loadOptionFlagHelp(root string) map[string]string {
+	help := make(map[string]string, len(optionFlagFallbackHelp))
+	for k, v := range optionFlagFallbackHelp {
+		help[k] = v
+	}
+	var frag struct {
+		ConfigSections []configOptionSection `yaml:"configSections"`
+	}
+	data, err := os.ReadFile(filepath.Join(root, "config", "config-sections.yaml"))
+	if err != nil || yaml.Unmarshal(data, &frag) != nil {
+		return help
+	}
+	_, en, err := loadI18nFragment(filepath.Join(root, "config", "i18n", "en.yaml"))
+	if err != nil {
+		return help
+	}
+	set := func(name, descKey string) {
+		if desc := strings.TrimSpace(en[descKey]); name != "" && desc != "" {
+			help[name] = desc
+		}
+	}
+	for _, sec := range frag.ConfigSections {
+		for _, o := range sec.Options {
+			set(o.Id, o.DescKey)
+			for _, p := range o.Paths {
+				set(p.Id, p.DescKey)
+			}
+		}
+	}
+	return help
+}
+
+// registerOptionFlags 按 composeGenOptionsJSON 的 json 标签为每个选项注册同名 flag（*bool -> bool，string -> string），
+// 新增字段后 gen 自动获得对应 flag；envOverrides 由 -env 单独处理。Herald 通道选项按 providers 注册（开关 -> bool，端口 -> string），
+// 返回这些 flag 名供 optionFlagValues 使用。flag 说明取自 help（见 loadOptionFlagHelp）。
+func registerOptionFlags(fs *flag.FlagSet, providers []composegen.Provider, help map[string]string) map[string]bool {
+	usage := func(name, fallback string) string {
+		if h := help[name]; h != "" {
+			return h
+		}
+		return fallback
+	}
+	t := reflect.TypeOf(composeGenOptionsJSON{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonFieldName(f)
+		if name == "" {
+			continue
+		}
+		switch {
+		case f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Bool:
+			fs.Bool(name, false, usage(name, "compose generation option (see config/config-sections.yaml)"))
+		case f.Type.Kind() == reflect.String:
+			fs.String(name, "", usage(name, "compose generation option (see config/config-sections.yaml)"))
+		}
+	}
+	providerFlags := make(map[string]bool)
+	register := func(id, option, portOption string) {
+		// 内置于 herald 的通道（builtin）可不设开关
+		if option != "" {
+			fs.Bool(option, false, usage(option, "enable "+id+" (config/providers.yaml)"))
+			providerFlags[option] = true
+		}
+		if portOption != "" {
+			fs.String(portOption, "", usage(portOption, "host port for "+id))
+			providerFlags[portOption] = true
+		}
+	}
+	if len(providers) == 0 {
+		providers = composegen.DefaultProviders
+	}
+	for _, p := range providers {
+		register(p.ID, p.Option, p.PortOption)
+		if p.Mock != nil {
+			register(p.Mock.ID, p.Mock.Option, p.Mock.PortOption)
+		}
+	}
+	return providerFlags
+}
+
+// optionFlagValues 返回命令行中显式设置的 option flag（含 providerFlags 中的通道选项），形态与 session / scenarios 的 options 一致，
+// 供 FillComposeGenOptionsFromMap 使用。
+func optionFlagValues(fs *flag.FlagSet, providerFlags map[string]bool) map[string]interface{} {
+	out := make(map[string]interface{})
+	fs.Visit(func(f *flag.Flag) {
+		if _, ok := optionToComposeGenJSONSetters[f.Name]; !ok && !providerFlags[f.Name] {
+			return
+		}
+		if g, ok := f.Value.(flag.Getter); ok {
+			out[f.Name] = g.Get()
+		}
+	})
+	return out
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeFileAtomic 先写入同目录临时文件再 rename，避免中断时留下半截文件。
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer func() { _ = os.Remove(tmpName) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
+
+// cmdGen 在进程内调用 composegen.Source.Generate，将各 mode 的 docker-compose.yml 与 .env 写入 build/<mode>/（无需启动 serve 或 jq）。
+// 选项按 场景预设 -> -profile -> -config 文件 -> 命令行 flag 的顺序叠加，后者覆盖前者；
+// 使用 -profile 时 .env 与 Web UI「生成」一致，由 profile 的 envOverrides/keysOverrides 拼出。flag 须写在 mode 之前。
+func cmdGen() error {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	modesFlag := fs.String("modes", "", "comma-separated modes (default: config, profile or scene modes, or all)")
+	sceneFlag := fs.String("scene", "", "scenario preset id from config/scenarios.json (e.g. s4-gate-warden-herald or scene:s4-gate-warden-herald)")
+	profileFlag := fs.String("profile", "", "suite profile (YAML/JSON) exported from the Web UI; -scene overrides its scene")
+	configFlag := fs.String("config", "", "JSON file with the /api/generate request body (modes, envOverride, options)")
+	envFileFlag := fs.String("env-file", "", "use this file as the generated .env body instead of inferring it from compose")
+	generateKeysFlag := fs.Bool("generate-keys", false, "generate every config/keys-step.yaml key that is unset or still the compose default (Redis passwords excluded)")
+	_ = fs.String("out", "build", "output directory, relative to project root (env BUILD_DIR)")
+	envs := envFlag{}
+	fs.Var(envs, "env", "env override KEY=VALUE (repeatable)")
+	root := projectRoot()
+	providers, err := loadProviders(root)
+	if err != nil {
+		return err
+	}
+	providerFlags := registerOptionFlags(fs, providers, loadOptionFlagHelp(root))
+	fs.Usage = func() {
+		modes := composegen.ModeNames(nil)
+		if defs, err := loadModeDefs(root); err == nil {
+			modes = composegen.ModeNames(defs)
+		}
+		fmt.Fprintf(fs.Output(), "Usage: suite gen [flags] [mode ...]\n\nModes: %s (default, from %s); swarm (docker stack file); k8s writes build/k8s/k8s.yaml\n\nFlags:\n", strings.Join(modes, ", "), modesYAMLPath)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(cmdArgs); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	// flag 包在第一个 mode 处停止解析，其后的 flag 会被当作 mode 名或静默忽略
+	for _, arg := range fs.Args() {
+		if strings.HasPrefix(arg, "-") {
+			return fmt.Errorf("flag %s after mode %s: put flags before the modes (suite gen [flags] [mode ...])", arg, fs.Arg(0))
+		}
+	}
+
+	req := generateRequest{Options: &composeGenOptionsJSON{EnvOverrides: make(map[string]string)}}
+	o := req.Options
+
+	var sceneModes []string
+	var profSess *SessionData
+	if path := strings.TrimSpace(*profileFlag); path != "" {
+		p, err := loadProfile(path)
+		if err != nil {
+			return err
+		}
+		if s := strings.TrimSpace(*sceneFlag); s != "" {
+			p.Scene = s
+		}
+		if p, err = expandProfileScene(p, root); err != nil {
+			return err
+		}
+		profSess = &SessionData{}
+		profileToSession(p, profSess)
+		for k, v := range profSess.EnvOverrides {
+			o.EnvOverrides[k] = v
+		}
+		for k, v := range profSess.KeysOverrides {
+			o.EnvOverrides[k] = v
+		}
+		FillComposeGenOptionsFromMap(o, profSess.Options)
+		sceneModes = profSess.Modes
+	} else if id := strings.TrimPrefix(strings.TrimSpace(*sceneFlag), "scene:"); id != "" {
+		presets, err := loadScenarioPresets(root)
+		if err != nil {
+			return err
+		}
+		scene, ok := presets[id]
+		if !ok {
+			return fmt.Errorf("unknown scene %q (see config/scenarios.json)", id)
+		}
+		for k, v := range scene.EnvOverrides {
+			o.EnvOverrides[k] = v
+		}
+		FillComposeGenOptionsFromMap(o, scene.Options)
+		sceneModes = scene.Modes
+	}
+
+	if path := strings.TrimSpace(*configFlag); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read config: %w", err)
+		}
+		before := make(map[string]string, len(o.EnvOverrides))
+		for k, v := range o.EnvOverrides {
+			before[k] = v
+		}
+		// 解码到已填充的 req 上：文件中出现的字段覆盖场景预设，未出现的保持不变
+		if err := json.Unmarshal(b, &req); err != nil {
+			return fmt.Errorf("parse config %s: %w", path, err)
+		}
+		if req.Options == nil {
+			req.Options = o
+		}
+		o = req.Options
+		if o.EnvOverrides == nil {
+			o.EnvOverrides = make(map[string]string)
+		}
+		// 使用 -profile 时 .env 由 profSess 拼出，文件中新设或改写的变量须一并写入
+		if profSess != nil {
+			for k, v := range o.EnvOverrides {
+				if old, ok := before[k]; !ok || old != v {
+					profSess.EnvOverrides[k] = v
+				}
+			}
+		}
+	}
+
+	if path := strings.TrimSpace(*envFileFlag); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read env file: %w", err)
+		}
+		req.EnvOverride = string(b)
+	}
+
+	FillComposeGenOptionsFromMap(o, optionFlagValues(fs, providerFlags))
+	for k, v := range envs {
+		o.EnvOverrides[k] = v
+		if profSess != nil {
+			profSess.EnvOverrides[k] = v
+		}
+	}
+
+	src, err := composegen.LoadSource(filepath.Join(root, canonicalCompose))
+	if err != nil {
+		return err
+	}
+	if src.Modes, err = loadModeDefs(root); err != nil {
+		return err
+	}
+	src.Providers = providers
+	if *generateKeysFlag {
+		if req.EnvOverride != "" {
+			return fmt.Errorf("-generate-keys cannot be combined with -env-file")
+		}
+		generated, cleartext, err := generateMissingKeys(root, src.Compose, o.EnvOverrides)
+		if err != nil {
+			return err
+		}
+		// 哈希后的变量（如 PASSWORDS）只写入哈希，明文仅在此输出一次
+		for _, k := range sortedStringKeys(cleartext) {
+			fmt.Fprintf(os.Stderr, "%s: generated password %s (shown once; only its hash is written)\n", k, cleartext[k])
+		}
+		for k, v := range generated {
+			o.EnvOverrides[k] = v
+			if profSess != nil {
+				if profSess.KeysOverrides == nil {
+					profSess.KeysOverrides = make(map[string]string)
+				}
+				profSess.KeysOverrides[k] = v
+			}
+		}
+	}
+	if profSess != nil && req.EnvOverride == "" {
+		req.EnvOverride = sessionEnvBody(profSess)
+	}
+
+	modes := fs.Args()
+	if len(modes) == 0 && strings.TrimSpace(*modesFlag) != "" {
+		for _, m := range strings.Split(*modesFlag, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				modes = append(modes, m)
+			}
+		}
+	}
+	if len(modes) == 0 {
+		modes = req.Modes
+	}
+	if len(modes) == 0 {
+		modes = sceneModes
+	}
+	if len(modes) == 0 {
+		modes = composegen.ModeNames(src.Modes)
+	}
+
+	envMeta, err := composegen.LoadEnvMeta(filepath.Join(root, "config", "env-meta.yaml"))
+	if err != nil {
+		return err
+	}
+	opts := reqOptionsToComposegen(o)
+	opts.SecretKeys = loadKeysStepEnvKeys(root)
+	gen, err := src.Generate(modes, req.EnvOverride, opts, envMeta)
+	if err != nil {
+		return fmt.Errorf("generate: %w", err)
+	}
+	for _, w := range gen.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	outDir := configutil.ResolveString(fs, "out", "BUILD_DIR", "build", true)
+	if outDir == "" {
+		outDir = "build"
+	}
+	if !filepath.IsAbs(outDir) {
+		outDir = filepath.Join(root, outDir)
+	}
+	for _, mode := range modes {
+		dir := filepath.Join(outDir, mode)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		composePath := filepath.Join(dir, composegen.OutputFileName(mode))
+		envPath := filepath.Join(dir, ".env")
+		if err := writeFileAtomic(composePath, gen.Composes[mode], 0o644); err != nil {
+			return fmt.Errorf("write %s: %w", composePath, err)
+		}
+		if err := writeFileAtomic(envPath, gen.EnvFor(mode), 0o600); err != nil {
+			return fmt.Errorf("write %s: %w", envPath, err)
+		}
+		fmt.Printf("  %s, %s\n", composePath, envPath)
+		// 附加文件（如 Options.SecretsFiles 生成的 secrets/<name>）所在目录仅属主可进入，文件权限见 composegen.GeneratedFilePerm
+		for _, rel := range sortedKeys(gen.Files[mode]) {
+			p := filepath.Join(dir, filepath.FromSlash(rel))
+			if err := os.MkdirAll(filepath.Dir(p), composegen.SecretsDirPerm); err != nil {
+				return err
+			}
+			// 早先生成的子目录可能权限更宽，secrets 文件对所有用户可读，须收紧目录
+			if sub := filepath.Dir(p); sub != dir {
+				if err := os.Chmod(sub, composegen.SecretsDirPerm); err != nil {
+					return err
+				}
+			}
+			if err := writeFileAtomic(p, gen.Files[mode][rel], composegen.GeneratedFilePerm(rel)); err != nil {
+				return fmt.Errorf("write %s: %w", p, err)
+			}
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	fmt.Printf("Generated into %s/ for mode(s): %s\n", outDir, strings.Join(modes, " "))
+	return nil
+}
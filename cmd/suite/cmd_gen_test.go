@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soulteary/the-gate/internal/composegen"
+)
+
+// TestRegisterOptionFlagsHelp 确保 gen 的每个选项 flag（含通道开关与端口）都有来自 config-sections.yaml + i18n/en.yaml
+// 或 optionFlagFallbackHelp 的说明，而非通用占位文案。
+func TestRegisterOptionFlagsHelp(t *testing.T) {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	help := loadOptionFlagHelp(filepath.Join("..", ".."))
+	providerFlags := registerOptionFlags(fs, nil, help)
+	if !providerFlags["smtpEnabled"] || !providerFlags["portSmsSink"] {
+		t.Errorf("provider flags = %v", providerFlags)
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Usage != help[f.Name] || strings.Contains(f.Usage, "compose generation option") {
+			t.Errorf("-%s usage = %q", f.Name, f.Usage)
+		}
+	})
+	for _, name := range append([]string{"healthCheck", "useNamedVolume", "swarmReplicas"}, composegen.ProviderOptionKeys(nil)...) {
+		if fs.Lookup(name) == nil {
+			t.Errorf("-%s is not registered", name)
+		}
+	}
+	if h := help["heraldRedisDataPath"]; h != "Host path for Herald Redis data." {
+		t.Errorf("heraldRedisDataPath help = %q, want the redisPaths descKey text", h)
+	}
+}
+
+// runGen 以 args 运行 cmdGen。
+func runGen(t *testing.T, args ...string) error {
+	t.Helper()
+	saved := cmdArgs
+	defer func() { cmdArgs = saved }()
+	cmdArgs = args
+	return cmdGen()
+}
+
+// TestCmdGenWritesModes 确保 gen 将各 mode 的 docker-compose.yml（0644）与 .env（0600）写入 -out 目录。
+func TestCmdGenWritesModes(t *testing.T) {
+	out := t.TempDir()
+	if err := runGen(t, "-out", out, "image", "traefik-warden"); err != nil {
+		t.Fatalf("gen: %v", err)
+	}
+	for _, mode := range []string{"image", "traefik-warden"} {
+		for name, perm := range map[string]os.FileMode{"docker-compose.yml": 0o644, ".env": 0o600} {
+			fi, err := os.Stat(filepath.Join(out, mode, name))
+			if err != nil {
+				t.Errorf("%s/%s: %v", mode, name, err)
+				continue
+			}
+			if fi.Mode().Perm() != perm {
+				t.Errorf("%s/%s mode = %v, want %v", mode, name, fi.Mode().Perm(), perm)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "traefik")); !os.IsNotExist(err) {
+		t.Errorf("only the requested modes should be written, traefik: %v", err)
+	}
+}
+
+// TestCmdGenLayering 确保选项与变量按 场景预设 -> -profile -> -config -> 命令行 flag 的顺序叠加，后者覆盖前者。
+func TestCmdGenLayering(t *testing.T) {
+	dir := t.TempDir()
+	profile := filepath.Join(dir, "profile.yaml")
+	config := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(profile, []byte(`kind: stargate-suite/profile
+version: 1
+scene: s3-gate-warden
+options:
+  containerNamePrefix: profile-
+  healthCheckInterval: 20s
+envOverrides:
+  HERALD_ENABLED: "true"
+  LOGIN_PAGE_TITLE: from-profile
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config, []byte(`{"options":{"containerNamePrefix":"config-","envOverrides":{"LOGIN_PAGE_TITLE":"from-config","SESSION_STORAGE_ENABLED":"false"}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := runGen(t, "-out", out, "-profile", profile, "-config", config, "-env", "LOGIN_PAGE_TITLE=from-flag", "-containerNamePrefix", "flag-"); err != nil {
+		t.Fatalf("gen: %v", err)
+	}
+	// 未指定 mode 时使用场景的 traefik
+	envBody, err := os.ReadFile(filepath.Join(out, "traefik", ".env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, err := composegen.ParseDotEnv(string(envBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"WARDEN_ENABLED":          "true",      // 场景
+		"HERALD_ENABLED":          "true",      // profile 覆盖场景的 false
+		"SESSION_STORAGE_ENABLED": "false",     // -config 覆盖场景的 true
+		"LOGIN_PAGE_TITLE":        "from-flag", // -env 覆盖 profile 与 -config
+	} {
+		if env[k] != want {
+			t.Errorf("%s = %q, want %q", k, env[k], want)
+		}
+	}
+	compose, err := os.ReadFile(filepath.Join(out, "traefik", "docker-compose.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if y := string(compose); !strings.Contains(y, "container_name: flag-warden\n") || strings.Contains(y, "profile-") || strings.Contains(y, "config-") ||
+		!strings.Contains(y, "interval: 20s\n") {
+		t.Errorf("want -containerNamePrefix over -config over -profile, and the profile's healthCheckInterval:\n%s", y)
+	}
+}
+
+// TestCmdGenRejectsFlagsAfterModes 确保写在 mode 之后的 flag 报错，而非被静默忽略。
+func TestCmdGenRejectsFlagsAfterModes(t *testing.T) {
+	out := t.TempDir()
+	err := runGen(t, "-out", out, "traefik", "-secretsFiles")
+	if err == nil || !strings.Contains(err.Error(), "flag -secretsFiles after mode traefik") {
+		t.Errorf("gen traefik -secretsFiles: err = %v, want a flag-order error", err)
+	}
+	if entries, _ := os.ReadDir(out); len(entries) != 0 {
+		t.Errorf("nothing should be written, got %v", entries)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"io/fs"
 	"net"
 	"net/http"
@@ -35,6 +36,12 @@ type parseResponse struct {
 	Errors   []string          `json:"errors"`
 }
 
+// resolveResponse 为 /api/resolve 响应体：compose 为代入 .env 后的文档。
+type resolveResponse struct {
+	Compose string   `json:"compose"`
+	Errors  []string `json:"errors"`
+}
+
 // applyResponse 为 /api/apply 响应体；用于解析后一键导入生成配置。
 type applyResponse struct {
 	OK             bool              `json:"ok"`
@@ -43,6 +50,7 @@ type applyResponse struct {
 	SuggestedModes []string          `json:"suggestedModes"`
 	SuggestedScene string            `json:"suggestedScene,omitempty"`
 	Errors         []string          `json:"errors,omitempty"`
+	Warnings       []string          `json:"warnings,omitempty"` // 如跨服务密钥不一致（composegen.CheckSecretConsistency）
 }
 
 func handleParse(w http.ResponseWriter, r *http.Request) {
@@ -73,12 +81,50 @@ func handleParse(w http.ResponseWriter, r *http.Request) {
 		_ = json.NewEncoder(w).Encode(parseResponse{Errors: []string{err.Error()}})
 		return
 	}
+	// .env 仅做语法检查（如未闭合的多行引号），值在 /api/apply 时覆盖
+	if _, err := composegen.ParseDotEnv(req.Env); err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(parseResponse{Errors: []string{".env: " + err.Error()}})
+		return
+	}
 	services := extractServiceNames(parsed)
 	envVars := composegen.ExtractEnvVars(parsed)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	_ = json.NewEncoder(w).Encode(parseResponse{Services: services, EnvVars: envVars, Errors: []string{}})
 }
 
+// handleResolve 将请求中的 .env 代入 compose，返回变量全部替换后的文档（composegen.ResolveCompose），无需 Docker。
+func handleResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxGenerateBodyBytes)
+	var req parseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if strings.TrimSpace(req.Compose) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(resolveResponse{Errors: []string{"compose is required"}})
+		return
+	}
+	out, err := composegen.ResolveCompose([]byte(req.Compose), []byte(req.Env))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(resolveResponse{Errors: []string{err.Error()}})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(resolveResponse{Compose: string(out), Errors: []string{}})
+}
+
 func extractServiceNames(compose map[string]interface{}) []string {
 	svc, ok := compose["services"].(map[string]interface{})
 	if !ok {
@@ -92,29 +138,17 @@ func extractServiceNames(compose map[string]interface{}) []string {
 	return names
 }
 
-// parseEnvText 将 .env 文本解析为 KEY=VALUE 映射（每行一条，空行与 # 开头忽略）。
-func parseEnvText(env string) map[string]string {
-	out := make(map[string]string)
-	for _, line := range strings.Split(env, "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		idx := strings.Index(line, "=")
-		if idx <= 0 {
-			continue
-		}
-		key := strings.TrimSpace(line[:idx])
-		val := strings.TrimSpace(line[idx+1:])
-		// 去除可选的引号
-		if (strings.HasPrefix(val, `"`) && strings.HasSuffix(val, `"`)) || (strings.HasPrefix(val, "'") && strings.HasSuffix(val, "'")) {
-			val = val[1 : len(val)-1]
-		}
-		if key != "" {
-			out[key] = val
-		}
+// loadKeysStepEnvKeys 返回 config/keys-step.yaml 中的变量名，作为 composegen.Options.SecretKeys；文件缺失或无法解析时返回 nil。
+func loadKeysStepEnvKeys(root string) []string {
+	vars := loadKeysStepVars(root)
+	if vars == nil {
+		return nil
 	}
-	return out
+	keys := make([]string, 0, len(vars))
+	for _, v := range vars {
+		keys = append(keys, v.Env)
+	}
+	return keys
 }
 
 // suggestModes 根据解析出的服务名推断建议勾选的 compose 类型（用于一键导入）。
@@ -211,7 +245,14 @@ func handleApply(w http.ResponseWriter, r *http.Request) {
 	services := extractServiceNames(parsed)
 	envVars := composegen.ExtractEnvVars(parsed)
 	// .env 文本覆盖/追加到从 compose 提取的变量
-	for k, v := range parseEnvText(req.Env) {
+	dotenv, err := composegen.ParseDotEnv(req.Env)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(applyResponse{OK: false, Errors: []string{".env: " + err.Error()}})
+		return
+	}
+	for k, v := range dotenv {
 		envVars[k] = v
 	}
 	suggested := suggestModes(services)
@@ -223,6 +264,7 @@ func handleApply(w http.ResponseWriter, r *http.Request) {
 		EnvVars:        envVars,
 		SuggestedModes: suggested,
 		SuggestedScene: suggestedScene,
+		Warnings:       composegen.CheckSecretConsistency(composegen.ServiceEnv(parsed, envVars)),
 	})
 }
 
@@ -538,7 +580,14 @@ func handleImportApply(w http.ResponseWriter, r *http.Request) {
 	}
 	services := extractServiceNames(parsed)
 	envVars := composegen.ExtractEnvVars(parsed)
-	for k, v := range parseEnvText(req.Env) {
+	dotenv, err := composegen.ParseDotEnv(req.Env)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(applyResponse{OK: false, Errors: []string{".env: " + err.Error()}})
+		return
+	}
+	for k, v := range dotenv {
 		envVars[k] = v
 	}
 	sess, ok := GetSession(r.Context())
@@ -550,11 +599,70 @@ func handleImportApply(w http.ResponseWriter, r *http.Request) {
 		EnvVars:        envVars,
 		SuggestedModes: suggestModes(services),
 		SuggestedScene: suggestScene(services, envVars),
+		SecretIssues:   composegen.CheckSecretConsistency(composegen.ServiceEnv(parsed, envVars)),
 	}
 	SaveSession(r.Context(), sess)
 	http.Redirect(w, r, "/wizard/step-1", http.StatusFound)
 }
 
+// handleProfileExport 将当前会话导出为 suite profile 下载（?format=yaml|json，?keys=1 时包含密钥）。
+func handleProfileExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, _ := GetSession(r.Context())
+	format := "yaml"
+	if r.URL.Query().Get("format") == "json" {
+		format = "json"
+	}
+	b, err := marshalProfile(sessionToProfile(sess, r.URL.Query().Get("keys") == "1"), format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export profile: %v\n", err)
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-yaml; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="suite-profile.`+format+`"`)
+	_, _ = w.Write(b)
+}
+
+// handleProfileImport 解析请求体中的 profile（YAML/JSON，旧版本自动升级），展开场景后替换会话中的向导状态。
+func handleProfileImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sess, ok := GetSession(r.Context())
+	if !ok || sess == nil {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxGenerateBodyBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	p, err := parseProfile(body)
+	if err == nil {
+		p, err = expandProfileScene(p, projectRoot())
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(applyResponse{OK: false, Errors: []string{err.Error()}})
+		return
+	}
+	profileToSession(p, sess)
+	SaveSession(r.Context(), sess)
+	http.Redirect(w, r, "/review", http.StatusFound)
+}
+
 func handleGeneratePost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -565,39 +673,149 @@ func handleGeneratePost(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/wizard/step-1", http.StatusFound)
 		return
 	}
-	root := projectRoot()
-	fullPath := filepath.Join(root, canonicalCompose)
-	full, err := composegen.LoadCompose(fullPath)
+	gen, err := generateForSession(projectRoot(), sess)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "load compose: %v\n", err)
+		fmt.Fprintf(os.Stderr, "generate: %v\n", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
+	// Return JSON for multi-page: composes + env (+ files) (client can show download links)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(generateResponse(gen))
+}
+
+// generateForSession 按会话（modes、options、env/keys 覆盖）以当前配置快照调用 composegen.Source.Generate，供「生成」与确认页检查共用。
+func generateForSession(root string, sess *SessionData) (*composegen.Generated, error) {
+	snap, err := snapshotFor(root)
+	if err != nil {
+		return nil, err
+	}
 	opts := sessionToComposegenOptions(sess)
-	envBody := ""
-	for k, v := range sess.EnvOverrides {
-		envBody += k + "=" + v + "\n"
+	if opts != nil {
+		opts.SecretKeys = snap.SecretKeys()
 	}
-	for k, v := range sess.KeysOverrides {
-		envBody += k + "=" + v + "\n"
+	return snap.Source.Generate(sess.Modes, sessionEnvBody(sess), opts, snap.EnvMeta)
+}
+
+// decodeGenerateRequest 解析 /api/generate 与 /api/bundle 的请求体；失败时已写入错误响应并返回 false。
+func decodeGenerateRequest(w http.ResponseWriter, r *http.Request) (*generateRequest, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxGenerateBodyBytes)
+	var req generateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.Modes) == 0 {
+		http.Error(w, "modes required", http.StatusBadRequest)
+		return nil, false
+	}
+	// envOverride 格式错误是请求错误：Generate 同样会拒绝，但在此之后无法与内部错误区分
+	if _, err := composegen.ParseDotEnv(req.EnvOverride); err != nil {
+		http.Error(w, "env override: "+err.Error(), http.StatusBadRequest)
+		return nil, false
 	}
-	envMeta, _ := composegen.LoadEnvMeta(filepath.Join(root, "config", "env-meta.yaml"))
-	gen, err := composegen.Generate(full, sess.Modes, envBody, opts, envMeta)
+	return &req, true
+}
+
+// handleGenerateAPI 按请求体生成各 mode 的 compose 与 .env 并以 JSON 返回（POST /api/generate）。
+func handleGenerateAPI(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeGenerateRequest(w, r)
+	if !ok {
+		return
+	}
+	gen, err := generateFromRequest(projectRoot(), req)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "generate: %v\n", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
-	// Return JSON for multi-page: composes + env (client can show download links)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(generateResponse(gen))
+}
+
+// generateFromRequest 按 API 请求体（modes、options、envOverride）以当前配置快照调用 composegen.Source.Generate。
+func generateFromRequest(root string, req *generateRequest) (*composegen.Generated, error) {
+	snap, err := snapshotFor(root)
+	if err != nil {
+		return nil, err
+	}
+	opts := reqOptionsToComposegen(req.Options)
+	if opts != nil {
+		opts.SecretKeys = snap.SecretKeys()
+	}
+	return snap.Source.Generate(req.Modes, req.EnvOverride, opts, snap.EnvMeta)
+}
+
+// sessionReviewChecks 为确认页填入导入内容中的密钥不一致项，并生成一次会话配置，填入生成提示（Generated.Warnings：env 校验与
+// 各 mode 输出中的跨服务密钥一致性）、生产就绪检查（composegen.Lint）与代入 .env 后的 compose（composegen.Resolve）；
+// 会话未选择 modes 或生成失败时后者不填。
+func sessionReviewChecks(root string, sess *SessionData, p *pageData) {
+	if sess == nil {
+		return
+	}
+	if sess.ImportApplied != nil {
+		p.EnvIssues = append(p.EnvIssues, sess.ImportApplied.SecretIssues...)
+	}
+	if len(sess.Modes) == 0 {
+		return
+	}
+	gen, err := generateForSession(root, sess)
+	if err != nil {
+		return
+	}
+	p.EnvIssues = append(p.EnvIssues, gen.Warnings...)
+	p.LintFindings, _ = composegen.Lint(gen)
+	resolved, err := composegen.Resolve(gen)
+	if err != nil {
+		p.ResolveError = err.Error()
+		return
+	}
+	modes := make([]string, 0, len(resolved))
+	for m := range resolved {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+	for _, m := range modes {
+		p.Resolved = append(p.Resolved, resolvedCompose{Mode: m, YAML: string(resolved[m])})
+	}
+}
+
+// generateResponse 为 /generate 与 /api/generate 的 JSON 响应：composes、env，以及有附加文件（如 secrets）时的 files（mode -> 路径 -> 内容）、
+// 有生成提示时的 warnings（Generated.Warnings）。
+func generateResponse(gen *composegen.Generated) map[string]interface{} {
+	composes := make(map[string]string, len(gen.Composes))
+	envs := make(map[string]string, len(gen.Composes))
+	for mode, yml := range gen.Composes {
+		composes[mode] = string(yml)
+		envs[mode] = string(gen.EnvFor(mode))
+	}
 	res := map[string]interface{}{
-		"composes": make(map[string]string),
+		"composes": composes,
 		"env":      string(gen.Env),
+		"envs":     envs,
+	}
+	if len(gen.Files) > 0 {
+		files := make(map[string]map[string]string, len(gen.Files))
+		for mode, fs := range gen.Files {
+			files[mode] = make(map[string]string, len(fs))
+			for rel, b := range fs {
+				files[mode][rel] = string(b)
+			}
+		}
+		res["files"] = files
 	}
-	for mode, yml := range gen.Composes {
-		res["composes"].(map[string]string)[mode] = string(yml)
+	if len(gen.Warnings) > 0 {
+		res["warnings"] = gen.Warnings
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	_ = json.NewEncoder(w).Encode(res)
+	return res
 }
 
 // sessionToComposegenOptions builds composegen.Options from session (options + env overrides + keys)；option 映射与 API 共用 optionToComposeGenJSONSetters。
@@ -616,16 +834,19 @@ func sessionToComposegenOptions(sess *SessionData) *composegen.Options {
 func cmdServe() error {
 	root := projectRoot()
 	pagePath := filepath.Join(root, pageYAMLPath)
-	page, err := loadPageData(pagePath)
-	if err != nil {
+	if _, err := os.Stat(pagePath); err != nil {
 		if cwd, e := os.Getwd(); e == nil {
-			fallback := filepath.Join(cwd, pageYAMLPath)
-			page, err = loadPageData(fallback)
-		}
-		if err != nil {
-			return fmt.Errorf("load page config (tried %s and ./%s): %w", pagePath, pageYAMLPath, err)
+			pagePath = filepath.Join(cwd, pageYAMLPath)
 		}
 	}
+	snapshots, err := newSnapshotStore(root, pagePath)
+	if err != nil {
+		return fmt.Errorf("load config (page %s): %w", pagePath, err)
+	}
+	serveSnapshots = snapshots
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go snapshots.watch(snapshotPollInterval, stopWatch)
 	tmpl, err := template.ParseFS(staticFS,
 		"static/layout.tmpl",
 		"static/pages/entry.tmpl",
@@ -673,7 +894,7 @@ func cmdServe() error {
 			return
 		}
 		sess, _ := GetSession(r.Context())
-		renderPage(w, page, "entry", sess)
+		renderPage(w, snapshots.Load().Page, "entry", sess)
 	})
 	// Wizard steps: GET render, POST save session and redirect next
 	for i := 1; i <= 5; i++ {
@@ -693,7 +914,7 @@ func cmdServe() error {
 				return
 			}
 			sess, _ := GetSession(r.Context())
-			renderPage(w, page, fmt.Sprintf("wizard-%d", step), sess)
+			renderPage(w, snapshots.Load().Page, fmt.Sprintf("wizard-%d", step), sess)
 		})
 	}
 	// Keys page
@@ -703,16 +924,17 @@ func cmdServe() error {
 			return
 		}
 		sess, _ := GetSession(r.Context())
-		renderPage(w, page, "keys", sess)
+		renderPage(w, snapshots.Load().Page, "keys", sess)
 	})
 	mux.HandleFunc("/keys/apply", handleKeysApply)
+	mux.HandleFunc("/passwords/apply", handlePasswordsApply)
 	mux.HandleFunc("/import", func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path != "/import" || r.Method != http.MethodGet {
 			http.NotFound(w, r)
 			return
 		}
 		sess, _ := GetSession(r.Context())
-		renderPage(w, page, "import", sess)
+		renderPage(w, snapshots.Load().Page, "import", sess)
 	})
 	mux.HandleFunc("/import/parse", handleImportParse)
 	mux.HandleFunc("/import/apply", handleImportApply)
@@ -722,58 +944,24 @@ func cmdServe() error {
 			return
 		}
 		sess, _ := GetSession(r.Context())
-		renderPage(w, page, "review", sess)
+		p := *snapshots.Load().Page
+		sessionReviewChecks(projectRoot(), sess, &p)
+		renderPage(w, &p, "review", sess)
 	})
 	mux.HandleFunc("/generate", handleGeneratePost)
+	mux.HandleFunc("/bundle", handleBundle)
+	mux.HandleFunc("/profile/export", handleProfileExport)
+	mux.HandleFunc("/profile/import", handleProfileImport)
 
 	mux.Handle("/static/", http.StripPrefix("/static", staticHandler))
 	mux.HandleFunc("/api/parse", handleParse)
+	mux.HandleFunc("/api/resolve", handleResolve)
 	mux.HandleFunc("/api/apply", handleApply)
-	mux.HandleFunc("/api/generate", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		r.Body = http.MaxBytesReader(w, r.Body, maxGenerateBodyBytes)
-		var req generateRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			if strings.Contains(err.Error(), "request body too large") {
-				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
-				return
-			}
-			http.Error(w, "invalid json", http.StatusBadRequest)
-			return
-		}
-		if len(req.Modes) == 0 {
-			http.Error(w, "modes required", http.StatusBadRequest)
-			return
-		}
-		root := projectRoot()
-		fullPath := filepath.Join(root, canonicalCompose)
-		full, err := composegen.LoadCompose(fullPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "load compose: %v\n", err)
-			http.Error(w, "internal server error", http.StatusInternalServerError)
-			return
-		}
-		opts := reqOptionsToComposegen(req.Options)
-		envMeta, _ := composegen.LoadEnvMeta(filepath.Join(root, "config", "env-meta.yaml"))
-		gen, err := composegen.Generate(full, req.Modes, req.EnvOverride, opts, envMeta)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "generate: %v\n", err)
-			http.Error(w, "internal server error", http.StatusInternalServerError)
-			return
-		}
-		res := map[string]interface{}{
-			"composes": make(map[string]string),
-			"env":      string(gen.Env),
-		}
-		for mode, yml := range gen.Composes {
-			res["composes"].(map[string]string)[mode] = string(yml)
-		}
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		_ = json.NewEncoder(w).Encode(res)
-	})
+	mux.HandleFunc("/api/keys/generate", handleKeysGenerate)
+	mux.HandleFunc("/api/passwords", handlePasswordsAPI)
+	mux.HandleFunc("/api/generate", handleGenerateAPI)
+	mux.HandleFunc("/api/bundle", handleBundleAPI)
+	mux.HandleFunc("/api/snapshot", snapshots.handleStatus)
 	addr := ":" + servePort
 	srv := &http.Server{Addr: addr, Handler: sessionMiddleware(mux)}
 	listener, err := net.Listen("tcp", addr)
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestGenerateAPIEnvOverride 确保 /api/generate 与 /api/bundle 对格式错误的 envOverride 返回 400 与出错行号，合法时正常生成。
+func TestGenerateAPIEnvOverride(t *testing.T) {
+	bad := `{"modes":["image"],"envOverride":"HERALD_API_KEY=k\nNOT A LINE\n"}`
+	for path, handler := range map[string]http.HandlerFunc{
+		"/api/generate":          handleGenerateAPI,
+		"/api/bundle?format=zip": handleBundleAPI,
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(bad)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "env override: line 2") {
+			t.Errorf("%s: status %d, body %q; want 400 naming line 2", path, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handleGenerateAPI(rec, httptest.NewRequest(http.MethodPost, "/api/generate",
+		strings.NewReader(`{"modes":["image"],"envOverride":"HERALD_API_KEY=api-test-key\n"}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "HERALD_API_KEY=api-test-key") {
+		t.Errorf("valid envOverride: status %d, body %.200q", rec.Code, rec.Body.String())
+	}
+}
@@ -3,6 +3,7 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,29 +11,178 @@ import (
 	"github.com/soulteary/the-gate/internal/composegen"
 )
 
-// knownScenarioOptionKeys 返回 scenarios.json options 中受支持的键（与 scenarioOptionSetters 一致）。
-func knownScenarioOptionKeys() map[string]bool {
+// knownScenarioOptionKeys 返回 scenarios.json options 中受支持的键：scenarioOptionSetters 与 providers 声明的通道选项（含 legacyOptionKeys 中的旧键）。
+func knownScenarioOptionKeys(providers []composegen.Provider) map[string]bool {
 	m := make(map[string]bool)
 	for k := range scenarioOptionSetters {
 		m[k] = true
 	}
+	for _, k := range composegen.ProviderOptionKeys(providers) {
+		m[k] = true
+	}
+	for legacy, k := range legacyOptionKeys {
+		if m[k] {
+			m[legacy] = true
+		}
+	}
 	return m
 }
 
+// loadBuildServiceEnv 读取 dir 下的 docker-compose.yml 与 .env（可缺失），返回各服务实际环境变量；无 compose 时返回 nil。
+func loadBuildServiceEnv(dir string) (map[string]map[string]string, error) {
+	composePath := filepath.Join(dir, "docker-compose.yml")
+	if _, err := os.Stat(composePath); err != nil {
+		return nil, nil
+	}
+	compose, err := composegen.LoadCompose(composePath)
+	if err != nil {
+		return nil, err
+	}
+	vars := map[string]string{}
+	if b, err := os.ReadFile(filepath.Join(dir, ".env")); err == nil {
+		if vars, err = composegen.ParseDotEnv(string(b)); err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dir, ".env"), err)
+		}
+	}
+	return composegen.ServiceEnv(compose, vars), nil
+}
+
+// checkSecretConsistency 检查各目录（build/<mode>/）中跨服务密钥是否一致：每个目录单独检查，unit 中的目录视为同一部署的
+// 拆分部分（其 .env 可能被分别导入或编辑，如 traefik-herald 与 traefik-stargate），再逐对跨目录比较，结果与目录顺序无关。
+func checkSecretConsistency(dirs, unit []string) ([]string, error) {
+	var issues []string
+	parts := make(map[string]map[string]map[string]string)
+	inUnit := make(map[string]bool, len(unit))
+	for _, d := range unit {
+		inUnit[d] = true
+	}
+	for _, dir := range dirs {
+		env, err := loadBuildServiceEnv(dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		if env == nil {
+			continue
+		}
+		for _, e := range composegen.CheckSecretConsistency(env) {
+			issues = append(issues, dir+": "+e)
+		}
+		if inUnit[dir] {
+			parts[dir] = env
+		}
+	}
+	return append(issues, composegen.CheckSecretConsistencyAcross(parts)...), nil
+}
+
+// checkPageModes 对照 mode 定义（config/modes.yaml）检查 page.yaml 的 modes：页面中的 mode 须可生成（已定义或 swarm / k8s），
+// 返回错误；已定义但页面未列出的 mode 在 Web UI 中无法选择，返回警告。
+func checkPageModes(modes []pageMode, defs []composegen.ModeDef) (errs, warnings []string) {
+	listed := make(map[string]bool, len(modes))
+	for _, m := range modes {
+		listed[m.Value] = true
+		if !composegen.IsGeneratedMode(defs, m.Value) {
+			errs = append(errs, fmt.Sprintf("page mode %q is not defined in %s", m.Value, modesYAMLPath))
+		}
+	}
+	for _, name := range composegen.ModeNames(defs) {
+		if !listed[name] {
+			warnings = append(warnings, fmt.Sprintf("mode %q from %s is not listed in page.yaml modes (not selectable in the Web UI)", name, modesYAMLPath))
+		}
+	}
+	return errs, warnings
+}
+
+// checkPageProviderOptions 检查 providers 声明的通道选项（开关与主机端口，含 mock 的）是否在 page 配置项中出现；
+// 未出现的选项在 Web UI 中无法设置，返回警告。
+func checkPageProviderOptions(sections []configOptionSection, providers []composegen.Provider) []string {
+	names := make(map[string]bool)
+	for _, sec := range sections {
+		for _, o := range sec.Options {
+			names[o.Name] = true
+		}
+	}
+	var warnings []string
+	for _, k := range composegen.ProviderOptionKeys(providers) {
+		if !names[k] {
+			warnings = append(warnings, fmt.Sprintf("provider option %q from %s is not in page configSections (not settable in the Web UI)", k, providersYAMLPath))
+		}
+	}
+	return warnings
+}
+
+// lintBuildDirs 对各目录（build/<mode>/）的 docker-compose.yml 与 .env 做生产就绪检查（composegen.LintCompose），mode 取目录名；无 compose 的目录跳过。
+func lintBuildDirs(dirs []string) ([]composegen.LintFinding, error) {
+	var out []composegen.LintFinding
+	for _, dir := range dirs {
+		b, err := os.ReadFile(filepath.Join(dir, "docker-compose.yml"))
+		if err != nil {
+			continue
+		}
+		env, _ := os.ReadFile(filepath.Join(dir, ".env"))
+		findings, err := composegen.LintCompose(filepath.Base(dir), b, env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", dir, err)
+		}
+		out = append(out, findings...)
+	}
+	return out, nil
+}
+
+// cmdValidate 校验 config 可加载及一致性；参数为 build/<mode> 目录时（suite validate build/traefik-herald build/traefik-stargate）
+// 将其作为同一部署检查跨服务密钥一致性，无参数时检查 build/ 下已生成的各模式及拆分模式组合；
+// 同时对这些目录做生产就绪检查。密钥不一致与 lint 结果默认仅输出，-strict 时存在密钥不一致或 error 级别 lint 结果即失败。
 func cmdValidate() error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	strict := fs.Bool("strict", false, "fail on shared-secret mismatches and on error-severity findings from the production-readiness lint")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: suite validate [-strict] [build/<mode> ...]\n\nChecks that config loads, config consistency, that shared secrets match across services in generated output, and lints it for production readiness.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(cmdArgs); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
 	root := projectRoot()
 	pagePath := filepath.Join(root, pageYAMLPath)
-	_, err := loadPageData(pagePath)
+	page, err := loadPageData(pagePath)
 	if err != nil {
 		if cwd, e := os.Getwd(); e == nil {
 			fallback := filepath.Join(cwd, pageYAMLPath)
-			_, err = loadPageData(fallback)
+			page, err = loadPageData(fallback)
 		}
 	}
 	if err != nil {
 		return fmt.Errorf("config validation failed: %w", err)
 	}
 
+	// 一致性：page.yaml 的 modes 与 config/modes.yaml
+	defs, err := loadModeDefs(root)
+	if err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+	modeErrs, modeWarnings := checkPageModes(page.Modes, defs)
+	for _, w := range modeWarnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+	if len(modeErrs) > 0 {
+		for _, e := range modeErrs {
+			fmt.Fprintf(os.Stderr, "error: %s\n", e)
+		}
+		return fmt.Errorf("config validation failed: %d page mode(s) not defined", len(modeErrs))
+	}
+
+	// 一致性：config/providers.yaml 的通道选项与 page 配置项
+	providers, err := loadProviders(root)
+	if err != nil {
+		return fmt.Errorf("config validation failed: %w", err)
+	}
+	for _, w := range checkPageProviderOptions(page.ConfigSections, providers) {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
 	// 一致性：canonical compose 与 env-meta
 	envMetaPath := filepath.Join(root, "config", "env-meta.yaml")
 	meta, err := composegen.LoadEnvMeta(envMetaPath)
@@ -68,17 +218,64 @@ func cmdValidate() error {
 			Options map[string]interface{} `json:"options"`
 		}
 		if err := json.Unmarshal(b, &scenes); err == nil {
-			known := knownScenarioOptionKeys()
+			known := knownScenarioOptionKeys(providers)
 			for id, scene := range scenes {
 				for optKey := range scene.Options {
 					if !known[optKey] {
-						fmt.Fprintf(os.Stderr, "warning: scenario %q has unknown option %q (add to scenarioOptionSetters in cmd_gen.go)\n", id, optKey)
+						fmt.Fprintf(os.Stderr, "warning: scenario %q has unknown option %q (add to scenarioOptionSetters in cmd_gen.go or %s)\n", id, optKey, providersYAMLPath)
 					}
 				}
 			}
 		}
 	}
 
+	// 一致性：生成结果中跨服务共享的密钥
+	dirs, unit := fs.Args(), fs.Args()
+	if len(dirs) == 0 {
+		unit = nil
+		if len(defs) == 0 {
+			defs = composegen.DefaultModeDefs
+		}
+		// 外部网络的 mode 为同一部署的拆分部分（如 traefik-herald + traefik-stargate），跨目录比较
+		for _, d := range defs {
+			dir := filepath.Join(root, "build", d.Name)
+			dirs = append(dirs, dir)
+			if d.Network == composegen.ModeNetworkExternal {
+				unit = append(unit, dir)
+			}
+		}
+	}
+	issues, err := checkSecretConsistency(dirs, unit)
+	if err != nil {
+		return err
+	}
+	level := "warning"
+	if *strict {
+		level = "error"
+	}
+	for _, e := range issues {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", level, e)
+	}
+	if *strict && len(issues) > 0 {
+		return fmt.Errorf("secret consistency check failed (%d issue(s))", len(issues))
+	}
+
+	// 生产就绪检查：test-* 默认密钥、测试开关、Redis 端口暴露等
+	findings, err := lintBuildDirs(dirs)
+	if err != nil {
+		return err
+	}
+	lintErrors := 0
+	for _, f := range findings {
+		fmt.Fprintln(os.Stderr, f.String())
+		if f.Severity == composegen.LintError {
+			lintErrors++
+		}
+	}
+	if *strict && lintErrors > 0 {
+		return fmt.Errorf("production readiness lint failed (%d error(s))", lintErrors)
+	}
+
 	fmt.Println("config OK")
 	return nil
 }
@@ -0,0 +1,308 @@
+// Package main: dingtalk-mock command — local stand-in for the DingTalk Open API used by herald-dingtalk
+// (access token, user lookup by mobile, work notification) that keeps sent notifications in an inbox.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soulteary/cli-kit/configutil"
+)
+
+// dingtalkMockMaxBody 为单次请求体的上限。
+const dingtalkMockMaxBody = 64 << 10
+
+// dingtalkMessage 为收件箱中的一条工作通知。
+type dingtalkMessage struct {
+	ID         string    `json:"id"`
+	AgentID    string    `json:"agentId"`
+	UserIDs    []string  `json:"userIds"`
+	MsgType    string    `json:"msgType"`
+	Content    string    `json:"content"`
+	Code       string    `json:"code,omitempty"` // 从 content 中提取的验证码
+	Body       string    `json:"body"`           // 原始请求体
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// dingtalkMock 模拟钉钉开放平台：app key / secret、agent id 为空时不校验；手机号按 users 映射到 userid，
+// 未登记的手机号映射为 "mock-<手机号>"（normPhone 规范化；DINGTALK_LOOKUP_MODE=mobile 时可用任意手机号）。
+type dingtalkMock struct {
+	appKey, appSecret, agentID string
+	users                      map[string]string // 手机号 -> userid
+
+	mu     sync.Mutex
+	tokens map[string]string // app key -> access_token，每个 app key 只保留一个，避免反复获取令牌时无限增长
+	seq    int
+	inbox  mockInbox[dingtalkMessage]
+}
+
+// dingtalkError 为钉钉接口的错误响应（errcode 非 0）。
+func dingtalkError(w http.ResponseWriter, code int, msg string) {
+	writeMockJSON(w, http.StatusOK, map[string]interface{}{"errcode": code, "errmsg": msg})
+}
+
+// issueToken 校验 app key / secret 并返回该 app key 的 access_token：同一 app key 重复获取时返回同一令牌（与钉钉有效期内的行为一致）。
+func (d *dingtalkMock) issueToken(appKey, appSecret string) (string, bool) {
+	if (d.appKey != "" && appKey != d.appKey) || (d.appSecret != "" && appSecret != d.appSecret) {
+		return "", false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if token, ok := d.tokens[appKey]; ok {
+		return token, true
+	}
+	d.seq++
+	token := "mock-token-" + strconv.Itoa(d.seq)
+	d.tokens[appKey] = token
+	return token, true
+}
+
+// authorized 校验 access_token（查询参数，或新版接口的 x-acs-dingtalk-access-token 头）。
+func (d *dingtalkMock) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("access_token")
+	if token == "" {
+		token = r.Header.Get("x-acs-dingtalk-access-token")
+	}
+	if token == "" {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, t := range d.tokens {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// userID 返回手机号对应的 userid。
+func (d *dingtalkMock) userID(mobile string) string {
+	for m, id := range d.users {
+		if samePhone(m, mobile) {
+			return id
+		}
+	}
+	return "mock-" + normPhone(mobile)
+}
+
+// readParams 读取 JSON 或表单请求体为字符串参数（嵌套对象保留为 JSON 文本），并返回原始请求体。
+func readParams(w http.ResponseWriter, r *http.Request) (map[string]string, []byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, dingtalkMockMaxBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	params := make(map[string]string)
+	if strings.Contains(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		vals, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		for k := range vals {
+			params[k] = vals.Get(k)
+		}
+		return params, body, nil
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return params, body, nil
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, nil, err
+	}
+	for k, raw := range doc {
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			params[k] = s
+		} else {
+			params[k] = string(raw)
+		}
+	}
+	return params, body, nil
+}
+
+// notificationContent 从 msg（JSON 文本）取出消息类型与正文：text.content、markdown.text 或 action_card.markdown，其余类型为原文。
+func notificationContent(msg string) (msgType, content string) {
+	var m struct {
+		MsgType  string                       `json:"msgtype"`
+		Text     struct{ Content string }     `json:"text"`
+		Markdown struct{ Title, Text string } `json:"markdown"`
+		Card     struct{ Markdown string }    `json:"action_card"`
+	}
+	if json.Unmarshal([]byte(msg), &m) != nil {
+		return "", msg
+	}
+	switch {
+	case m.Text.Content != "":
+		return m.MsgType, m.Text.Content
+	case m.Markdown.Text != "":
+		return m.MsgType, m.Markdown.Text
+	case m.Card.Markdown != "":
+		return m.MsgType, m.Card.Markdown
+	}
+	return m.MsgType, msg
+}
+
+// handler 提供钉钉接口与收件箱 API（handleInbox，?userid= 或 ?mobile= 过滤）：
+//
+//	GET  /gettoken?appkey=&appsecret=                         获取 access_token
+//	POST /v1.0/oauth2/accessToken                             获取 accessToken（新版接口）
+//	POST /topapi/v2/user/getbymobile?access_token=            手机号查 userid
+//	POST /topapi/message/corpconversation/asyncsend_v2?access_token=  发送工作通知
+func (d *dingtalkMock) handler() http.Handler {
+	mux := http.NewServeMux()
+	handleInbox(mux, &d.inbox, func(r *http.Request) func(dingtalkMessage) bool {
+		to := r.URL.Query().Get("userid")
+		if mobile := r.URL.Query().Get("mobile"); mobile != "" {
+			to = d.userID(mobile)
+		}
+		if to == "" {
+			return nil
+		}
+		return func(m dingtalkMessage) bool {
+			for _, id := range m.UserIDs {
+				if id == to {
+					return true
+				}
+			}
+			return false
+		}
+	})
+	mux.HandleFunc("/gettoken", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		token, ok := d.issueToken(q.Get("appkey"), q.Get("appsecret"))
+		if !ok {
+			dingtalkError(w, 40089, "invalid appkey or appsecret")
+			return
+		}
+		writeMockJSON(w, http.StatusOK, map[string]interface{}{"errcode": 0, "errmsg": "ok", "access_token": token, "expires_in": 7200})
+	})
+	mux.HandleFunc("/v1.0/oauth2/accessToken", func(w http.ResponseWriter, r *http.Request) {
+		params, _, err := readParams(w, r)
+		if err != nil {
+			writeMockJSON(w, http.StatusBadRequest, map[string]string{"code": "InvalidParameter", "message": err.Error()})
+			return
+		}
+		token, ok := d.issueToken(params["appKey"], params["appSecret"])
+		if !ok {
+			writeMockJSON(w, http.StatusBadRequest, map[string]string{"code": "InvalidAuthentication", "message": "invalid appKey or appSecret"})
+			return
+		}
+		writeMockJSON(w, http.StatusOK, map[string]interface{}{"accessToken": token, "expireIn": 7200})
+	})
+	mux.HandleFunc("/topapi/v2/user/getbymobile", func(w http.ResponseWriter, r *http.Request) {
+		if !d.authorized(r) {
+			dingtalkError(w, 40014, "invalid access_token")
+			return
+		}
+		params, _, err := readParams(w, r)
+		if err != nil || strings.TrimSpace(params["mobile"]) == "" {
+			dingtalkError(w, 40035, "missing mobile")
+			return
+		}
+		writeMockJSON(w, http.StatusOK, map[string]interface{}{
+			"errcode": 0, "errmsg": "ok",
+			"result": map[string]string{"userid": d.userID(params["mobile"])},
+		})
+	})
+	mux.HandleFunc("/topapi/message/corpconversation/asyncsend_v2", func(w http.ResponseWriter, r *http.Request) {
+		if !d.authorized(r) {
+			dingtalkError(w, 40014, "invalid access_token")
+			return
+		}
+		params, body, err := readParams(w, r)
+		if err != nil {
+			dingtalkError(w, 40035, err.Error())
+			return
+		}
+		if d.agentID != "" && params["agent_id"] != d.agentID {
+			dingtalkError(w, 40056, "invalid agent_id")
+			return
+		}
+		var users []string
+		for _, id := range strings.Split(params["userid_list"], ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				users = append(users, id)
+			}
+		}
+		if len(users) == 0 {
+			dingtalkError(w, 40035, "missing userid_list")
+			return
+		}
+		msgType, content := notificationContent(params["msg"])
+		m := d.inbox.add(func(id string) dingtalkMessage {
+			return dingtalkMessage{
+				ID:         id,
+				AgentID:    params["agent_id"],
+				UserIDs:    users,
+				MsgType:    msgType,
+				Content:    content,
+				Code:       verifyCodePattern.FindString(content),
+				Body:       string(body),
+				ReceivedAt: time.Now().UTC(),
+			}
+		})
+		fmt.Printf("dingtalk-mock: %s: %s\n", strings.Join(m.UserIDs, ","), m.Content)
+		taskID, _ := strconv.Atoi(m.ID)
+		writeMockJSON(w, http.StatusOK, map[string]interface{}{"errcode": 0, "errmsg": "ok", "task_id": taskID, "request_id": "mock-" + m.ID})
+	})
+	return mux
+}
+
+// parseMockUsers 解析 "手机号=userid,..." 形式的用户映射。
+func parseMockUsers(s string) (map[string]string, error) {
+	users := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		mobile, id, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(mobile) == "" || strings.TrimSpace(id) == "" {
+			return nil, fmt.Errorf("invalid user mapping %q (want mobile=userid)", item)
+		}
+		users[strings.TrimSpace(mobile)] = strings.TrimSpace(id)
+	}
+	return users, nil
+}
+
+func cmdDingtalkMock() error {
+	fs := flag.NewFlagSet("dingtalk-mock", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.String("addr", ":8087", "listen address (env DINGTALK_MOCK_ADDR)")
+	fs.String("app-key", "", "accepted app key; empty accepts any (env DINGTALK_APP_KEY)")
+	fs.String("app-secret", "", "accepted app secret; empty accepts any (env DINGTALK_APP_SECRET)")
+	fs.String("agent-id", "", "accepted agent id; empty accepts any (env DINGTALK_AGENT_ID)")
+	fs.String("users", "", "mobile=userid pairs, comma-separated; other mobiles map to mock-<mobile> (env DINGTALK_MOCK_USERS)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: suite dingtalk-mock [-addr :8087] [-app-key k] [-app-secret s] [-agent-id id] [-users mobile=userid,...]\n\nRuns a local DingTalk Open API stand-in for herald-dingtalk (token, user lookup by mobile, work notification); sent notifications are listed at GET /messages?userid= or ?mobile=.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(cmdArgs); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	users, err := parseMockUsers(configutil.ResolveString(fs, "users", "DINGTALK_MOCK_USERS", "", true))
+	if err != nil {
+		return err
+	}
+	d := &dingtalkMock{
+		appKey:    configutil.ResolveString(fs, "app-key", "DINGTALK_APP_KEY", "", true),
+		appSecret: configutil.ResolveString(fs, "app-secret", "DINGTALK_APP_SECRET", "", true),
+		agentID:   configutil.ResolveString(fs, "agent-id", "DINGTALK_AGENT_ID", "", true),
+		users:     users,
+		tokens:    make(map[string]string),
+	}
+	addr := strings.TrimSpace(configutil.ResolveString(fs, "addr", "DINGTALK_MOCK_ADDR", ":8087", true))
+	return runMockServer("dingtalk-mock", addr, d.handler())
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestParseMockUsers 确保 "手机号=userid" 列表去除空白与空项，缺少 "=" 或任一侧为空时报错。
+func TestParseMockUsers(t *testing.T) {
+	users, err := parseMockUsers(" 13800138000=alice , ,+86 139-0013-9000=bob ")
+	if err != nil {
+		t.Fatalf("parseMockUsers: %v", err)
+	}
+	if len(users) != 2 || users["13800138000"] != "alice" || users["+86 139-0013-9000"] != "bob" {
+		t.Errorf("parseMockUsers = %v", users)
+	}
+	if users, err := parseMockUsers(""); err != nil || len(users) != 0 {
+		t.Errorf("parseMockUsers(\"\") = %v, %v; want empty", users, err)
+	}
+	for _, in := range []string{"13800138000", "=alice", "13800138000= ", "a=b,c"} {
+		if _, err := parseMockUsers(in); err == nil {
+			t.Errorf("parseMockUsers(%q): want an error", in)
+		}
+	}
+}
+
+// TestDingtalkMockTokens 确保两个获取令牌接口校验 app key / secret，同一 app key 重复获取返回同一令牌，
+// authorized 接受查询参数或 x-acs-dingtalk-access-token 头中的已签发令牌。
+func TestDingtalkMockTokens(t *testing.T) {
+	d := &dingtalkMock{appKey: "key", appSecret: "secret", tokens: make(map[string]string)}
+	srv := httptest.NewServer(d.handler())
+	defer srv.Close()
+
+	var legacy struct {
+		ErrCode     int    `json:"errcode"`
+		AccessToken string `json:"access_token"`
+	}
+	getJSON(t, srv.URL+"/gettoken?appkey=key&appsecret=wrong", &legacy)
+	if legacy.ErrCode != 40089 || legacy.AccessToken != "" {
+		t.Errorf("gettoken with a wrong secret = %+v, want errcode 40089", legacy)
+	}
+	getJSON(t, srv.URL+"/gettoken?appkey=key&appsecret=secret", &legacy)
+	if legacy.ErrCode != 0 || legacy.AccessToken == "" {
+		t.Fatalf("gettoken = %+v", legacy)
+	}
+
+	resp, err := http.Post(srv.URL+"/v1.0/oauth2/accessToken", "application/json", strings.NewReader(`{"appKey":"key","appSecret":"wrong"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("accessToken with a wrong secret = %d, want 400", resp.StatusCode)
+	}
+	var v1 struct {
+		AccessToken string `json:"accessToken"`
+		ExpireIn    int    `json:"expireIn"`
+	}
+	postJSON(t, srv.URL+"/v1.0/oauth2/accessToken", "application/json", `{"appKey":"key","appSecret":"secret"}`, &v1)
+	if v1.AccessToken != legacy.AccessToken || v1.ExpireIn != 7200 {
+		t.Errorf("accessToken = %+v, want the token already issued for the app key (%s)", v1, legacy.AccessToken)
+	}
+	for i := 0; i < 10; i++ {
+		d.issueToken("key", "secret")
+	}
+	if len(d.tokens) != 1 {
+		t.Errorf("repeated token requests kept %d tokens, want 1", len(d.tokens))
+	}
+
+	for name, c := range map[string]struct {
+		query, header string
+		want          bool
+	}{
+		"query":         {"?access_token=" + legacy.AccessToken, "", true},
+		"header":        {"", legacy.AccessToken, true},
+		"unknown token": {"?access_token=mock-token-999", "", false},
+		"missing":       {"", "", false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/topapi/v2/user/getbymobile"+c.query, nil)
+		if c.header != "" {
+			r.Header.Set("x-acs-dingtalk-access-token", c.header)
+		}
+		if got := d.authorized(r); got != c.want {
+			t.Errorf("authorized(%s) = %v, want %v", name, got, c.want)
+		}
+	}
+}
+
+// TestDingtalkMockHandler 确保 getbymobile 按映射（或 mock-<手机号>）返回 userid，asyncsend_v2 校验令牌与 agent_id 后
+// 将工作通知连同提取的验证码写入收件箱，/messages 可按 userid 或手机号过滤。
+func TestDingtalkMockHandler(t *testing.T) {
+	d := &dingtalkMock{agentID: "1001", users: map[string]string{"13800138000": "alice"}, tokens: make(map[string]string)}
+	srv := httptest.NewServer(d.handler())
+	defer srv.Close()
+	token, _ := d.issueToken("", "")
+	q := "?access_token=" + url.QueryEscape(token)
+
+	var errResp struct {
+		ErrCode int `json:"errcode"`
+	}
+	postJSON(t, srv.URL+"/topapi/v2/user/getbymobile?access_token=bad", "application/json", `{"mobile":"13800138000"}`, &errResp)
+	if errResp.ErrCode != 40014 {
+		t.Errorf("getbymobile with a bad token: errcode %d, want 40014", errResp.ErrCode)
+	}
+	postJSON(t, srv.URL+"/topapi/v2/user/getbymobile"+q, "application/json", `{}`, &errResp)
+	if errResp.ErrCode != 40035 {
+		t.Errorf("getbymobile without mobile: errcode %d, want 40035", errResp.ErrCode)
+	}
+	for mobile, want := range map[string]string{"+86 138-0013-8000": "alice", "13900139000": "mock-13900139000"} {
+		var lookup struct {
+			ErrCode int               `json:"errcode"`
+			Result  map[string]string `json:"result"`
+		}
+		postJSON(t, srv.URL+"/topapi/v2/user/getbymobile"+q, "application/json", `{"mobile":"`+mobile+`"}`, &lookup)
+		if lookup.ErrCode != 0 || lookup.Result["userid"] != want {
+			t.Errorf("getbymobile(%s) = %+v, want userid %s", mobile, lookup, want)
+		}
+	}
+
+	send := "/topapi/message/corpconversation/asyncsend_v2"
+	postJSON(t, srv.URL+send, "application/json", `{"agent_id":"1001","userid_list":"alice"}`, &errResp)
+	if errResp.ErrCode != 40014 {
+		t.Errorf("asyncsend_v2 without a token: errcode %d, want 40014", errResp.ErrCode)
+	}
+	postJSON(t, srv.URL+send+q, "application/json", `{"agent_id":"2002","userid_list":"alice"}`, &errResp)
+	if errResp.ErrCode != 40056 {
+		t.Errorf("asyncsend_v2 with a wrong agent_id: errcode %d, want 40056", errResp.ErrCode)
+	}
+	postJSON(t, srv.URL+send+q, "application/json", `{"agent_id":"1001","userid_list":" , "}`, &errResp)
+	if errResp.ErrCode != 40035 {
+		t.Errorf("asyncsend_v2 without users: errcode %d, want 40035", errResp.ErrCode)
+	}
+	var sent struct {
+		ErrCode int `json:"errcode"`
+		TaskID  int `json:"task_id"`
+	}
+	postJSON(t, srv.URL+send+q, "application/json",
+		`{"agent_id":"1001","userid_list":"alice, bob","msg":{"msgtype":"text","text":{"content":"Your code is 246810"}}}`, &sent)
+	if sent.ErrCode != 0 || sent.TaskID != 1 {
+		t.Errorf("asyncsend_v2 = %+v", sent)
+	}
+	form := url.Values{"agent_id": {"1001"}, "userid_list": {"mock-13900139000"}, "msg": {`{"msgtype":"markdown","markdown":{"title":"t","text":"code 1357"}}`}}
+	postJSON(t, srv.URL+send+q, "application/x-www-form-urlencoded", form.Encode(), &sent)
+	if sent.ErrCode != 0 || sent.TaskID != 2 {
+		t.Errorf("asyncsend_v2 (form) = %+v", sent)
+	}
+
+	var list struct {
+		Messages []dingtalkMessage `json:"messages"`
+	}
+	getJSON(t, srv.URL+"/messages?mobile="+url.QueryEscape("138 0013 8000"), &list)
+	if len(list.Messages) != 1 || list.Messages[0].MsgType != "text" || list.Messages[0].Code != "246810" || list.Messages[0].AgentID != "1001" {
+		t.Errorf("messages for alice = %+v", list.Messages)
+	}
+	getJSON(t, srv.URL+"/messages?userid=mock-13900139000", &list)
+	if len(list.Messages) != 1 || list.Messages[0].MsgType != "markdown" || list.Messages[0].Content != "code 1357" || list.Messages[0].Code != "1357" {
+		t.Errorf("messages for mock-13900139000 = %+v", list.Messages)
+	}
+}
+
+// getJSON 以 GET 请求 u 并将 JSON 响应解码到 v。
+func getJSON(t *testing.T, u string, v interface{}) {
+	t.Helper()
+	resp, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", u, err)
+	}
+}
+
+// postJSON 以 POST 发送 body 并将 JSON 响应解码到 v。
+func postJSON(t *testing.T, u, contentType, body string, v interface{}) {
+	t.Helper()
+	resp, err := http.Post(u, contentType, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("POST %s: %v", u, err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package main: server-side key generation for config/keys-step.yaml entries (/api/keys/generate, gen -generate-keys).
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/soulteary/the-gate/internal/composegen"
+	"gopkg.in/yaml.v3"
+)
+
+// generatedKey 为生成器的结果：Value 写入变量；Cleartext 非空时为仅展示一次、不写入任何文件的明文（如 PASSWORDS 中 bcrypt 哈希对应的密码）。
+type generatedKey struct {
+	Value     string
+	Cleartext string
+}
+
+// valueOnly 将只产生变量值的生成函数包装为 keyGenerators 的形式。
+func valueOnly(gen func() (string, error)) func() (generatedKey, error) {
+	return func() (generatedKey, error) {
+		v, err := gen()
+		return generatedKey{Value: v}, err
+	}
+}
+
+// keyGenerators 为 keys-step.yaml 中 generator 字段的取值到生成函数的映射，均使用 crypto/rand。
+var keyGenerators = map[string]func() (generatedKey, error){
+	// apiKey / hmacSecret：32 字节随机数的 hex（64 字符）
+	"apiKey":     valueOnly(func() (string, error) { return randomHex(32) }),
+	"hmacSecret": valueOnly(func() (string, error) { return randomHex(32) }),
+	// hmacKeys：JSON 对象 {"key-<id>":"<secret>"}，供 HERALD_HMAC_KEYS / WARDEN_HMAC_KEYS
+	"hmacKeys": valueOnly(func() (string, error) {
+		id, err := randomHex(4)
+		if err != nil {
+			return "", err
+		}
+		secret, err := randomHex(32)
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(map[string]string{"key-" + id: secret})
+		return string(b), err
+	}),
+	// aes256：32 字节随机数的标准 base64（44 字符，即 openssl rand -base64 32），herald-totp 解码后作为 AES-256 密钥（HERALD_TOTP_ENCRYPTION_KEY）
+	"aes256": valueOnly(func() (string, error) {
+		b, err := randomBytes(32)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(b), nil
+	}),
+	// totpSecret：20 字节随机数的 base32（RFC 4648，无填充，32 字符），即 TOTP（RFC 6238）密钥格式（WARDEN_OTP_SECRET_KEY）
+	"totpSecret": valueOnly(func() (string, error) {
+		b, err := randomBytes(20)
+		if err != nil {
+			return "", err
+		}
+		return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+	}),
+	// password：24 字节随机数的 base64url（32 字符，无需引号即可写入 .env）
+	"password": valueOnly(randomPassword),
+	// passwords：Stargate PASSWORDS 格式，单个随机密码按 defaultPasswordAlgorithm（bcrypt）哈希；明文仅通过 Cleartext 展示一次
+	"passwords": func() (generatedKey, error) {
+		p, err := randomPassword()
+		if err != nil {
+			return generatedKey{}, err
+		}
+		v, err := buildPasswordsValue(defaultPasswordAlgorithm, []string{p})
+		if err != nil {
+			return generatedKey{}, err
+		}
+		return generatedKey{Value: v, Cleartext: p}, nil
+	},
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("generate random bytes: %w", err)
+	}
+	return b, nil
+}
+
+func randomHex(n int) (string, error) {
+	b, err := randomBytes(n)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func randomPassword() (string, error) {
+	b, err := randomBytes(24)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// loadKeysStepVars 读取 config/keys-step.yaml；文件缺失或无法解析时返回 nil。
+func loadKeysStepVars(root string) []envVar {
+	b, err := os.ReadFile(filepath.Join(root, "config", "keys-step.yaml"))
+	if err != nil {
+		return nil
+	}
+	var frag keysStepYAML
+	if err := yaml.Unmarshal(b, &frag); err != nil {
+		return nil
+	}
+	return frag.KeysStepVars
+}
+
+// generateKeys 为 vars 中声明了 generator 的变量生成新值。only 非空时仅生成其中列出的变量（未知或不可生成的变量报错）；
+// only 为空即「全部生成」，跳过 skipGenerateAll 的变量（如需 Redis 配置 requirepass 才能使用的密码）。
+// 第二个返回值为需向用户展示一次的明文（变量名 -> 明文，见 generatedKey.Cleartext），无则为空。
+func generateKeys(vars []envVar, only []string) (map[string]string, map[string]string, error) {
+	byEnv := make(map[string]envVar, len(vars))
+	for _, v := range vars {
+		byEnv[v.Env] = v
+	}
+	var targets []envVar
+	if len(only) == 0 {
+		for _, v := range vars {
+			if v.Generator != "" && !v.SkipGenerateAll {
+				targets = append(targets, v)
+			}
+		}
+	} else {
+		for _, env := range only {
+			v, ok := byEnv[env]
+			if !ok {
+				return nil, nil, fmt.Errorf("unknown key %q (see config/keys-step.yaml)", env)
+			}
+			if v.Generator == "" {
+				return nil, nil, fmt.Errorf("key %s has no generator and must be provided", env)
+			}
+			targets = append(targets, v)
+		}
+	}
+	out := make(map[string]string, len(targets))
+	cleartext := make(map[string]string)
+	for _, v := range targets {
+		gen, ok := keyGenerators[v.Generator]
+		if !ok {
+			return nil, nil, fmt.Errorf("key %s: unknown generator %q", v.Env, v.Generator)
+		}
+		key, err := gen()
+		if err != nil {
+			return nil, nil, err
+		}
+		out[v.Env] = key.Value
+		if key.Cleartext != "" {
+			cleartext[v.Env] = key.Cleartext
+		}
+	}
+	return out, cleartext, nil
+}
+
+// generateMissingKeys 供 gen -generate-keys：为 overrides 中未设置、为空或仍等于 canonical compose 默认值（e2e 测试值）的变量生成新值，
+// 跳过 skipGenerateAll 与无 generator 的变量；第二个返回值同 generateKeys。
+func generateMissingKeys(root string, full map[string]interface{}, overrides map[string]string) (map[string]string, map[string]string, error) {
+	vars := loadKeysStepVars(root)
+	if len(vars) == 0 {
+		return nil, nil, fmt.Errorf("config/keys-step.yaml not found or empty")
+	}
+	defaults := composegen.ExtractEnvVars(full)
+	var missing []string
+	for _, v := range vars {
+		if v.Generator == "" || v.SkipGenerateAll {
+			continue
+		}
+		if cur := overrides[v.Env]; cur != "" && cur != defaults[v.Env] {
+			continue
+		}
+		missing = append(missing, v.Env)
+	}
+	if len(missing) == 0 {
+		return nil, nil, nil
+	}
+	return generateKeys(vars, missing)
+}
+
+// keysGenerateRequest 为 POST /api/keys/generate 的请求体；keys 为空（或无请求体）时全部生成。
+type keysGenerateRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// handleKeysGenerate 按 config/keys-step.yaml 的 generator 在服务端生成密钥，返回 {"keys": {ENV: value}}，
+// 另有需展示一次的明文时附带 "cleartext": {ENV: 明文}；不写入会话，由 /keys/apply 填入。
+func handleKeysGenerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxGenerateBodyBytes)
+	var req keysGenerateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	var vars []envVar
+	if snap, err := snapshotFor(projectRoot()); err == nil {
+		vars = snap.Page.KeysStepVars
+	}
+	if len(vars) == 0 {
+		http.Error(w, "config/keys-step.yaml not found", http.StatusInternalServerError)
+		return
+	}
+	keys, cleartext, err := generateKeys(vars, req.Keys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := map[string]interface{}{"keys": keys}
+	if len(cleartext) > 0 {
+		resp["cleartext"] = cleartext
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(resp)
+}
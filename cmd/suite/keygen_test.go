@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestKeyGeneratorFormats 确保 aes256 为 32 字节随机数的 base64、totpSecret 为可解码的 base32 TOTP 密钥，
+// passwords 只输出 bcrypt 哈希、明文经 Cleartext 返回且与哈希匹配。
+func TestKeyGeneratorFormats(t *testing.T) {
+	aes, err := keyGenerators["aes256"]()
+	if err != nil {
+		t.Fatalf("aes256: %v", err)
+	}
+	if b, err := base64.StdEncoding.DecodeString(aes.Value); err != nil || len(b) != 32 {
+		t.Errorf("aes256 = %q, want base64 of 32 bytes (err=%v)", aes.Value, err)
+	}
+
+	totp, err := keyGenerators["totpSecret"]()
+	if err != nil {
+		t.Fatalf("totpSecret: %v", err)
+	}
+	if b, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(totp.Value); err != nil || len(b) != 20 {
+		t.Errorf("totpSecret = %q, want unpadded base32 of 20 bytes (err=%v)", totp.Value, err)
+	}
+
+	pw, err := keyGenerators["passwords"]()
+	if err != nil {
+		t.Fatalf("passwords: %v", err)
+	}
+	hash, ok := strings.CutPrefix(pw.Value, "bcrypt:")
+	if !ok || pw.Cleartext == "" || strings.Contains(pw.Value, pw.Cleartext) {
+		t.Fatalf("passwords = %+v, want bcrypt:<hash> with cleartext kept separately", pw)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw.Cleartext)); err != nil {
+		t.Errorf("cleartext does not match hash: %v", err)
+	}
+}
+
+// TestKeysStepGenerators 确保 config/keys-step.yaml 中引用的 generator 均已实现。
+func TestKeysStepGenerators(t *testing.T) {
+	vars := loadKeysStepVars(filepath.Join("..", ".."))
+	if len(vars) == 0 {
+		t.Fatal("config/keys-step.yaml not loaded")
+	}
+	for _, v := range vars {
+		if _, ok := keyGenerators[v.Generator]; v.Generator != "" && !ok {
+			t.Errorf("%s: unknown generator %q", v.Env, v.Generator)
+		}
+	}
+}
+
+// TestGenerateMissingKeys 确保 gen -generate-keys 只为未设置、为空或仍为 compose 默认值的变量生成新值，
+// 跳过 skipGenerateAll 与无 generator 的变量，并返回 passwords 生成器的明文。
+func TestGenerateMissingKeys(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "config"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	keysStep := `keysStepVars:
+  - env: HERALD_API_KEY
+    generator: apiKey
+  - env: WARDEN_API_KEY
+    generator: apiKey
+  - env: HERALD_HMAC_SECRET
+    generator: hmacSecret
+  - env: PASSWORDS
+    generator: passwords
+  - env: WARDEN_REDIS_PASSWORD
+    generator: password
+    skipGenerateAll: true
+  - env: WARDEN_REMOTE_RSA_PRIVATE_KEY
+`
+	if err := os.WriteFile(filepath.Join(root, "config", "keys-step.yaml"), []byte(keysStep), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	full := map[string]interface{}{
+		"services": map[string]interface{}{
+			"herald": map[string]interface{}{
+				"environment": []interface{}{
+					"API_KEY=${HERALD_API_KEY:-test-herald-api-key}",
+					"HMAC_SECRET=${HERALD_HMAC_SECRET:-test-hmac-secret}",
+					"WARDEN_API_KEY=${WARDEN_API_KEY:-test-warden-api-key}",
+				},
+			},
+		},
+	}
+	overrides := map[string]string{
+		"HERALD_API_KEY":     "test-herald-api-key", // 仍为默认值，需重新生成
+		"WARDEN_API_KEY":     "custom-key",          // 已自定义，保留
+		"HERALD_HMAC_SECRET": "",
+	}
+	got, cleartext, err := generateMissingKeys(root, full, overrides)
+	if err != nil {
+		t.Fatalf("generateMissingKeys: %v", err)
+	}
+	want := []string{"HERALD_API_KEY", "HERALD_HMAC_SECRET", "PASSWORDS"}
+	if keys := sortedStringKeys(got); strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Fatalf("generated keys = %v, want %v", keys, want)
+	}
+	if got["HERALD_API_KEY"] == "test-herald-api-key" || len(got["HERALD_API_KEY"]) != 64 {
+		t.Errorf("HERALD_API_KEY = %q, want a new 64-char hex key", got["HERALD_API_KEY"])
+	}
+	if len(cleartext) != 1 || cleartext["PASSWORDS"] == "" {
+		t.Errorf("cleartext = %v, want only PASSWORDS", cleartext)
+	}
+
+	for k, v := range got {
+		overrides[k] = v
+	}
+	if got, _, err := generateMissingKeys(root, full, overrides); err != nil || got != nil {
+		t.Errorf("second run = %v, %v; want nothing to generate", got, err)
+	}
+	if _, _, err := generateMissingKeys(t.TempDir(), full, nil); err == nil {
+		t.Error("missing config/keys-step.yaml should be an error")
+	}
+}
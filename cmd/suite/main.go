@@ -1,4 +1,4 @@
-// Package main 提供 Web UI 与 compose 生成（help、validate、serve；配置生成仅通过网页）。
+// Package main 提供 Web UI 与 compose 生成（help、gen、profile、validate、serve）。
 package main
 
 import (
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/soulteary/cli-kit/configutil"
+	"github.com/soulteary/the-gate/internal/composegen"
 )
 
 //go:embed static
@@ -19,23 +20,35 @@ var staticFS embed.FS
 const (
 	pageYAMLPath         = "config/page.yaml"
 	canonicalCompose     = "compose/canonical/docker-compose.yml"
+	modesYAMLPath        = "config/modes.yaml"
+	providersYAMLPath    = "config/providers.yaml"
 	maxGenerateBodyBytes = 1 << 20 // 1MB for /api/generate request body
 )
 
 // pageData 与 config/page.yaml 对应，用于渲染 index 模板。
 type pageData struct {
-	I18N           template.JS           `json:"-"`
-	Scenarios      template.JS           `json:"-"`
-	Title          string                `yaml:"-"`
-	Lang           string                `yaml:"-"`
-	Page           string                `yaml:"-"` // "entry", "wizard-1".."wizard-5", "keys", "import", "review"
-	PageContent    string                `yaml:"-"` // template name for layout: "content-entry", "content-wizard-1", etc.
-	Session        *SessionData          `yaml:"-"` // nil or wizard state for pre-fill
-	Modes          []pageMode            `yaml:"modes"`
-	ConfigSections []configOptionSection `yaml:"configSections"`
-	Services       []pageService         `yaml:"services"`
-	Providers      []pageService         `yaml:"providers"`
-	KeysStepVars   []envVar              `yaml:"-"` // 从 config/keys-step.yaml 加载
+	I18N           template.JS              `json:"-"`
+	Scenarios      template.JS              `json:"-"`
+	Title          string                   `yaml:"-"`
+	Lang           string                   `yaml:"-"`
+	Page           string                   `yaml:"-"` // "entry", "wizard-1".."wizard-5", "keys", "import", "review"
+	PageContent    string                   `yaml:"-"` // template name for layout: "content-entry", "content-wizard-1", etc.
+	Session        *SessionData             `yaml:"-"` // nil or wizard state for pre-fill
+	Modes          []pageMode               `yaml:"modes"`
+	ConfigSections []configOptionSection    `yaml:"configSections"`
+	Services       []pageService            `yaml:"services"`
+	Providers      []pageService            `yaml:"providers"`
+	KeysStepVars   []envVar                 `yaml:"-"` // 从 config/keys-step.yaml 加载
+	EnvIssues      []string                 `yaml:"-"` // 确认页：env 校验与跨服务密钥一致性提示
+	LintFindings   []composegen.LintFinding `yaml:"-"` // 确认页：生产就绪检查（composegen.Lint）
+	Resolved       []resolvedCompose        `yaml:"-"` // 确认页：代入 .env 后的 compose（composegen.Resolve）
+	ResolveError   string                   `yaml:"-"` // 确认页：解析失败原因（如 ${VAR:?err} 缺值）
+}
+
+// resolvedCompose 为确认页展示的单个 mode 解析结果。
+type resolvedCompose struct {
+	Mode string
+	YAML string
 }
 
 type configOptionSection struct {
@@ -83,6 +96,7 @@ type pageService struct {
 	Id       string        `yaml:"id"`
 	Name     string        `yaml:"name"`
 	NameKey  string        `yaml:"nameKey"` // 可选，用于 i18n 显示名称（如 providers）
+	Option   string        `yaml:"option"`  // 仅 providers：启用开关的 option 名，未启用时 Web UI 隐藏该通道的配置
 	Open     bool          `yaml:"open"`
 	Sections []pageSection `yaml:"sections"`
 }
@@ -104,6 +118,9 @@ type envVar struct {
 	Options        []selectOption `yaml:"options"`
 	ShowWhenEnv    string         `yaml:"showWhenEnv"`
 	ShowWhenOption string         `yaml:"showWhenOption"`
+	// Generator、SkipGenerateAll 仅用于 keys-step.yaml：生成器名见 keygen.go 的 keyGenerators
+	Generator       string `yaml:"generator"`
+	SkipGenerateAll bool   `yaml:"skipGenerateAll"`
 }
 
 type selectOption struct {
@@ -126,6 +143,9 @@ type keysStepYAML struct {
 
 var servePort string
 
+// cmdArgs 为命令名之后的参数，供需要自有 flag 的子命令（如 gen）解析。
+var cmdArgs []string
+
 type command struct {
 	name, desc string
 	fn         func() error
@@ -137,8 +157,12 @@ func getCommands() []command {
 	if len(commands) == 0 {
 		commands = []command{
 			{"help", "Show help information", cmdHelp},
-			{"validate", "Validate that page config and merged config load without error", cmdValidate},
+			{"gen", "Generate build/<mode>/docker-compose.yml and .env in-process (gen -h for flags)", cmdGen},
+			{"profile", "Upgrade a suite profile file to the current schema version (profile -h)", cmdProfile},
+			{"validate", "Validate config and shared secrets in generated build/ output (validate -h)", cmdValidate},
 			{"serve", "Start web UI for compose generation (default :8085)", cmdServe},
+			{"sms-sink", "Run a local SMS inbox for Herald's httpapi SMS provider (default :8086)", cmdSMSSink},
+			{"dingtalk-mock", "Run a local DingTalk Open API stand-in for herald-dingtalk (default :8087)", cmdDingtalkMock},
 		}
 	}
 	return commands
@@ -152,7 +176,7 @@ func cmdHelp() error {
 		fmt.Printf("  %-22s %s\n", c.name, c.desc)
 	}
 	fmt.Println()
-	fmt.Println("Compose generation is done in the Web UI (make serve). E2E: scripts/run-e2e.sh. Service lifecycle: Makefile (make up, make down) or docker compose.")
+	fmt.Println("Compose generation: suite gen (headless) or the Web UI (make serve). E2E: scripts/run-e2e.sh. Service lifecycle: Makefile (make up, make down) or docker compose.")
 	return nil
 }
 
@@ -203,6 +227,7 @@ func main() {
 	cmdName := "help"
 	if len(args) > 0 {
 		cmdName = strings.TrimSpace(args[0])
+		cmdArgs = args[1:]
 	}
 
 	if cmdName == "serve" {
@@ -0,0 +1,120 @@
+// Package main: in-memory inbox and HTTP helpers shared by the local channel stand-ins (sms-sink, dingtalk-mock).
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// mockInboxMaxMessages 为收件箱保留的最大条数，超出时丢弃最早的消息。
+const mockInboxMaxMessages = 1000
+
+// verifyCodePattern 从消息正文中提取验证码（4–8 位数字）。
+var verifyCodePattern = regexp.MustCompile(`\b\d{4,8}\b`)
+
+// mockInbox 为内存收件箱（进程重启即清空），按接收顺序保存消息。
+type mockInbox[T any] struct {
+	mu       sync.Mutex
+	seq      int
+	messages []T
+}
+
+// add 以递增 ID 构造消息并保存。
+func (b *mockInbox[T]) add(build func(id string) T) T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	m := build(strconv.Itoa(b.seq))
+	b.messages = append(b.messages, m)
+	if n := len(b.messages) - mockInboxMaxMessages; n > 0 {
+		b.messages = append([]T(nil), b.messages[n:]...)
+	}
+	return m
+}
+
+// list 返回 match 为 true 的消息（match 为 nil 时为全部）。
+func (b *mockInbox[T]) list(match func(T) bool) []T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]T, 0, len(b.messages))
+	for _, m := range b.messages {
+		if match == nil || match(m) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func (b *mockInbox[T]) clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = nil
+}
+
+// handleInbox 注册收件箱 API：GET /messages 列出、DELETE /messages 清空、GET /messages/latest 取最新一条（无消息时 404）；
+// filter 由查询参数构造过滤条件（返回 nil 表示不过滤）。
+func handleInbox[T any](mux *http.ServeMux, inbox *mockInbox[T], filter func(r *http.Request) func(T) bool) {
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeMockJSON(w, http.StatusOK, map[string]interface{}{"messages": inbox.list(filter(r))})
+		case http.MethodDelete:
+			inbox.clear()
+			writeMockJSON(w, http.StatusOK, map[string]bool{"ok": true})
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/messages/latest", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		list := inbox.list(filter(r))
+		if len(list) == 0 {
+			writeMockJSON(w, http.StatusNotFound, map[string]interface{}{"ok": false, "error": "no messages"})
+			return
+		}
+		writeMockJSON(w, http.StatusOK, list[len(list)-1])
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, http.StatusOK, map[string]bool{"ok": true})
+	})
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// runMockServer 在 addr 上运行 handler，直到收到中断信号后优雅退出。
+func runMockServer(name, addr string, handler http.Handler) error {
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	errCh := make(chan error, 1)
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- err
+		}
+	}()
+	fmt.Printf("%s: http://localhost%s/messages\n", name, addr)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("%s: %w", name, err)
+	case <-sigCh:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
@@ -0,0 +1,133 @@
+// Package main: Stargate PASSWORDS builder — hash local passwords into a non-plaintext PASSWORDS value (/api/passwords, /passwords/apply).
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultPasswordAlgorithm 为 PASSWORDS 构建器的默认算法；bcrypt 哈希中的 $ 由 composegen.FormatDotEnvValue 引用，写入 .env 后不会被替换。
+const defaultPasswordAlgorithm = "bcrypt"
+
+// maxPasswords 为单次构建的密码数上限。
+const maxPasswords = 32
+
+// passwordHashers 为 Stargate PASSWORDS 支持的非明文算法（<algorithm>:<hash1>|<hash2>）到哈希函数的映射。
+var passwordHashers = map[string]func(password string) (string, error){
+	"bcrypt": func(p string) (string, error) {
+		h, err := bcrypt.GenerateFromPassword([]byte(p), bcrypt.DefaultCost)
+		return string(h), err
+	},
+	"sha512": func(p string) (string, error) {
+		sum := sha512.Sum512([]byte(p))
+		return hex.EncodeToString(sum[:]), nil
+	},
+	"md5": func(p string) (string, error) {
+		sum := md5.Sum([]byte(p))
+		return hex.EncodeToString(sum[:]), nil
+	},
+}
+
+// buildPasswordsValue 将 passwords 按 algorithm 哈希为 PASSWORDS 值；algorithm 为空时使用 defaultPasswordAlgorithm。
+// 密码不能为空、不能含 | 或换行（PASSWORDS 分隔符），bcrypt 时不超过 72 字节。
+func buildPasswordsValue(algorithm string, passwords []string) (string, error) {
+	algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+	if algorithm == "" {
+		algorithm = defaultPasswordAlgorithm
+	}
+	hash, ok := passwordHashers[algorithm]
+	if !ok {
+		return "", fmt.Errorf("unsupported algorithm %q (bcrypt, sha512, md5)", algorithm)
+	}
+	if len(passwords) == 0 {
+		return "", fmt.Errorf("at least one password is required")
+	}
+	if len(passwords) > maxPasswords {
+		return "", fmt.Errorf("too many passwords (max %d)", maxPasswords)
+	}
+	hashes := make([]string, 0, len(passwords))
+	for i, p := range passwords {
+		switch {
+		case p == "":
+			return "", fmt.Errorf("password %d is empty", i+1)
+		case strings.ContainsAny(p, "|\r\n"):
+			return "", fmt.Errorf("password %d must not contain | or line breaks", i+1)
+		case algorithm == "bcrypt" && len(p) > 72:
+			return "", fmt.Errorf("password %d is longer than 72 bytes (bcrypt limit)", i+1)
+		}
+		h, err := hash(p)
+		if err != nil {
+			return "", fmt.Errorf("hash password %d: %w", i+1, err)
+		}
+		hashes = append(hashes, h)
+	}
+	return algorithm + ":" + strings.Join(hashes, "|"), nil
+}
+
+// passwordsRequest 为 /api/passwords 与 /passwords/apply 的请求体。
+type passwordsRequest struct {
+	Algorithm string   `json:"algorithm"`
+	Passwords []string `json:"passwords"`
+}
+
+// decodePasswordsRequest 解析请求并构建 PASSWORDS 值；失败时已写入错误响应并返回 false。
+func decodePasswordsRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return "", false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxGenerateBodyBytes)
+	var req passwordsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return "", false
+	}
+	value, err := buildPasswordsValue(req.Algorithm, req.Passwords)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return value, true
+}
+
+func writePasswordsResponse(w http.ResponseWriter, value string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(map[string]string{"env": "PASSWORDS", "value": value})
+}
+
+// handlePasswordsAPI 返回哈希后的 PASSWORDS 值（无状态，供脚本与 profile 使用）。
+func handlePasswordsAPI(w http.ResponseWriter, r *http.Request) {
+	value, ok := decodePasswordsRequest(w, r)
+	if !ok {
+		return
+	}
+	writePasswordsResponse(w, value)
+}
+
+// handlePasswordsApply 构建 PASSWORDS 并写入会话 EnvOverrides；同时移除 KeysOverrides 中的 PASSWORDS，避免被「密钥生成」的值覆盖。
+func handlePasswordsApply(w http.ResponseWriter, r *http.Request) {
+	sess, ok := GetSession(r.Context())
+	if !ok || sess == nil {
+		http.Error(w, "session required", http.StatusBadRequest)
+		return
+	}
+	value, ok := decodePasswordsRequest(w, r)
+	if !ok {
+		return
+	}
+	if sess.EnvOverrides == nil {
+		sess.EnvOverrides = make(map[string]string)
+	}
+	sess.EnvOverrides["PASSWORDS"] = value
+	delete(sess.KeysOverrides, "PASSWORDS")
+	SaveSession(r.Context(), sess)
+	writePasswordsResponse(w, value)
+}
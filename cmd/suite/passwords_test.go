@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestBuildPasswordsValue 确保各算法输出 <algorithm>:<hash1>|<hash2>，默认 bcrypt 且哈希可校验原密码。
+func TestBuildPasswordsValue(t *testing.T) {
+	v, err := buildPasswordsValue("", []string{"first-pass", "second-pass"})
+	if err != nil {
+		t.Fatalf("buildPasswordsValue: %v", err)
+	}
+	hashes, ok := strings.CutPrefix(v, "bcrypt:")
+	if !ok {
+		t.Fatalf("value = %q, want bcrypt: prefix", v)
+	}
+	parts := strings.Split(hashes, "|")
+	if len(parts) != 2 {
+		t.Fatalf("value = %q, want two hashes", v)
+	}
+	for i, p := range []string{"first-pass", "second-pass"} {
+		if err := bcrypt.CompareHashAndPassword([]byte(parts[i]), []byte(p)); err != nil {
+			t.Errorf("hash %d does not match: %v", i+1, err)
+		}
+	}
+
+	v, err = buildPasswordsValue(" SHA512 ", []string{"pw"})
+	sum := sha512.Sum512([]byte("pw"))
+	if err != nil || v != "sha512:"+hex.EncodeToString(sum[:]) {
+		t.Errorf("sha512 = %q, %v", v, err)
+	}
+	if v, err := buildPasswordsValue("md5", []string{"pw"}); err != nil || !strings.HasPrefix(v, "md5:") || len(v) != len("md5:")+32 {
+		t.Errorf("md5 = %q, %v", v, err)
+	}
+}
+
+// TestBuildPasswordsValueErrors 确保不支持的算法、空列表、超出上限、空密码、含分隔符以及超出 bcrypt 72 字节限制的密码均被拒绝。
+func TestBuildPasswordsValueErrors(t *testing.T) {
+	tooMany := make([]string, maxPasswords+1)
+	for i := range tooMany {
+		tooMany[i] = "pw"
+	}
+	for name, c := range map[string]struct {
+		algorithm string
+		passwords []string
+		want      string
+	}{
+		"plaintext":    {"plaintext", []string{"pw"}, "unsupported algorithm"},
+		"none":         {"bcrypt", nil, "at least one password"},
+		"too many":     {"sha512", tooMany, "too many passwords"},
+		"empty":        {"sha512", []string{"pw", ""}, "password 2 is empty"},
+		"separator":    {"sha512", []string{"a|b"}, "must not contain |"},
+		"line break":   {"md5", []string{"a\nb"}, "must not contain |"},
+		"bcrypt limit": {"bcrypt", []string{strings.Repeat("x", 73)}, "longer than 72 bytes"},
+	} {
+		if _, err := buildPasswordsValue(c.algorithm, c.passwords); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: err = %v, want %q", name, err, c.want)
+		}
+	}
+	if _, err := buildPasswordsValue("sha512", []string{strings.Repeat("x", 73)}); err != nil {
+		t.Errorf("72-byte limit applies to bcrypt only: %v", err)
+	}
+}
+
+// TestHandlePasswordsAPI 确保 /api/passwords 返回 PASSWORDS 值，校验失败时返回 400，非 POST 返回 405。
+func TestHandlePasswordsAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handlePasswordsAPI(rec, httptest.NewRequest(http.MethodPost, "/api/passwords", strings.NewReader(`{"algorithm":"sha512","passwords":["pw"]}`)))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"value":"sha512:`) || strings.Contains(rec.Body.String(), `"pw"`) {
+		t.Errorf("POST = %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	handlePasswordsAPI(rec, httptest.NewRequest(http.MethodPost, "/api/passwords", strings.NewReader(`{"passwords":[]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty list = %d, want 400", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handlePasswordsAPI(rec, httptest.NewRequest(http.MethodGet, "/api/passwords", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,329 @@
+// Package main: versioned suite profile (export/import of wizard state, replay via gen -profile).
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/soulteary/the-gate/internal/composegen"
+	"gopkg.in/yaml.v3"
+)
+
+// profileKind 标识 suite profile 文件；profileSchemaVersion 为当前 schema 版本，结构变化时递增并在 profileUpgrades 中补一步升级。
+const (
+	profileKind          = "stargate-suite/profile"
+	profileSchemaVersion = 1
+)
+
+// suiteProfile 为可提交到 git 的部署答案：与 SessionData 的 Modes/Options/EnvOverrides/KeysOverrides 对应，
+// 可选 Scene 引用 config/scenarios.json 中的预设，profile 中的值覆盖预设。
+type suiteProfile struct {
+	Kind          string                 `json:"kind" yaml:"kind"`
+	Version       int                    `json:"version" yaml:"version"`
+	Scene         string                 `json:"scene,omitempty" yaml:"scene,omitempty"`
+	Modes         []string               `json:"modes,omitempty" yaml:"modes,omitempty"`
+	Options       map[string]interface{} `json:"options,omitempty" yaml:"options,omitempty"`
+	EnvOverrides  map[string]string      `json:"envOverrides,omitempty" yaml:"envOverrides,omitempty"`
+	KeysOverrides map[string]string      `json:"keysOverrides,omitempty" yaml:"keysOverrides,omitempty"`
+}
+
+// profileUpgrades[v] 将 version v 的原始文档升级到 v+1；读取时按版本依次执行，直到 profileSchemaVersion。
+var profileUpgrades = map[int]func(doc map[string]interface{}) error{
+	0: upgradeProfileV0,
+}
+
+// legacyOptionKeys 为 scenarios.json 风格的 option 键到 Web UI 键的映射，升级与展开场景时统一为后者。
+var legacyOptionKeys = map[string]string{
+	"includeDingTalk":                "dingtalkEnabled",
+	"includeSmtp":                    "smtpEnabled",
+	"useOwlmailForSmtp":              "smtpUseOwlmail",
+	"includeTotp":                    "totpEnabled",
+	"stargateSessionRedisUseBuiltin": "sessionStorageRedisUseBuiltin",
+}
+
+// upgradeProfileV0 处理无 version 的旧文档：会话 JSON 转储（含 expiresAt/importApplied）或 /api/generate 请求体
+// （options.envOverrides、envOverride 文本），统一为 v1 结构并规范 option 键名。
+func upgradeProfileV0(doc map[string]interface{}) error {
+	delete(doc, "expiresAt")
+	delete(doc, "importApplied")
+	env, _ := doc["envOverrides"].(map[string]interface{})
+	if env == nil {
+		env = make(map[string]interface{})
+	}
+	if opts, ok := doc["options"].(map[string]interface{}); ok {
+		if nested, ok := opts["envOverrides"].(map[string]interface{}); ok {
+			for k, v := range nested {
+				if _, exists := env[k]; !exists {
+					env[k] = v
+				}
+			}
+			delete(opts, "envOverrides")
+		}
+		normalizeOptionKeys(opts)
+	}
+	if body, ok := doc["envOverride"].(string); ok {
+		vars, err := composegen.ParseDotEnv(body)
+		if err != nil {
+			return fmt.Errorf("envOverride: %w", err)
+		}
+		for k, v := range vars {
+			if _, exists := env[k]; !exists {
+				env[k] = v
+			}
+		}
+		delete(doc, "envOverride")
+	}
+	if len(env) > 0 {
+		doc["envOverrides"] = env
+	}
+	doc["kind"] = profileKind
+	return nil
+}
+
+// normalizeOptionKeys 将 legacyOptionKeys 中的旧键改写为 Web UI 键；两者同时存在时保留 Web UI 键的值。
+func normalizeOptionKeys(opts map[string]interface{}) {
+	for legacy, key := range legacyOptionKeys {
+		v, ok := opts[legacy]
+		if !ok {
+			continue
+		}
+		delete(opts, legacy)
+		if _, exists := opts[key]; !exists {
+			opts[key] = v
+		}
+	}
+}
+
+// parseProfile 解析 YAML 或 JSON profile，按 profileUpgrades 升级到当前版本；高于当前版本的文件直接报错。
+func parseProfile(data []byte) (*suiteProfile, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse profile: %w", err)
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("parse profile: empty document")
+	}
+	if kind, ok := doc["kind"].(string); ok && kind != profileKind {
+		return nil, fmt.Errorf("parse profile: unexpected kind %q (want %q)", kind, profileKind)
+	}
+	version := 0
+	if v, ok := doc["version"]; ok {
+		n, ok := v.(int)
+		if !ok {
+			return nil, fmt.Errorf("parse profile: version must be an integer, got %v", v)
+		}
+		version = n
+	}
+	if version > profileSchemaVersion {
+		return nil, fmt.Errorf("profile version %d is newer than supported version %d; upgrade stargate-suite", version, profileSchemaVersion)
+	}
+	for ; version < profileSchemaVersion; version++ {
+		upgrade, ok := profileUpgrades[version]
+		if !ok {
+			return nil, fmt.Errorf("parse profile: no upgrade path from version %d", version)
+		}
+		if err := upgrade(doc); err != nil {
+			return nil, fmt.Errorf("upgrade profile from version %d: %w", version, err)
+		}
+	}
+	doc["kind"] = profileKind
+	doc["version"] = profileSchemaVersion
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("parse profile: %w", err)
+	}
+	var p suiteProfile
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("parse profile: %w", err)
+	}
+	return &p, nil
+}
+
+// loadProfile 读取并解析 profile 文件。
+func loadProfile(path string) (*suiteProfile, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read profile: %w", err)
+	}
+	p, err := parseProfile(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// marshalProfile 按 format（yaml 或 json）序列化；map 键有序，便于在 git 中比较差异。
+func marshalProfile(p *suiteProfile, format string) ([]byte, error) {
+	if format == "json" {
+		b, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# stargate-suite profile; regenerate with: go run ./cmd/suite gen -profile <this file>\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(p); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sessionToProfile 将会话导出为当前版本 profile；includeKeys 为 false 时不导出 KeysOverrides（密钥不宜提交到 git）。
+func sessionToProfile(sess *SessionData, includeKeys bool) *suiteProfile {
+	p := &suiteProfile{Kind: profileKind, Version: profileSchemaVersion}
+	if sess == nil {
+		return p
+	}
+	p.Modes = append([]string(nil), sess.Modes...)
+	if len(sess.Options) > 0 {
+		p.Options = make(map[string]interface{}, len(sess.Options))
+		for k, v := range sess.Options {
+			p.Options[k] = v
+		}
+	}
+	p.EnvOverrides = copyStringMap(sess.EnvOverrides)
+	if includeKeys {
+		p.KeysOverrides = copyStringMap(sess.KeysOverrides)
+	}
+	return p
+}
+
+// profileToSession 将 profile（已展开场景）写入会话，替换 Modes/Options/EnvOverrides/KeysOverrides。
+func profileToSession(p *suiteProfile, sess *SessionData) {
+	sess.Modes = append([]string(nil), p.Modes...)
+	sess.Options = make(map[string]interface{}, len(p.Options))
+	for k, v := range p.Options {
+		sess.Options[k] = v
+	}
+	sess.EnvOverrides = copyStringMap(p.EnvOverrides)
+	if sess.EnvOverrides == nil {
+		sess.EnvOverrides = make(map[string]string)
+	}
+	sess.KeysOverrides = copyStringMap(p.KeysOverrides)
+}
+
+// expandProfileScene 返回展开 Scene 后的 profile：场景的 modes/options/envOverrides 作为底，profile 中的值覆盖。
+func expandProfileScene(p *suiteProfile, root string) (*suiteProfile, error) {
+	out := *p
+	out.Options = make(map[string]interface{})
+	out.EnvOverrides = make(map[string]string)
+	if id := strings.TrimPrefix(strings.TrimSpace(p.Scene), "scene:"); id != "" {
+		presets, err := scenarioPresetsFor(root)
+		if err != nil {
+			return nil, err
+		}
+		scene, ok := presets[id]
+		if !ok {
+			return nil, fmt.Errorf("profile: unknown scene %q (see config/scenarios.json)", id)
+		}
+		for k, v := range scene.Options {
+			out.Options[k] = v
+		}
+		normalizeOptionKeys(out.Options)
+		for k, v := range scene.EnvOverrides {
+			out.EnvOverrides[k] = v
+		}
+		if len(out.Modes) == 0 {
+			out.Modes = append([]string(nil), scene.Modes...)
+		}
+	}
+	own := make(map[string]interface{}, len(p.Options))
+	for k, v := range p.Options {
+		own[k] = v
+	}
+	normalizeOptionKeys(own)
+	for k, v := range own {
+		out.Options[k] = v
+	}
+	for k, v := range p.EnvOverrides {
+		out.EnvOverrides[k] = v
+	}
+	return &out, nil
+}
+
+// sessionEnvBody 按会话的 EnvOverrides 与 KeysOverrides 拼出 .env 内容（键排序，后者覆盖前者），
+// 供 /generate 与 gen -profile 共用，保证两者输出一致。
+func sessionEnvBody(sess *SessionData) string {
+	var b strings.Builder
+	for _, m := range []map[string]string{sess.EnvOverrides, sess.KeysOverrides} {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b.WriteString(composegen.FormatDotEnvLine(k, m[k]) + "\n")
+		}
+	}
+	return b.String()
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// cmdProfile 将 profile 升级到当前 schema 版本并输出（-w 写回原文件），便于旧文件在 git 中一次性迁移。
+func cmdProfile() error {
+	fs := flag.NewFlagSet("profile", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	write := fs.Bool("w", false, "write the upgraded profile back to the file instead of stdout")
+	format := fs.String("format", "", "output format: yaml or json (default: by file extension)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: suite profile [-w] [-format yaml|json] <file>\n\nUpgrade a suite profile to schema version %d.\n\nFlags:\n", profileSchemaVersion)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(cmdArgs); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("profile: expected exactly one file")
+	}
+	path := fs.Arg(0)
+	p, err := loadProfile(path)
+	if err != nil {
+		return err
+	}
+	f := strings.ToLower(strings.TrimSpace(*format))
+	if f == "" {
+		f = "yaml"
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			f = "json"
+		}
+	}
+	b, err := marshalProfile(p, f)
+	if err != nil {
+		return err
+	}
+	if *write {
+		if err := writeFileAtomic(path, b, 0o600); err != nil {
+			return fmt.Errorf("write %s: %w", path, err)
+		}
+		fmt.Printf("Upgraded %s to profile version %d\n", path, profileSchemaVersion)
+		return nil
+	}
+	_, err = os.Stdout.Write(b)
+	return err
+}
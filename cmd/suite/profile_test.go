@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseProfileUpgradeSessionDump 确保无 version 的会话 JSON 转储升级为 v1：去掉 expiresAt/importApplied，旧 option 键改为 Web UI 键。
+func TestParseProfileUpgradeSessionDump(t *testing.T) {
+	p, err := parseProfile([]byte(`{
+  "modes": ["traefik"],
+  "options": {"includeDingTalk": true, "useOwlmailForSmtp": true, "exposePorts": false},
+  "envOverrides": {"AUTH_HOST": "auth.example.com"},
+  "keysOverrides": {"HERALD_API_KEY": "k"},
+  "expiresAt": "2026-01-01T00:00:00Z",
+  "importApplied": true
+}`))
+	if err != nil {
+		t.Fatalf("parseProfile: %v", err)
+	}
+	want := &suiteProfile{
+		Kind:          profileKind,
+		Version:       profileSchemaVersion,
+		Modes:         []string{"traefik"},
+		Options:       map[string]interface{}{"dingtalkEnabled": true, "smtpUseOwlmail": true, "exposePorts": false},
+		EnvOverrides:  map[string]string{"AUTH_HOST": "auth.example.com"},
+		KeysOverrides: map[string]string{"HERALD_API_KEY": "k"},
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("parseProfile =\n%#v\nwant\n%#v", p, want)
+	}
+}
+
+// TestParseProfileUpgradeGenerateBody 确保 /api/generate 请求体升级为 v1：options.envOverrides 与 envOverride 文本并入 envOverrides
+// （顶层 envOverrides 优先），旧键与 Web UI 键同时存在时保留后者。
+func TestParseProfileUpgradeGenerateBody(t *testing.T) {
+	p, err := parseProfile([]byte(`{
+  "modes": ["image"],
+  "options": {"includeSmtp": true, "smtpEnabled": false, "envOverrides": {"AUTH_HOST": "nested.example.com", "HERALD_PORT": "9082"}},
+  "envOverrides": {"AUTH_HOST": "auth.example.com"},
+  "envOverride": "AUTH_HOST=text.example.com\nSTARGATE_DOMAIN=example.com\n"
+}`))
+	if err != nil {
+		t.Fatalf("parseProfile: %v", err)
+	}
+	wantEnv := map[string]string{"AUTH_HOST": "auth.example.com", "HERALD_PORT": "9082", "STARGATE_DOMAIN": "example.com"}
+	if !reflect.DeepEqual(p.EnvOverrides, wantEnv) {
+		t.Errorf("envOverrides = %v, want %v", p.EnvOverrides, wantEnv)
+	}
+	if !reflect.DeepEqual(p.Options, map[string]interface{}{"smtpEnabled": false}) {
+		t.Errorf("options = %v, want only smtpEnabled=false", p.Options)
+	}
+	if p.Kind != profileKind || p.Version != profileSchemaVersion {
+		t.Errorf("kind/version = %q/%d", p.Kind, p.Version)
+	}
+
+	// 升级后的 profile 序列化再读取保持不变
+	for _, format := range []string{"yaml", "json"} {
+		b, err := marshalProfile(p, format)
+		if err != nil {
+			t.Fatalf("marshalProfile(%s): %v", format, err)
+		}
+		again, err := parseProfile(b)
+		if err != nil {
+			t.Fatalf("parseProfile(%s): %v", format, err)
+		}
+		if !reflect.DeepEqual(again, p) {
+			t.Errorf("%s round trip =\n%#v\nwant\n%#v", format, again, p)
+		}
+	}
+}
+
+// TestParseProfileRejects 确保版本高于当前 schema、kind 不符、version 非整数与空文档均报错。
+func TestParseProfileRejects(t *testing.T) {
+	for name, c := range map[string]struct{ doc, want string }{
+		"newer version":  {"kind: stargate-suite/profile\nversion: 2\n", "newer than supported"},
+		"wrong kind":     {"kind: example/other\nversion: 1\n", "unexpected kind"},
+		"version string": {"kind: stargate-suite/profile\nversion: one\n", "version must be an integer"},
+		"empty document": {"", "empty document"},
+		"invalid env":    {`{"envOverride": "NOT A LINE"}`, "envOverride"},
+	} {
+		if _, err := parseProfile([]byte(c.doc)); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: err = %v, want %q", name, err, c.want)
+		}
+	}
+}
@@ -35,6 +35,7 @@ type ImportApplied struct {
 	EnvVars        map[string]string `json:"envVars"`
 	SuggestedModes []string          `json:"suggestedModes"`
 	SuggestedScene string            `json:"suggestedScene"`
+	SecretIssues   []string          `json:"secretIssues,omitempty"` // 导入内容中跨服务密钥不一致项，确认页展示
 }
 
 type sessionContextKey struct{}
@@ -0,0 +1,170 @@
+// Package main: sms-sink command — local stand-in for Herald's SMS HTTP API (SMS_PROVIDER=httpapi) that keeps delivered messages in an inbox.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soulteary/cli-kit/configutil"
+)
+
+// smsSinkMaxBody 为单次发送请求体的上限。
+const smsSinkMaxBody = 64 << 10
+
+// smsMessage 为收件箱中的一条短信。
+type smsMessage struct {
+	ID         string    `json:"id"`
+	Phone      string    `json:"phone"`
+	Content    string    `json:"content"`
+	Code       string    `json:"code,omitempty"` // 请求中的验证码字段，缺失时从 content 中提取
+	Path       string    `json:"path"`
+	Body       string    `json:"body"` // 原始请求体，便于排查 Herald 的调用格式
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+// normPhone 规范化号码：去除空白、"-"、前导 "+" 与中国大陆号码的 86 区号，+86 138-0013-8000 与 13800138000 结果相同。
+func normPhone(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "+")
+	if len(s) == 13 && strings.HasPrefix(s, "86") {
+		s = s[2:]
+	}
+	return s
+}
+
+// samePhone 按 normPhone 比较号码。
+func samePhone(a, b string) bool {
+	return normPhone(a) == normPhone(b)
+}
+
+// smsPhoneFields / smsContentFields / smsCodeFields 为发送请求中可识别的字段名（按顺序取第一个非空值），
+// 兼容常见短信 HTTP API 的命名，params / data 中的同名字段同样识别。
+var (
+	smsPhoneFields   = []string{"phone", "to", "mobile", "phone_number", "phoneNumber", "destination", "receiver"}
+	smsContentFields = []string{"content", "message", "text", "body", "msg"}
+	smsCodeFields    = []string{"code", "otp", "verify_code", "verifyCode"}
+)
+
+// parseSMSRequest 从 JSON 或表单请求体中取出号码、内容与验证码。
+func parseSMSRequest(contentType string, body []byte) (phone, content, code string) {
+	fields := map[string]string{}
+	if strings.Contains(contentType, "application/x-www-form-urlencoded") {
+		if vals, err := url.ParseQuery(string(body)); err == nil {
+			for k := range vals {
+				fields[k] = vals.Get(k)
+			}
+		}
+	} else {
+		var doc map[string]interface{}
+		if json.Unmarshal(body, &doc) == nil {
+			collectSMSFields(fields, doc)
+			for _, nested := range []string{"params", "data", "template_params", "templateParams"} {
+				if m, ok := doc[nested].(map[string]interface{}); ok {
+					collectSMSFields(fields, m)
+				}
+			}
+		}
+	}
+	pick := func(keys []string) string {
+		for _, k := range keys {
+			if v := strings.TrimSpace(fields[k]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	phone, content, code = pick(smsPhoneFields), pick(smsContentFields), pick(smsCodeFields)
+	if code == "" {
+		code = verifyCodePattern.FindString(content)
+	}
+	return phone, content, code
+}
+
+// collectSMSFields 将 doc 中的字符串与数字字段写入 fields（已有的键不覆盖，顶层优先）。
+func collectSMSFields(fields map[string]string, doc map[string]interface{}) {
+	for k, v := range doc {
+		if _, ok := fields[k]; ok {
+			continue
+		}
+		switch x := v.(type) {
+		case string:
+			fields[k] = x
+		case float64:
+			fields[k] = strconv.FormatFloat(x, 'f', -1, 64)
+		}
+	}
+}
+
+// smsSinkHandler 提供收件箱 API（handleInbox，?phone= 按号码过滤）；其余路径的 POST 视为 Herald 的发送请求
+// （不限定路径与鉴权头），记录后返回 {"ok":true,"message_id":...}。
+func smsSinkHandler(inbox *mockInbox[smsMessage]) http.Handler {
+	mux := http.NewServeMux()
+	handleInbox(mux, inbox, func(r *http.Request) func(smsMessage) bool {
+		phone := r.URL.Query().Get("phone")
+		if phone == "" {
+			return nil
+		}
+		return func(m smsMessage) bool { return samePhone(m.Phone, phone) }
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, smsSinkMaxBody))
+		if err != nil {
+			writeMockJSON(w, http.StatusRequestEntityTooLarge, map[string]interface{}{"ok": false, "error": err.Error()})
+			return
+		}
+		phone, content, code := parseSMSRequest(r.Header.Get("Content-Type"), body)
+		if phone == "" {
+			writeMockJSON(w, http.StatusBadRequest, map[string]interface{}{"ok": false, "error": "missing phone number"})
+			return
+		}
+		m := inbox.add(func(id string) smsMessage {
+			return smsMessage{
+				ID:         id,
+				Phone:      phone,
+				Content:    content,
+				Code:       code,
+				Path:       r.URL.Path,
+				Body:       string(body),
+				ReceivedAt: time.Now().UTC(),
+			}
+		})
+		fmt.Printf("sms-sink: %s -> %s: %s\n", r.URL.Path, m.Phone, m.Content)
+		writeMockJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "message_id": m.ID})
+	})
+	return mux
+}
+
+func cmdSMSSink() error {
+	fs := flag.NewFlagSet("sms-sink", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.String("addr", ":8086", "listen address (env SMS_SINK_ADDR)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: suite sms-sink [-addr :8086]\n\nRuns a local SMS sink for Herald (SMS_PROVIDER=httpapi, SMS_API_BASE_URL=http://<host>:8086): send requests are stored in memory and listed at GET /messages?phone=.\n\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(cmdArgs); err != nil {
+		if err == flag.ErrHelp {
+			return nil
+		}
+		return err
+	}
+	addr := strings.TrimSpace(configutil.ResolveString(fs, "addr", "SMS_SINK_ADDR", ":8086", true))
+	return runMockServer("sms-sink", addr, smsSinkHandler(&mockInbox[smsMessage]{}))
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// TestParseSMSRequest 确保 JSON、表单与 params 等嵌套字段中的号码、内容与验证码均可识别，缺少验证码字段时从内容中提取。
+func TestParseSMSRequest(t *testing.T) {
+	cases := []struct {
+		name, contentType, body string
+		phone, content, code    string
+	}{
+		{"json", "application/json", `{"phone":"13800138000","content":"Your code is 123456","code":"123456"}`, "13800138000", "Your code is 123456", "123456"},
+		{"json aliases", "application/json; charset=utf-8", `{"mobile":"+86 138-0013-8000","message":"code 4321 expires in 5 minutes"}`, "+86 138-0013-8000", "code 4321 expires in 5 minutes", "4321"},
+		{"json numeric code", "application/json", `{"to":"13800138000","text":"hi","otp":987654}`, "13800138000", "hi", "987654"},
+		{"form", "application/x-www-form-urlencoded", "phone_number=13900139000&msg=login+code+246810", "13900139000", "login code 246810", "246810"},
+		{"nested params", "application/json", `{"phone":"13700137000","template":"SMS_001","params":{"code":"135790","content":"verify"}}`, "13700137000", "verify", "135790"},
+		{"top level wins", "application/json", `{"phone":"13700137000","code":"111111","data":{"phone":"13600136000","code":"222222"}}`, "13700137000", "", "111111"},
+		{"invalid json", "application/json", `{"phone":`, "", "", ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			phone, content, code := parseSMSRequest(c.contentType, []byte(c.body))
+			if phone != c.phone || content != c.content || code != c.code {
+				t.Errorf("parseSMSRequest = (%q, %q, %q), want (%q, %q, %q)", phone, content, code, c.phone, c.content, c.code)
+			}
+		})
+	}
+}
+
+// TestNormPhone 确保空白、"-"、"+" 与 86 区号不影响号码比较，非大陆号码的 86 前缀保留。
+func TestNormPhone(t *testing.T) {
+	for in, want := range map[string]string{
+		"13800138000":         "13800138000",
+		" +86 138-0013-8000 ": "13800138000",
+		"8613800138000":       "13800138000",
+		"+1 415-555-0100":     "14155550100",
+		"861234":              "861234",
+	} {
+		if got := normPhone(in); got != want {
+			t.Errorf("normPhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if !samePhone("+8613800138000", "138 0013 8000") || samePhone("13800138000", "13900139000") {
+		t.Error("samePhone should compare normalized numbers")
+	}
+}
+
+// TestSMSSinkHandler 确保发送请求进入收件箱，/messages 按号码过滤，/messages/latest 无消息时返回 404，DELETE /messages 清空收件箱。
+func TestSMSSinkHandler(t *testing.T) {
+	srv := httptest.NewServer(smsSinkHandler(&mockInbox[smsMessage]{}))
+	defer srv.Close()
+
+	do := func(method, path, contentType, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := do(http.MethodGet, "/messages/latest", "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("latest on empty inbox = %d, want 404", resp.StatusCode)
+	}
+	if resp := do(http.MethodPost, "/sms/send", "application/json", `{"content":"no phone"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("send without phone = %d, want 400", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/sms/send", "", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET on send path = %d, want 405", resp.StatusCode)
+	}
+	do(http.MethodPost, "/sms/send", "application/json", `{"phone":"+86 13800138000","content":"code 123456"}`)
+	do(http.MethodPost, "/v1/send", "application/x-www-form-urlencoded", "to=13900139000&text=code+654321")
+
+	var list struct {
+		Messages []smsMessage `json:"messages"`
+	}
+	resp := do(http.MethodGet, "/messages?phone="+url.QueryEscape("138-0013-8000"), "", "")
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Messages) != 1 || list.Messages[0].Code != "123456" || list.Messages[0].Path != "/sms/send" {
+		t.Errorf("messages for 13800138000 = %+v", list.Messages)
+	}
+
+	var latest smsMessage
+	resp = do(http.MethodGet, "/messages/latest", "", "")
+	if err := json.NewDecoder(resp.Body).Decode(&latest); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || latest.Phone != "13900139000" || latest.Code != "654321" {
+		t.Errorf("latest = %d %+v", resp.StatusCode, latest)
+	}
+	if resp := do(http.MethodGet, "/messages/latest?phone=13700137000", "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("latest for unknown phone = %d, want 404", resp.StatusCode)
+	}
+
+	if resp := do(http.MethodDelete, "/messages", "", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("DELETE /messages = %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/messages/latest", "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("latest after DELETE = %d, want 404", resp.StatusCode)
+	}
+}
+
+// TestMockInboxLimit 确保收件箱超出 mockInboxMaxMessages 时丢弃最早的消息，ID 继续递增。
+func TestMockInboxLimit(t *testing.T) {
+	var inbox mockInbox[string]
+	for i := 0; i < mockInboxMaxMessages+5; i++ {
+		inbox.add(func(id string) string { return id })
+	}
+	all := inbox.list(nil)
+	if len(all) != mockInboxMaxMessages || all[0] != "6" || all[len(all)-1] != "1005" {
+		t.Errorf("inbox holds %d messages from %s to %s", len(all), all[0], all[len(all)-1])
+	}
+}
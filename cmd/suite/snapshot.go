@@ -0,0 +1,231 @@
+// Package main: serve 的配置快照（canonical compose、mode 定义、env-meta、页面配置、场景、i18n），按文件变更热加载。
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/soulteary/the-gate/internal/composegen"
+	"gopkg.in/yaml.v3"
+)
+
+// snapshotPollInterval 为 serve 检查配置文件变更的间隔。
+const snapshotPollInterval = 2 * time.Second
+
+// serveSnapshot 为 serve 各请求共享的只读配置，整体替换、不原地修改。
+type serveSnapshot struct {
+	Source    *composegen.Source
+	EnvMeta   *composegen.EnvMeta
+	Page      *pageData
+	Scenarios map[string]scenarioPreset
+	LoadedAt  time.Time
+}
+
+// SecretKeys 返回 keys-step 中的变量名，作为 composegen.Options.SecretKeys（同 loadKeysStepEnvKeys）。
+func (s *serveSnapshot) SecretKeys() []string {
+	if len(s.Page.KeysStepVars) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(s.Page.KeysStepVars))
+	for _, v := range s.Page.KeysStepVars {
+		keys = append(keys, v.Env)
+	}
+	return keys
+}
+
+// snapshotStore 持有 serve 的当前快照：poll 按修改时间与大小检查 watchedFiles，有变更时重新加载，
+// 成功则原子替换，失败则保留上一份可用快照并记录错误（stderr 与 /api/snapshot）。
+type snapshotStore struct {
+	root     string
+	pagePath string
+	current  atomic.Pointer[serveSnapshot]
+
+	mu      sync.Mutex // 保护 stamp、lastErr
+	stamp   string
+	lastErr error
+}
+
+// serveSnapshots 在 serve 启动后设置；CLI 命令中为 nil，相关函数回退为从磁盘读取。
+var serveSnapshots *snapshotStore
+
+// newSnapshotStore 加载首份快照；失败时返回错误（serve 无法启动）。
+func newSnapshotStore(root, pagePath string) (*snapshotStore, error) {
+	s := &snapshotStore{root: root, pagePath: pagePath}
+	s.stamp = s.fingerprint()
+	snap, err := loadServeSnapshot(root, pagePath)
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(snap)
+	return s, nil
+}
+
+// Load 返回当前快照。
+func (s *snapshotStore) Load() *serveSnapshot {
+	return s.current.Load()
+}
+
+// watchedFiles 为快照依赖的文件；page.yaml 的拆分文件与 i18n 取 page.yaml 所在目录。
+func (s *snapshotStore) watchedFiles() []string {
+	configDir := filepath.Dir(s.pagePath)
+	return []string{
+		filepath.Join(s.root, canonicalCompose),
+		filepath.Join(s.root, modesYAMLPath),
+		filepath.Join(s.root, "config", "env-meta.yaml"),
+		filepath.Join(s.root, "config", "scenarios.json"),
+		s.pagePath,
+		filepath.Join(configDir, "config-sections.yaml"),
+		filepath.Join(configDir, "services.yaml"),
+		filepath.Join(configDir, "providers.yaml"),
+		filepath.Join(configDir, "keys-step.yaml"),
+		filepath.Join(configDir, "i18n", "zh.yaml"),
+		filepath.Join(configDir, "i18n", "en.yaml"),
+	}
+}
+
+// fingerprint 汇总 watchedFiles 的修改时间与大小（缺失的文件记为 -），任一变化即视为需要重新加载。
+func (s *snapshotStore) fingerprint() string {
+	var b strings.Builder
+	for _, path := range s.watchedFiles() {
+		b.WriteString(path)
+		if fi, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, ":%d:%d\n", fi.ModTime().UnixNano(), fi.Size())
+		} else {
+			b.WriteString(":-\n")
+		}
+	}
+	return b.String()
+}
+
+// poll 检查一次文件变更，有变更时重新加载；返回是否替换了快照。
+func (s *snapshotStore) poll() bool {
+	stamp := s.fingerprint()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stamp == s.stamp {
+		return false
+	}
+	s.stamp = stamp
+	snap, err := loadServeSnapshot(s.root, s.pagePath)
+	if err != nil {
+		s.lastErr = err
+		fmt.Fprintf(os.Stderr, "config reload failed, keeping snapshot from %s: %v\n", s.Load().LoadedAt.Format(time.RFC3339), err)
+		return false
+	}
+	s.lastErr = nil
+	s.current.Store(snap)
+	fmt.Fprintf(os.Stderr, "config reloaded\n")
+	return true
+}
+
+// watch 每隔 interval 调用 poll，直到 stop 关闭。
+func (s *snapshotStore) watch(interval time.Duration, stop <-chan struct{}) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			s.poll()
+		}
+	}
+}
+
+// snapshotStatus 为 /api/snapshot 响应体：当前快照的加载时间，以及最近一次重新加载失败的原因（成功后清空）。
+type snapshotStatus struct {
+	LoadedAt time.Time `json:"loadedAt"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func (s *snapshotStore) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := snapshotStatus{LoadedAt: s.Load().LoadedAt}
+	s.mu.Lock()
+	if s.lastErr != nil {
+		status.Error = s.lastErr.Error()
+	}
+	s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// loadServeSnapshot 从磁盘加载一份完整快照。loadPageData 对拆分文件与 scenarios 的解析错误是宽松的（回退为空），
+// 这里先逐个检查语法，避免编辑中的无效文件被当作「空配置」替换上线。
+func loadServeSnapshot(root, pagePath string) (*serveSnapshot, error) {
+	src, err := composegen.LoadSource(filepath.Join(root, canonicalCompose))
+	if err != nil {
+		return nil, fmt.Errorf("load compose: %w", err)
+	}
+	if src.Modes, err = loadModeDefs(root); err != nil {
+		return nil, err
+	}
+	if src.Providers, err = loadProviders(root); err != nil {
+		return nil, err
+	}
+	meta, err := composegen.LoadEnvMeta(filepath.Join(root, "config", "env-meta.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	configDir := filepath.Dir(pagePath)
+	for _, name := range []string{"config-sections.yaml", "services.yaml", "providers.yaml", "keys-step.yaml", "i18n/zh.yaml", "i18n/en.yaml"} {
+		if err := checkYAMLSyntax(filepath.Join(configDir, filepath.FromSlash(name))); err != nil {
+			return nil, err
+		}
+	}
+	page, err := loadPageData(pagePath)
+	if err != nil {
+		return nil, fmt.Errorf("load page config: %w", err)
+	}
+	scenarios, err := loadScenarioPresets(root)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		scenarios = map[string]scenarioPreset{}
+	}
+	return &serveSnapshot{Source: src, EnvMeta: meta, Page: page, Scenarios: scenarios, LoadedAt: time.Now()}, nil
+}
+
+// checkYAMLSyntax 检查可选配置文件的 YAML 语法；文件不存在时不报错。
+func checkYAMLSyntax(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// snapshotFor 返回 serve 的当前快照；未运行 serve 或 root 不同时从 root 加载一份。
+func snapshotFor(root string) (*serveSnapshot, error) {
+	if s := serveSnapshots; s != nil && s.root == root {
+		return s.Load(), nil
+	}
+	return loadServeSnapshot(root, filepath.Join(root, pageYAMLPath))
+}
+
+// scenarioPresetsFor 返回场景预设：serve 运行中取快照，否则读取 config/scenarios.json。
+func scenarioPresetsFor(root string) (map[string]scenarioPreset, error) {
+	if s := serveSnapshots; s != nil && s.root == root {
+		return s.Load().Scenarios, nil
+	}
+	return loadScenarioPresets(root)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copySnapshotRoot 将快照依赖的 compose/canonical 与 config/ 复制到临时目录，返回新的项目根目录。
+func copySnapshotRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	for _, dir := range []string{"config", filepath.Join("compose", "canonical")} {
+		if err := os.CopyFS(filepath.Join(root, dir), os.DirFS(filepath.Join("..", "..", dir))); err != nil {
+			t.Fatalf("copy %s: %v", dir, err)
+		}
+	}
+	return root
+}
+
+// snapshotStatusOf 调用 /api/snapshot 并返回响应体。
+func snapshotStatusOf(t *testing.T, s *snapshotStore) snapshotStatus {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.handleStatus(rec, httptest.NewRequest(http.MethodGet, "/api/snapshot", nil))
+	var status snapshotStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("decode /api/snapshot: %v", err)
+	}
+	return status
+}
+
+// TestSnapshotStorePoll 确保 modes.yaml 或 page.yaml 写坏时 poll 返回 false、保留上一份快照并在 /api/snapshot 报告错误，
+// 修复后 poll 替换快照并清空错误；文件未变时不重新加载。
+func TestSnapshotStorePoll(t *testing.T) {
+	root := copySnapshotRoot(t)
+	s, err := newSnapshotStore(root, filepath.Join(root, pageYAMLPath))
+	if err != nil {
+		t.Fatalf("newSnapshotStore: %v", err)
+	}
+	if s.poll() {
+		t.Error("poll without changes should not reload")
+	}
+
+	for _, rel := range []string{modesYAMLPath, pageYAMLPath} {
+		path := filepath.Join(root, rel)
+		good, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		before := s.Load()
+
+		if err := os.WriteFile(path, []byte("modes: [\n  broken: {"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if s.poll() {
+			t.Errorf("%s: poll with a broken file should not swap the snapshot", rel)
+		}
+		if s.Load() != before {
+			t.Errorf("%s: Load() changed after a failed reload", rel)
+		}
+		if status := snapshotStatusOf(t, s); !strings.Contains(status.Error, "yaml") {
+			t.Errorf("%s: /api/snapshot error = %q, want the reload failure", rel, status.Error)
+		}
+
+		if err := os.WriteFile(path, good, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if !s.poll() {
+			t.Errorf("%s: poll after fixing the file should swap the snapshot", rel)
+		}
+		if s.Load() == before {
+			t.Errorf("%s: Load() still returns the old snapshot", rel)
+		}
+		if status := snapshotStatusOf(t, s); status.Error != "" {
+			t.Errorf("%s: /api/snapshot error = %q after a successful reload", rel, status.Error)
+		}
+	}
+}
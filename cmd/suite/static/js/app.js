@@ -5,19 +5,22 @@
   var scenarioExtraOptions = {};
   var DEFAULT_GENERATE_MODES = ['traefik'];
   var KEY_DEFINITIONS = [
-    { env: 'WARDEN_API_KEY', labelKey: 'keyLabelWardenApiKey', descKey: 'keyDescWardenApiKey', genType: 'apiKey' },
-    { env: 'WARDEN_OTP_SECRET_KEY', labelKey: 'keyLabelWardenOtpSecretKey', descKey: 'keyDescWardenOtpSecretKey', genType: 'apiKey' },
-    { env: 'HERALD_API_KEY', labelKey: 'keyLabelHeraldApiKey', descKey: 'keyDescHeraldApiKey', genType: 'apiKey' },
-    { env: 'HERALD_HMAC_SECRET', labelKey: 'keyLabelHeraldHmacSecret', descKey: 'keyDescHeraldHmacSecret', genType: 'hmacSecret' },
-    { env: 'HERALD_HMAC_KEYS', labelKey: 'keyLabelHeraldHmacKeys', descKey: 'keyDescHeraldHmacKeys', genType: 'hmacKeys' },
-    { env: 'HERALD_TOTP_API_KEY', labelKey: 'keyLabelHeraldTotpApiKey', descKey: 'keyDescHeraldTotpApiKey', genType: 'apiKey' },
-    { env: 'HERALD_TOTP_HMAC_SECRET', labelKey: 'keyLabelHeraldTotpHmacSecret', descKey: 'keyDescHeraldTotpHmacSecret', genType: 'hmacSecret' },
-    { env: 'HERALD_TOTP_ENCRYPTION_KEY', labelKey: 'keyLabelHeraldTotpEncryptionKey', descKey: 'keyDescHeraldTotpEncryptionKey', genType: 'aes32' },
-    { env: 'WARDEN_REDIS_PASSWORD', labelKey: 'keyLabelWardenRedisPassword', descKey: 'keyDescWardenRedisPassword', genType: 'password' },
-    { env: 'HERALD_REDIS_PASSWORD', labelKey: 'keyLabelHeraldRedisPassword', descKey: 'keyDescHeraldRedisPassword', genType: 'password' },
-    { env: 'SESSION_STORAGE_REDIS_PASSWORD', labelKey: 'keyLabelSessionRedisPassword', descKey: 'keyDescSessionRedisPassword', genType: 'password' },
-    { env: 'HERALD_DINGTALK_API_KEY', labelKey: 'keyLabelHeraldDingtalkApiKey', descKey: 'keyDescHeraldDingtalkApiKey', genType: 'apiKey' },
-    { env: 'HERALD_SMTP_API_KEY', labelKey: 'keyLabelHeraldSmtpApiKey', descKey: 'keyDescHeraldSmtpApiKey', genType: 'apiKey' }
+    { env: 'WARDEN_API_KEY', labelKey: 'keyLabelWardenApiKey', descKey: 'keyDescWardenApiKey' },
+    { env: 'WARDEN_OTP_SECRET_KEY', labelKey: 'keyLabelWardenOtpSecretKey', descKey: 'keyDescWardenOtpSecretKey' },
+    { env: 'HERALD_API_KEY', labelKey: 'keyLabelHeraldApiKey', descKey: 'keyDescHeraldApiKey' },
+    { env: 'HERALD_HMAC_SECRET', labelKey: 'keyLabelHeraldHmacSecret', descKey: 'keyDescHeraldHmacSecret' },
+    { env: 'HERALD_HMAC_KEYS', labelKey: 'keyLabelHeraldHmacKeys', descKey: 'keyDescHeraldHmacKeys' },
+    { env: 'HERALD_TOTP_API_KEY', labelKey: 'keyLabelHeraldTotpApiKey', descKey: 'keyDescHeraldTotpApiKey' },
+    { env: 'HERALD_TOTP_HMAC_SECRET', labelKey: 'keyLabelHeraldTotpHmacSecret', descKey: 'keyDescHeraldTotpHmacSecret' },
+    { env: 'HERALD_TOTP_ENCRYPTION_KEY', labelKey: 'keyLabelHeraldTotpEncryptionKey', descKey: 'keyDescHeraldTotpEncryptionKey' },
+    { env: 'PASSWORDS', labelKey: 'keyLabelPasswords', descKey: 'keyDescPasswords' },
+    { env: 'WARDEN_HMAC_KEYS', labelKey: 'keyLabelWardenHmacKeys', descKey: 'keyDescWardenHmacKeys' },
+    { env: 'WARDEN_REDIS_PASSWORD', labelKey: 'keyLabelWardenRedisPassword', descKey: 'keyDescWardenRedisPassword' },
+    { env: 'HERALD_REDIS_PASSWORD', labelKey: 'keyLabelHeraldRedisPassword', descKey: 'keyDescHeraldRedisPassword' },
+    { env: 'SESSION_STORAGE_REDIS_PASSWORD', labelKey: 'keyLabelSessionRedisPassword', descKey: 'keyDescSessionRedisPassword' },
+    { env: 'HERALD_TOTP_REDIS_PASSWORD', labelKey: 'keyLabelHeraldTotpRedisPassword', descKey: 'keyDescHeraldTotpRedisPassword' },
+    { env: 'HERALD_DINGTALK_API_KEY', labelKey: 'keyLabelHeraldDingtalkApiKey', descKey: 'keyDescHeraldDingtalkApiKey' },
+    { env: 'HERALD_SMTP_API_KEY', labelKey: 'keyLabelHeraldSmtpApiKey', descKey: 'keyDescHeraldSmtpApiKey' }
   ];
 
   function q(selector, root) {
@@ -34,6 +37,11 @@
     return div.innerHTML;
   }
 
+  // 与 composegen.OutputFileName 一致：k8s 模式输出 k8s.yaml，其余为 docker-compose.yml
+  function outputFileName(mode, composeLabel) {
+    return mode === 'k8s' ? 'k8s.yaml' : (composeLabel || 'docker-compose.yml');
+  }
+
   function getI18N(lang) {
     var dict = window.I18N || {};
     return dict[lang] || dict.zh || {};
@@ -451,17 +459,28 @@
       var url = URL.createObjectURL(blob);
       var link = document.createElement('a');
       link.href = url;
-      link.download = mode + '/docker-compose.yml';
-      link.textContent = mode + '/docker-compose.yml';
+      link.download = mode + '/' + outputFileName(mode);
+      link.textContent = mode + '/' + outputFileName(mode);
       downloadsEl.appendChild(link);
+      // 每个 mode 的 .env 仅含其服务引用的变量
+      var envLink = document.createElement('a');
+      envLink.href = URL.createObjectURL(new Blob([envFor(data, mode)], { type: 'text/plain;charset=utf-8' }));
+      envLink.download = mode + '/.env';
+      envLink.textContent = mode + '/.env';
+      downloadsEl.appendChild(envLink);
+      var files = (data.files || {})[mode] || {};
+      Object.keys(files).sort().forEach(function (rel) {
+        var fileLink = document.createElement('a');
+        fileLink.href = URL.createObjectURL(new Blob([files[rel]], { type: 'text/plain;charset=utf-8' }));
+        fileLink.download = mode + '/' + rel;
+        fileLink.textContent = mode + '/' + rel;
+        downloadsEl.appendChild(fileLink);
+      });
     });
-    var envBlob = new Blob([data.env || ''], { type: 'text/plain;charset=utf-8' });
-    var envUrl = URL.createObjectURL(envBlob);
-    var envLink = document.createElement('a');
-    envLink.href = envUrl;
-    envLink.download = '.env';
-    envLink.textContent = '.env';
-    downloadsEl.appendChild(envLink);
+  }
+
+  function envFor(data, mode) {
+    return (data.envs || {})[mode] || data.env || '';
   }
 
   function renderPreview(data) {
@@ -477,24 +496,23 @@
 
     Object.keys(data.composes || {}).forEach(function (mode) {
       html += '<div class="preview-block">' +
-        '<p class="preview-title"><strong>' + escapeHtml(mode + '/' + composeLabel) + '</strong></p>' +
+        '<p class="preview-title"><strong>' + escapeHtml(mode + '/' + outputFileName(mode, composeLabel)) + '</strong></p>' +
         '<div class="preview-actions">' +
         '<button type="button" class="preview-select">' + escapeHtml(selectText) + '</button>' +
         '<button type="button" class="preview-copy">' + escapeHtml(copyText) + '</button>' +
         '</div>' +
         '<pre>' + escapeHtml(data.composes[mode]) + '</pre>' +
         '</div>';
+      html += '<div class="preview-block">' +
+        '<p class="preview-title"><strong>' + escapeHtml(mode + '/' + envLabel) + '</strong></p>' +
+        '<div class="preview-actions">' +
+        '<button type="button" class="preview-select">' + escapeHtml(selectText) + '</button>' +
+        '<button type="button" class="preview-copy">' + escapeHtml(copyText) + '</button>' +
+        '</div>' +
+        '<pre>' + escapeHtml(envFor(data, mode)) + '</pre>' +
+        '</div>';
     });
 
-    html += '<div class="preview-block">' +
-      '<p class="preview-title"><strong>' + escapeHtml(envLabel) + '</strong></p>' +
-      '<div class="preview-actions">' +
-      '<button type="button" class="preview-select">' + escapeHtml(selectText) + '</button>' +
-      '<button type="button" class="preview-copy">' + escapeHtml(copyText) + '</button>' +
-      '</div>' +
-      '<pre>' + escapeHtml(data.env || '') + '</pre>' +
-      '</div>';
-
     content.innerHTML = html;
     wrap.style.display = '';
     wrap.setAttribute('aria-hidden', 'false');
@@ -661,39 +679,34 @@
     });
   }
 
-  function getRandomBytes(length) {
-    var bytes = new Uint8Array(length);
-    if (typeof crypto !== 'undefined' && crypto.getRandomValues) {
-      crypto.getRandomValues(bytes);
-    } else {
-      for (var i = 0; i < length; i++) bytes[i] = Math.floor(Math.random() * 256);
-    }
-    return bytes;
-  }
-
-  function bytesToHex(bytes) {
-    return Array.prototype.map.call(bytes, function (b) {
-      return ('0' + b.toString(16)).slice(-2);
-    }).join('');
+  // 密钥由服务端按 config/keys-step.yaml 的 generator 生成；keys 为空时全部生成。resolve 为 { keys, cleartext }
+  function requestGeneratedKeys(keys) {
+    return fetch('/api/keys/generate', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ keys: keys || [] })
+    }).then(function (res) {
+      if (!res.ok) throw new Error(res.statusText);
+      return res.json();
+    }).then(function (data) { return { keys: (data && data.keys) || {}, cleartext: (data && data.cleartext) || {} }; });
   }
 
-  function bytesToBase64(bytes) {
-    var binary = '';
-    for (var i = 0; i < bytes.length; i++) binary += String.fromCharCode(bytes[i]);
-    return btoa(binary);
+  // 哈希后的值（如 PASSWORDS）对应的明文只在此展示一次，不写入输入框
+  function cleartextNotice(cleartext, t) {
+    return Object.keys(cleartext).map(function (env) {
+      return env + ': ' + (t.keyGeneratedCleartext || '生成的密码（仅展示一次，只保存其哈希）：') + cleartext[env];
+    }).join('\n');
   }
 
-  function generateKeyValue(type) {
-    if (type === 'aes32') return bytesToBase64(getRandomBytes(32));
-    if (type === 'password') return bytesToBase64(getRandomBytes(24)).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
-    if (type === 'hmacKeys') {
-      var keyId = 'stargate-' + bytesToHex(getRandomBytes(4));
-      var secret = bytesToHex(getRandomBytes(32));
-      var obj = {};
-      obj[keyId] = secret;
-      return JSON.stringify(obj);
-    }
-    return bytesToHex(getRandomBytes(32));
+  function fillGeneratedKeys(grid, keys) {
+    var statusEl = document.getElementById('keys-copy-status');
+    requestGeneratedKeys(keys).then(function (data) {
+      Object.keys(data.keys).forEach(function (env) {
+        var input = q('input.keys-value[data-env="' + env + '"]', grid);
+        if (input) input.value = data.keys[env];
+      });
+      if (statusEl) statusEl.textContent = cleartextNotice(data.cleartext, getI18N(getLang()));
+    });
   }
 
   function copyText(text, successMsg, failedMsg, statusEl) {
@@ -743,7 +756,7 @@
       var def = KEY_DEFINITIONS.filter(function (item) { return item.env === env; })[0];
       if (!input || !def) return;
       if (target.classList.contains('key-gen')) {
-        input.value = generateKeyValue(def.genType);
+        fillGeneratedKeys(grid, [env]);
       } else if (target.classList.contains('key-copy')) {
         if (!input.value) return;
         copyText(input.value, t.keyCopied || '已复制', t.keyCopyFailed || '复制失败', statusEl);
@@ -757,10 +770,7 @@
     var grid = document.getElementById('keys-grid');
     if (btnAll && grid) {
       btnAll.addEventListener('click', function () {
-        KEY_DEFINITIONS.forEach(function (def) {
-          var input = q('input.keys-value[data-env="' + def.env + '"]', grid);
-          if (input) input.value = generateKeyValue(def.genType);
-        });
+        fillGeneratedKeys(grid, []);
       });
     }
     if (btnFill && grid) {
@@ -1066,72 +1076,56 @@
 	var scenarioExtraOptions = {};
 	var DEFAULT_GENERATE_MODES = ['traefik'];
 
-	// 密钥生成：与「生成部署配置」中环境变量对应，genType: apiKey(hex32) | hmacSecret | hmacKeys(JSON) | aes32(base64) | password(base64url)
+	// 密钥生成：与「生成部署配置」中环境变量对应；值由服务端按 config/keys-step.yaml 的 generator 生成（POST /api/keys/generate）
 	var KEY_DEFINITIONS = [
-		{ env: 'WARDEN_API_KEY', labelKey: 'keyLabelWardenApiKey', descKey: 'keyDescWardenApiKey', genType: 'apiKey' },
-		{ env: 'WARDEN_OTP_SECRET_KEY', labelKey: 'keyLabelWardenOtpSecretKey', descKey: 'keyDescWardenOtpSecretKey', genType: 'apiKey' },
-		{ env: 'HERALD_API_KEY', labelKey: 'keyLabelHeraldApiKey', descKey: 'keyDescHeraldApiKey', genType: 'apiKey' },
-		{ env: 'HERALD_HMAC_SECRET', labelKey: 'keyLabelHeraldHmacSecret', descKey: 'keyDescHeraldHmacSecret', genType: 'hmacSecret' },
-		{ env: 'HERALD_HMAC_KEYS', labelKey: 'keyLabelHeraldHmacKeys', descKey: 'keyDescHeraldHmacKeys', genType: 'hmacKeys' },
-		{ env: 'HERALD_TOTP_API_KEY', labelKey: 'keyLabelHeraldTotpApiKey', descKey: 'keyDescHeraldTotpApiKey', genType: 'apiKey' },
-		{ env: 'HERALD_TOTP_HMAC_SECRET', labelKey: 'keyLabelHeraldTotpHmacSecret', descKey: 'keyDescHeraldTotpHmacSecret', genType: 'hmacSecret' },
-		{ env: 'HERALD_TOTP_ENCRYPTION_KEY', labelKey: 'keyLabelHeraldTotpEncryptionKey', descKey: 'keyDescHeraldTotpEncryptionKey', genType: 'aes32' },
-		{ env: 'WARDEN_REDIS_PASSWORD', labelKey: 'keyLabelWardenRedisPassword', descKey: 'keyDescWardenRedisPassword', genType: 'password' },
-		{ env: 'HERALD_REDIS_PASSWORD', labelKey: 'keyLabelHeraldRedisPassword', descKey: 'keyDescHeraldRedisPassword', genType: 'password' },
-		{ env: 'SESSION_STORAGE_REDIS_PASSWORD', labelKey: 'keyLabelSessionRedisPassword', descKey: 'keyDescSessionRedisPassword', genType: 'password' },
-		{ env: 'HERALD_DINGTALK_API_KEY', labelKey: 'keyLabelHeraldDingtalkApiKey', descKey: 'keyDescHeraldDingtalkApiKey', genType: 'apiKey' },
-		{ env: 'HERALD_SMTP_API_KEY', labelKey: 'keyLabelHeraldSmtpApiKey', descKey: 'keyDescHeraldSmtpApiKey', genType: 'apiKey' }
+		{ env: 'WARDEN_API_KEY', labelKey: 'keyLabelWardenApiKey', descKey: 'keyDescWardenApiKey' },
+		{ env: 'WARDEN_OTP_SECRET_KEY', labelKey: 'keyLabelWardenOtpSecretKey', descKey: 'keyDescWardenOtpSecretKey' },
+		{ env: 'HERALD_API_KEY', labelKey: 'keyLabelHeraldApiKey', descKey: 'keyDescHeraldApiKey' },
+		{ env: 'HERALD_HMAC_SECRET', labelKey: 'keyLabelHeraldHmacSecret', descKey: 'keyDescHeraldHmacSecret' },
+		{ env: 'HERALD_HMAC_KEYS', labelKey: 'keyLabelHeraldHmacKeys', descKey: 'keyDescHeraldHmacKeys' },
+		{ env: 'HERALD_TOTP_API_KEY', labelKey: 'keyLabelHeraldTotpApiKey', descKey: 'keyDescHeraldTotpApiKey' },
+		{ env: 'HERALD_TOTP_HMAC_SECRET', labelKey: 'keyLabelHeraldTotpHmacSecret', descKey: 'keyDescHeraldTotpHmacSecret' },
+		{ env: 'HERALD_TOTP_ENCRYPTION_KEY', labelKey: 'keyLabelHeraldTotpEncryptionKey', descKey: 'keyDescHeraldTotpEncryptionKey' },
+		{ env: 'PASSWORDS', labelKey: 'keyLabelPasswords', descKey: 'keyDescPasswords' },
+		{ env: 'WARDEN_HMAC_KEYS', labelKey: 'keyLabelWardenHmacKeys', descKey: 'keyDescWardenHmacKeys' },
+		{ env: 'WARDEN_REDIS_PASSWORD', labelKey: 'keyLabelWardenRedisPassword', descKey: 'keyDescWardenRedisPassword' },
+		{ env: 'HERALD_REDIS_PASSWORD', labelKey: 'keyLabelHeraldRedisPassword', descKey: 'keyDescHeraldRedisPassword' },
+		{ env: 'SESSION_STORAGE_REDIS_PASSWORD', labelKey: 'keyLabelSessionRedisPassword', descKey: 'keyDescSessionRedisPassword' },
+		{ env: 'HERALD_TOTP_REDIS_PASSWORD', labelKey: 'keyLabelHeraldTotpRedisPassword', descKey: 'keyDescHeraldTotpRedisPassword' },
+		{ env: 'HERALD_DINGTALK_API_KEY', labelKey: 'keyLabelHeraldDingtalkApiKey', descKey: 'keyDescHeraldDingtalkApiKey' },
+		{ env: 'HERALD_SMTP_API_KEY', labelKey: 'keyLabelHeraldSmtpApiKey', descKey: 'keyDescHeraldSmtpApiKey' }
 	];
 
-	function getRandomBytes(n) {
-		var arr = new Uint8Array(n);
-		if (typeof crypto !== 'undefined' && crypto.getRandomValues) {
-			crypto.getRandomValues(arr);
-		} else {
-			for (var i = 0; i < n; i++) arr[i] = Math.floor(Math.random() * 256);
-		}
-		return arr;
-	}
-	function bytesToHex(arr) {
-		return Array.prototype.map.call(arr, function (b) { return ('0' + b.toString(16)).slice(-2); }).join('');
-	}
-	function bytesToBase64(arr) {
-		var binary = '';
-		for (var i = 0; i < arr.length; i++) binary += String.fromCharCode(arr[i]);
-		return typeof btoa !== 'undefined' ? btoa(binary) : '';
-	}
-	function bytesToBase64Url(arr) {
-		return bytesToBase64(arr).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
-	}
-	function generateKeyValue(genType) {
-		switch (genType) {
-			case 'apiKey':
-			case 'hmacSecret':
-				return bytesToHex(getRandomBytes(32));
-			case 'aes32':
-				return bytesToBase64(getRandomBytes(32));
-			case 'password':
-				return bytesToBase64Url(getRandomBytes(24));
-			case 'hmacKeys': {
-				var keyId = 'key-' + bytesToHex(getRandomBytes(4));
-				var secret = bytesToHex(getRandomBytes(32));
-				return JSON.stringify({ keyId: keyId, secret: secret });
-			}
-			default:
-				return bytesToHex(getRandomBytes(32));
-		}
-	}
-	function generateHmacKeysJson() {
-		var keyId = 'stargate-' + bytesToHex(getRandomBytes(4));
-		var secret = bytesToHex(getRandomBytes(32));
-		var obj = {};
-		obj[keyId] = secret;
-		return JSON.stringify(obj);
+	// 请求服务端生成密钥：keys 为变量名列表，为空时全部生成（跳过 Redis 密码等 skipGenerateAll 项）；
+	// resolve 为 { keys: { ENV: value }, cleartext: { ENV: 仅展示一次的明文 } }
+	function requestGeneratedKeys(keys) {
+		return fetch('/api/keys/generate', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ keys: keys || [] })
+		}).then(function (res) {
+			if (!res.ok) return res.text().then(function (text) { throw new Error(text || res.statusText); });
+			return res.json();
+		}).then(function (data) { return { keys: (data && data.keys) || {}, cleartext: (data && data.cleartext) || {} }; });
 	}
-	// 修正 HERALD_HMAC_KEYS 的生成结果为 JSON 对象字符串
-	function generateKeyValueFixed(def) {
-		if (def.genType === 'hmacKeys') return generateHmacKeysJson();
-		return generateKeyValue(def.genType);
+	function fillGeneratedKeys(keys) {
+		var grid = document.getElementById('keys-grid');
+		var statusEl = document.getElementById('keys-copy-status');
+		if (!grid) return;
+		requestGeneratedKeys(keys).then(function (data) {
+			Object.keys(data.keys).forEach(function (env) {
+				var input = grid.querySelector('input.keys-value[data-env="' + env + '"]');
+				if (input) input.value = data.keys[env];
+			});
+			// 哈希后的值（如 PASSWORDS）对应的明文只在此展示一次，不写入输入框
+			var t = window.I18N && window.I18N[getLang()] ? window.I18N[getLang()] : {};
+			if (statusEl) statusEl.textContent = Object.keys(data.cleartext).map(function (env) {
+				return env + ': ' + (t.keyGeneratedCleartext || '生成的密码（仅展示一次，只保存其哈希）：') + data.cleartext[env];
+			}).join('\n');
+		}).catch(function (err) {
+			var t = window.I18N && window.I18N[getLang()] ? window.I18N[getLang()] : {};
+			if (statusEl) statusEl.textContent = (t.keyGenerateFailed || '生成失败：') + (err && err.message ? err.message : String(err));
+		});
 	}
 
 	function renderKeysGrid() {
@@ -1168,13 +1162,7 @@
 			var genBtn = e.target.classList && e.target.classList.contains('keys-gen') ? e.target : null;
 			var copyBtn = e.target.classList && e.target.classList.contains('keys-copy') ? e.target : null;
 			if (genBtn) {
-				var env = genBtn.getAttribute('data-env');
-				var def = KEY_DEFINITIONS.filter(function (d) { return d.env === env; })[0];
-				if (def) {
-					var val = generateKeyValueFixed(def);
-					var input = grid.querySelector('input.keys-value[data-env="' + env + '"]');
-					if (input) input.value = val;
-				}
+				fillGeneratedKeys([genBtn.getAttribute('data-env')]);
 			} else if (copyBtn) {
 				var env = copyBtn.getAttribute('data-env');
 				var input = grid.querySelector('input.keys-value[data-env="' + env + '"]');
@@ -1235,6 +1223,37 @@
 		}).then(function () { window.location.href = '/wizard/step-2'; });
 	}
 
+	// PASSWORDS 构建器：明文只随请求发送，由服务端哈希后写入会话 EnvOverrides（POST /passwords/apply），成功后清空输入
+	function applyPasswordsBuilder() {
+		var list = document.getElementById('passwords-builder-list');
+		var algo = document.getElementById('passwords-builder-algorithm');
+		var statusEl = document.getElementById('passwords-builder-status');
+		var output = document.getElementById('passwords-builder-value');
+		if (!list || !algo) return;
+		var t = window.I18N && window.I18N[getLang()] ? window.I18N[getLang()] : {};
+		var passwords = list.value.split(/\r?\n/).filter(function (line) { return line !== ''; });
+		if (passwords.length === 0) return;
+		fetch('/passwords/apply', {
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json' },
+			body: JSON.stringify({ algorithm: algo.value, passwords: passwords })
+		}).then(function (res) {
+			if (!res.ok) return res.text().then(function (text) { throw new Error(text || res.statusText); });
+			return res.json();
+		}).then(function (data) {
+			list.value = '';
+			if (output) {
+				output.value = data.value || '';
+				output.hidden = false;
+			}
+			var input = document.querySelector('#keys-grid input.keys-value[data-env="PASSWORDS"]');
+			if (input) input.value = data.value || '';
+			if (statusEl) statusEl.textContent = t.passwordsBuilderApplied || '已写入生成配置';
+		}).catch(function (err) {
+			if (statusEl) statusEl.textContent = (t.keyGenerateFailed || '生成失败：') + (err && err.message ? err.message : String(err));
+		});
+	}
+
 	function getLang() {
 		return localStorage.getItem(LANG_STORAGE_KEY) || 'zh';
 	}
@@ -1746,17 +1765,24 @@
 						var url = URL.createObjectURL(blob);
 						var a = document.createElement('a');
 						a.href = url;
-						a.download = mode + '/docker-compose.yml';
-						a.textContent = mode + '/docker-compose.yml';
+						a.download = mode + '/' + outputFileName(mode);
+						a.textContent = mode + '/' + outputFileName(mode);
 						downloadsEl.appendChild(a);
+						// 每个 mode 的 .env 仅含其服务引用的变量
+						var envA = document.createElement('a');
+						envA.href = URL.createObjectURL(new Blob([(data.envs || {})[mode] || data.env || ''], { type: 'text/plain;charset=utf-8' }));
+						envA.download = mode + '/.env';
+						envA.textContent = mode + '/.env';
+						downloadsEl.appendChild(envA);
+						var files = (data.files || {})[mode] || {};
+						Object.keys(files).sort().forEach(function (rel) {
+							var fa = document.createElement('a');
+							fa.href = URL.createObjectURL(new Blob([files[rel]], { type: 'text/plain;charset=utf-8' }));
+							fa.download = mode + '/' + rel;
+							fa.textContent = mode + '/' + rel;
+							downloadsEl.appendChild(fa);
+						});
 					}
-					var envBlob = new Blob([data.env], { type: 'text/plain;charset=utf-8' });
-					var envUrl = URL.createObjectURL(envBlob);
-					var envA = document.createElement('a');
-					envA.href = envUrl;
-					envA.download = '.env';
-					envA.textContent = '.env';
-					downloadsEl.appendChild(envA);
 				} catch (e) {
 					fallbackHint = true;
 				}
@@ -1769,9 +1795,9 @@
 					var copyLabel = t.previewCopy || '复制';
 					var html = '';
 					for (var m in data.composes) {
-						html += '<div class="config-preview-block"><div class="config-preview-heading-row"><h4 class="config-preview-heading">' + escapeHtml(m + '/' + composeLabel) + '</h4><button type="button" class="btn btn-sm btn-outline-secondary config-preview-block-select-all">' + escapeHtml(selectAllLabel) + '</button> <button type="button" class="btn btn-sm btn-outline-secondary config-preview-block-copy">' + escapeHtml(copyLabel) + '</button></div><pre class="config-preview-pre">' + escapeHtml(data.composes[m]) + '</pre></div>';
+						html += '<div class="config-preview-block"><div class="config-preview-heading-row"><h4 class="config-preview-heading">' + escapeHtml(m + '/' + outputFileName(m, composeLabel)) + '</h4><button type="button" class="btn btn-sm btn-outline-secondary config-preview-block-select-all">' + escapeHtml(selectAllLabel) + '</button> <button type="button" class="btn btn-sm btn-outline-secondary config-preview-block-copy">' + escapeHtml(copyLabel) + '</button></div><pre class="config-preview-pre">' + escapeHtml(data.composes[m]) + '</pre></div>';
+						html += '<div class="config-preview-block"><div class="config-preview-heading-row"><h4 class="config-preview-heading">' + escapeHtml(m + '/' + envLabel) + '</h4><button type="button" class="btn btn-sm btn-outline-secondary config-preview-block-select-all">' + escapeHtml(selectAllLabel) + '</button> <button type="button" class="btn btn-sm btn-outline-secondary config-preview-block-copy">' + escapeHtml(copyLabel) + '</button></div><pre class="config-preview-pre">' + escapeHtml((data.envs || {})[m] || data.env || '') + '</pre></div>';
 					}
-					html += '<div class="config-preview-block"><div class="config-preview-heading-row"><h4 class="config-preview-heading">' + escapeHtml(envLabel) + '</h4><button type="button" class="btn btn-sm btn-outline-secondary config-preview-block-select-all">' + escapeHtml(selectAllLabel) + '</button> <button type="button" class="btn btn-sm btn-outline-secondary config-preview-block-copy">' + escapeHtml(copyLabel) + '</button></div><pre class="config-preview-pre">' + escapeHtml(data.env) + '</pre></div>';
 					previewContent.innerHTML = html;
 					previewWrap.style.display = '';
 					previewWrap.setAttribute('aria-hidden', 'false');
@@ -1796,6 +1822,62 @@
 		if (btnGen) btnGen.addEventListener('click', function () { doGenerateRequest(null); });
 	}
 
+	// Profile 导出：勾选「包含密钥」时为链接追加 keys=1
+	var profileKeysCb = document.getElementById('profile-include-keys');
+	if (profileKeysCb) {
+		profileKeysCb.addEventListener('change', function () {
+			document.querySelectorAll('[data-profile-format]').forEach(function (a) {
+				a.href = '/profile/export?format=' + a.getAttribute('data-profile-format') + (profileKeysCb.checked ? '&keys=1' : '');
+			});
+		});
+	}
+	// Profile 导入：读取文件或文本框内容，POST 原文到 /profile/import，成功后进入回顾页
+	var profileFileEl = document.getElementById('input-profile-file');
+	var profileTextEl = document.getElementById('input-profile');
+	if (profileFileEl && profileTextEl) {
+		profileFileEl.addEventListener('change', function () {
+			var file = profileFileEl.files && profileFileEl.files[0];
+			if (!file) return;
+			var reader = new FileReader();
+			reader.onload = function () { profileTextEl.value = String(reader.result || ''); };
+			reader.readAsText(file);
+		});
+	}
+	var btnImportProfile = document.getElementById('btn-import-profile');
+	if (btnImportProfile && profileTextEl) {
+		btnImportProfile.addEventListener('click', function () {
+			var lang = getLang();
+			var t = window.I18N && window.I18N[lang] ? window.I18N[lang] : {};
+			var resultEl = document.getElementById('profile-import-result');
+			var text = profileTextEl.value || '';
+			if (!text.trim()) {
+				if (resultEl) { resultEl.textContent = t.profileImportRequired || '请选择或粘贴 profile 内容。'; resultEl.className = 'mt-3 error'; }
+				return;
+			}
+			btnImportProfile.disabled = true;
+			fetch('/profile/import', { method: 'POST', headers: { 'Content-Type': 'application/x-yaml' }, body: text })
+				.then(function (resp) {
+					if (resp.ok) {
+						window.location.href = '/review';
+						return null;
+					}
+					return resp.json().then(function (data) { return data; }, function () { return { errors: [resp.statusText] }; });
+				})
+				.then(function (data) {
+					if (!data) return;
+					btnImportProfile.disabled = false;
+					if (resultEl) {
+						resultEl.textContent = (data.errors && data.errors.length) ? data.errors.join('\n') : (t.applyFailed || '加载失败');
+						resultEl.className = 'mt-3 error';
+					}
+				})
+				.catch(function (err) {
+					btnImportProfile.disabled = false;
+					if (resultEl) { resultEl.textContent = (t.requestFailed || '') + (err && err.message ? err.message : String(err)); resultEl.className = 'mt-3 error'; }
+				});
+		});
+	}
+
 	// Parse (import-parse tab). Convention: API errors and parse messages are plain text only; we use textContent for error display to avoid XSS.
 	var btnParse = document.getElementById('btn-parse');
 	var parseResultEl = document.getElementById('parse-result');
@@ -1938,6 +2020,9 @@
 		div.textContent = s;
 		return div.innerHTML;
 	}
+	function outputFileName(mode, composeLabel) {
+		return mode === 'k8s' ? 'k8s.yaml' : (composeLabel || 'docker-compose.yml');
+	}
 
 	// 预览区：每个配置块独立全选（事件委托，因块为动态生成）
 	var previewContentEl = document.getElementById('config-preview-content');
@@ -1997,15 +2082,16 @@
 	var btnGenerateAllKeys = document.getElementById('btn-generate-all-keys');
 	if (btnGenerateAllKeys) {
 		btnGenerateAllKeys.addEventListener('click', function () {
-			KEY_DEFINITIONS.forEach(function (def) {
-				var input = document.querySelector('#keys-grid input.keys-value[data-env="' + def.env + '"]');
-				if (input) input.value = generateKeyValueFixed(def);
-			});
+			fillGeneratedKeys([]);
 		});
 	}
 	var btnFillKeysIntoGenerate = document.getElementById('btn-fill-keys-into-generate');
 	if (btnFillKeysIntoGenerate) {
 		btnFillKeysIntoGenerate.addEventListener('click', fillKeysIntoGenerate);
 	}
+	var btnPasswordsApply = document.getElementById('btn-passwords-apply');
+	if (btnPasswordsApply) {
+		btnPasswordsApply.addEventListener('click', applyPasswordsBuilder);
+	}
 
 })();
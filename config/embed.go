@@ -0,0 +1,14 @@
+// Package config 嵌入本目录中的默认配置文件，供未提供 config/ 目录时作为内置定义（见 composegen.DefaultModeDefs / DefaultProviders）。
+package config
+
+import _ "embed"
+
+// ModesYAML 为 config/modes.yaml 的内容。
+//
+//go:embed modes.yaml
+var ModesYAML []byte
+
+// ProvidersYAML 为 config/providers.yaml 的内容。
+//
+//go:embed providers.yaml
+var ProvidersYAML []byte
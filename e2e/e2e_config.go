@@ -17,6 +17,18 @@ func protectedURL() string {
 	return os.Getenv("PROTECTED_URL")
 }
 
+// smsSinkURL 为 sms-sink 收件箱地址（生成时启用 smsUseSink，如 http://127.0.0.1:8086）。
+// 仅当设置环境变量 SMS_SINK_URL 时，e2e 会从收件箱读取 Herald 实际下发的短信验证码；未设置则跳过。
+func smsSinkURL() string {
+	return os.Getenv("SMS_SINK_URL")
+}
+
+// dingtalkMockURL 为 dingtalk-mock 地址（生成时启用 dingtalkEnabled 与 dingtalkUseMock，如 http://127.0.0.1:8087）。
+// 仅当设置环境变量 DINGTALK_MOCK_URL 时，e2e 会从其收件箱读取 herald-dingtalk 实际发出的验证码；未设置则跳过。
+func dingtalkMockURL() string {
+	return os.Getenv("DINGTALK_MOCK_URL")
+}
+
 // AuthHeaders represents the auth headers returned by forwardAuth.
 type AuthHeaders struct {
 	UserID string
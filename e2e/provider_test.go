@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -313,3 +314,83 @@ func TestHeraldProviderSMS(t *testing.T) {
 	t.Logf("✓ SMS challenge created successfully: %s", challengeResp.ChallengeID)
 	t.Log("Note: Check audit logs for SMS provider send events")
 }
+
+// TestHeraldProviderSMSSink verifies a challenge with the code Herald actually delivered through the SMS HTTP API,
+// captured by sms-sink (generate with smsUseSink and set SMS_SINK_URL, e.g. http://127.0.0.1:8086; skipped otherwise).
+func TestHeraldProviderSMSSink(t *testing.T) {
+	if smsSinkURL() == "" {
+		t.Skip("SMS_SINK_URL not set; generate with smsUseSink to run against sms-sink")
+	}
+	phone := "+8613800138099"
+	verifyDeliveredCode(t, smsSinkURL(), HeraldChallengeRequest{
+		UserID:      "test-user-sms-sink",
+		Channel:     "sms",
+		Destination: phone,
+		Purpose:     "login",
+	}, "phone="+url.QueryEscape(phone))
+}
+
+// TestHeraldProviderDingTalkMock verifies a challenge with the code herald-dingtalk sent as a work notification,
+// captured by dingtalk-mock. Generate with dingtalkEnabled and dingtalkUseMock (gen wires Herald to herald-dingtalk and
+// herald-dingtalk to dingtalk-mock) and set DINGTALK_MOCK_URL to the mock's host address, e.g. http://127.0.0.1:8087;
+// skipped otherwise.
+func TestHeraldProviderDingTalkMock(t *testing.T) {
+	if dingtalkMockURL() == "" {
+		t.Skip("DINGTALK_MOCK_URL not set; generate with dingtalkEnabled and dingtalkUseMock to run against dingtalk-mock")
+	}
+	userID := "test-admin-001"
+	verifyDeliveredCode(t, dingtalkMockURL(), HeraldChallengeRequest{
+		UserID:      userID,
+		Channel:     "dingtalk",
+		Destination: userID,
+		Purpose:     "login",
+	}, "userid="+url.QueryEscape(userID))
+}
+
+// verifyDeliveredCode creates a challenge, reads the delivered code from the stand-in inbox at mockURL (filtered by query)
+// and verifies the challenge with it.
+func verifyDeliveredCode(t *testing.T, mockURL string, reqBody HeraldChallengeRequest, query string) {
+	ensureServicesReady(t)
+	if !waitForService(t, mockURL+"/healthz", 30*time.Second) {
+		t.Fatalf("%s is not ready", mockURL)
+	}
+	testza.AssertNoError(t, clearMockInbox(t, mockURL))
+
+	bodyBytes, err := json.Marshal(reqBody)
+	testza.AssertNoError(t, err)
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/otp/challenges", heraldURL), bytes.NewReader(bodyBytes))
+	testza.AssertNoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-API-Key", heraldAPIKey)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	testza.AssertNoError(t, err)
+	var challengeResp HeraldChallengeResponse
+	err = json.NewDecoder(resp.Body).Decode(&challengeResp)
+	resp.Body.Close()
+	testza.AssertNoError(t, err)
+	testza.AssertEqual(t, http.StatusOK, resp.StatusCode)
+
+	code, err := waitForMockCode(t, mockURL, query, 15*time.Second)
+	testza.AssertNoError(t, err, "Herald should deliver the code through "+reqBody.Channel)
+	t.Logf("✓ Code delivered via %s: %s", reqBody.Channel, code)
+
+	verifyBytes, err := json.Marshal(HeraldVerifyRequest{ChallengeID: challengeResp.ChallengeID, Code: code})
+	testza.AssertNoError(t, err)
+	verifyReq, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/otp/verifications", heraldURL), bytes.NewReader(verifyBytes))
+	testza.AssertNoError(t, err)
+	verifyReq.Header.Set("Content-Type", "application/json")
+	verifyReq.Header.Set("Accept", "application/json")
+	verifyReq.Header.Set("X-API-Key", heraldAPIKey)
+
+	verifyResp, err := client.Do(verifyReq)
+	testza.AssertNoError(t, err)
+	defer verifyResp.Body.Close()
+	testza.AssertEqual(t, http.StatusOK, verifyResp.StatusCode)
+	var verifyBody HeraldVerifyResponse
+	testza.AssertNoError(t, json.NewDecoder(verifyResp.Body).Decode(&verifyBody))
+	testza.AssertTrue(t, verifyBody.OK, "Delivered code should verify the challenge")
+}
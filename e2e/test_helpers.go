@@ -486,3 +486,63 @@ func waitForServiceDown(t *testing.T, url string, timeout time.Duration) bool {
 	}
 	return false
 }
+
+// clearMockInbox empties the inbox of a local channel stand-in (sms-sink, dingtalk-mock) at baseURL.
+func clearMockInbox(t *testing.T, baseURL string) error {
+	req, err := http.NewRequest(http.MethodDelete, baseURL+"/messages", nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			t.Logf("Warning: failed to close response body: %v", closeErr)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// waitForMockCode polls a stand-in inbox (GET <baseURL>/messages/latest?<query>) until a message arrives and returns its verification code.
+func waitForMockCode(t *testing.T, baseURL, query string, timeout time.Duration) (string, error) {
+	url := fmt.Sprintf("%s/messages/latest?%s", baseURL, query)
+	client := &http.Client{Timeout: 5 * time.Second}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		var msg struct {
+			Content string `json:"content"`
+			Code    string `json:"code"`
+		}
+		status := resp.StatusCode
+		if status == http.StatusOK {
+			err = json.NewDecoder(resp.Body).Decode(&msg)
+		}
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			t.Logf("Warning: failed to close response body: %v", closeErr)
+		}
+		switch {
+		case err != nil:
+			return "", err
+		case status == http.StatusOK && msg.Code != "":
+			return msg.Code, nil
+		case status == http.StatusOK:
+			return "", fmt.Errorf("no verification code in message: %q", msg.Content)
+		case status != http.StatusNotFound:
+			return "", fmt.Errorf("unexpected status code: %d", status)
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("no message for %s within %s", query, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
@@ -6,6 +6,7 @@ require (
 	github.com/MarvinJWendt/testza v0.5.2
 	github.com/redis/go-redis/v9 v9.18.0
 	github.com/soulteary/cli-kit v1.6.0
+	golang.org/x/crypto v0.47.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -2,7 +2,6 @@
 package composegen
 
 import (
-	"bytes"
 	"fmt"
 	"os"
 	"regexp"
@@ -19,20 +18,34 @@ type Options struct {
 	HealthCheckStartPeriod string // 健康检查启动延迟，如 "10s"；空表示不覆盖
 	TraefikNetwork         bool   // 是否加入 Traefik 网络及相关 labels
 	TraefikNetworkName     string // Traefik 网络名称，默认 "traefik"
-	ExposePorts            bool   // true 保留 ports:，false 改为仅 expose
-	IncludeDingTalk        bool   // 全量 traefik 时是否包含 herald-dingtalk 服务
-	IncludeSmtp            bool   // 全量 traefik / traefik-herald 时是否包含 herald-smtp 服务
-	UseOwlmailForSmtp      bool   // 启用 SMTP 时是否搭配 OwlMail 进行测试（注入 owlmail 服务并让 herald-smtp 指向其 SMTP）
-	IncludeTotp            bool   // 全量 traefik / traefik-herald 时是否包含 herald-totp 服务
+	// 为 true 时在接入 Traefik 网络的 mode 中注入 traefik 服务，并输出其静态 / 动态配置与自签名默认证书（build/<mode>/traefik/，
+	// Generated.Files），Traefik 网络改由 compose 创建；需同时开启 TraefikNetwork，swarm / k8s 不受影响
+	BundledTraefik bool
+	// Traefik labels 的入口、中间件、证书解析器、优先级与 forward-auth 中间件名；留空时保持 canonical 的取值（见 applyTraefikLabelOptions）
+	TraefikEntrypointHTTP   string // 跳转路由的入口，默认 "http"
+	TraefikEntrypointHTTPS  string // TLS 路由的入口，默认 "https"
+	TraefikHTTPMiddlewares  string // 跳转路由的中间件链（逗号分隔），默认 "redir-https"；"none" 表示不挂载
+	TraefikHTTPSMiddlewares string // TLS 路由在 forward-auth 之外的中间件链，默认 "gzip"；"none" 表示不挂载
+	TraefikCertResolver     string // TLS 路由的 certresolver，如 "letsencrypt"；空表示仅 tls=true（默认证书）
+	TraefikRouterPriority   string // Stargate 路由的优先级，默认 "100"
+	TraefikAuthMiddleware   string // forward-auth 中间件名，默认 "stargate-auth"
+	// 为 true 时另输出 build/<mode>/traefik-dynamic.yml：由 Traefik labels 转换的 file provider 动态配置（路由、服务、中间件，
+	// 服务以容器名与端口寻址），供仅启用 file provider 的 Traefik 使用；TraefikStripLabels 为 true 时同时移除 compose 中的 Traefik labels。
+	// swarm / k8s 不输出
+	TraefikDynamicFile bool
+	TraefikStripLabels bool
+	ExposePorts        bool // true 保留 ports:，false 改为仅 expose
+	IncludeTotp        bool // 全量 traefik / traefik-herald 时是否包含 herald-totp 服务
 	// 暴露端口时可选的主机端口，空表示使用 compose 默认
 	PortHerald          string            // Herald 主机端口，如 "8082"
 	PortWarden          string            // Warden 主机端口，如 "8081"
 	PortHeraldRedis     string            // Herald Redis 主机端口，如 "6379"
 	PortHeraldTotp      string            // herald-totp 主机端口，如 "8084"
-	PortHeraldSmtp      string            // herald-smtp 主机端口，如 "8085"
-	PortOwlmail         string            // OwlMail Web 主机端口，如 "1080"（仅搭配 SMTP 时有效）
 	ContainerNamePrefix string            // 容器名前缀，如 "the-gate-"
 	EnvOverrides        map[string]string // 环境变量覆盖，合并进各服务 environment
+	// Herald 通道（config/providers.yaml）的选项：键为描述中的 option / portOption（含 mock 的，如 smtpEnabled、smtpUseOwlmail、portHeraldSmtp），
+	// 开关取值 "true" 表示启用，缺省为未启用
+	Providers map[string]string
 	// Redis 数据：true 使用 Docker 命名卷，false 使用主机绑定路径
 	UseNamedVolume      bool   // 为 true 时保持命名卷；为 false 时使用 HeraldRedisDataPath / WardenRedisDataPath
 	HeraldRedisDataPath string // 绑定路径时 Herald Redis 数据目录，默认 ./data/herald-redis
@@ -41,39 +54,45 @@ type Options struct {
 	StargateSessionRedisUseBuiltin bool
 	// Warden 无 Redis 场景：为 true 时移除 warden-redis 服务与其卷，并清理 warden 的 depends_on
 	DisableWardenRedisService bool
+	// 敏感 .env 键（来自 config/keys-step.yaml）；swarm 放入 secrets:、k8s 放入 Secret。为空时仅按键名规则判断（见 IsSecretEnvKey）
+	SecretKeys    []string
+	SwarmReplicas string // swarm 模式下无状态服务的副本数，如 "2"；空表示 1（Redis 等有状态服务固定为 1）
+	// 为 true 时服务声明了 *_FILE 变体（如 warden REDIS_PASSWORD_FILE）的非空密钥写入 build/<mode>/secrets/<小写变量名>
+	// （Generated.Files），以顶层 secrets: 挂载并不再以环境变量注入；其余密钥仍留在 .env 中（见 mountEnvSecrets）；k8s 模式已使用 Secret，不受影响
+	SecretsFiles bool
 }
 
-// serviceNameToContainerSuffix 逻辑服务名 -> container_name 后缀（前缀由 Options 提供）
-var serviceNameToContainerSuffix = map[string]string{
-	"herald": "herald", "herald-redis": "herald-redis", "herald-totp": "herald-totp", "herald-dingtalk": "herald-dingtalk", "herald-smtp": "herald-smtp", "owlmail": "owlmail",
-	"warden": "warden", "warden-redis": "warden-redis",
-	"stargate": "stargate", "stargate-redis": "stargate-redis", "protected-service": "whoami",
-}
-
-// splitDef 定义从完整 compose 中切出的服务、卷及是否应用 stargate 覆盖。
-type splitDef struct {
-	name              string
-	services          []string
-	volumes           []string
-	stargateOverrides bool
-}
+// secretKeyMarkers 变量名包含任一标记（或以 _KEY 结尾）时视为敏感；以 _FILE 结尾的为路径，不算敏感。
+var secretKeyMarkers = []string{"PASSWORD", "SECRET", "API_KEY", "HMAC_KEYS", "PRIVATE_KEY"}
 
-var traefikSplitDefs = []splitDef{
-	{"traefik", nil, nil, false}, // 全量，services/volumes 为 nil 表示全部保留
-	{"traefik-herald", []string{"herald", "herald-redis", "herald-totp", "herald-smtp"}, []string{"herald-redis-data"}, false},
-	{"traefik-warden", []string{"warden", "warden-redis"}, []string{"warden-redis-data"}, false},
-	{"traefik-stargate", []string{"stargate", "protected-service"}, nil, true},
+// IsSecretEnvKey 判断 .env 键是否敏感：在 opts.SecretKeys 中，或按 secretKeyMarkers 规则命中。
+func IsSecretEnvKey(opts *Options, key string) bool {
+	if opts != nil {
+		for _, k := range opts.SecretKeys {
+			if k == key {
+				return true
+			}
+		}
+	}
+	if strings.HasSuffix(key, "_FILE") {
+		return false
+	}
+	if strings.HasSuffix(key, "_KEY") {
+		return true
+	}
+	for _, m := range secretKeyMarkers {
+		if strings.Contains(key, m) {
+			return true
+		}
+	}
+	return false
 }
 
-// image/build 模式：仅核心三服务+Redis，无 Traefik；build 模式将 herald/warden/stargate 的 image 替换为 build。
-var imageBuildServices = []string{"herald", "herald-redis", "warden", "warden-redis", "stargate"}
-var imageBuildVolumes = []string{"herald-redis-data", "warden-redis-data"}
-
-// buildContexts 为 build 模式下各服务的 build context（相对 stargate-suite 根目录）。
-var buildContexts = map[string]struct{ Context, Dockerfile string }{
-	"herald":   {"../../herald", "docker/Dockerfile.manual"},
-	"warden":   {"../../warden", "docker/Dockerfile.manual"},
-	"stargate": {"../../stargate", "docker/Dockerfile.manual"},
+// serviceNameToContainerSuffix 逻辑服务名 -> container_name 后缀（前缀由 Options 提供）；通道服务的容器名见 applyProviders
+var serviceNameToContainerSuffix = map[string]string{
+	"herald": "herald", "herald-redis": "herald-redis", "herald-totp": "herald-totp",
+	"warden": "warden", "warden-redis": "warden-redis",
+	"stargate": "stargate", "stargate-redis": "stargate-redis", "protected-service": "whoami",
 }
 
 // envComments 环境变量名 -> 注释（用于在生成的 docker-compose 中插入注释；无 env-meta 时的 fallback，有 env-meta 时由 meta.Comments() 提供）
@@ -177,50 +196,50 @@ var envComments = map[string]string{
 	"PROTECTED_IMAGE":                     "受保护服务（whoami）镜像，E2E/演示用",
 	"DEBUG":                               "调试模式",
 	// Herald built-in SMTP / SMS / TLS / session / audit / OTLP (container env names)
-	"SMS_PROVIDER":                       "Herald 短信供应商名称",
-	"SMS_API_BASE_URL":                   "Herald 短信 HTTP API base URL",
-	"SMS_API_KEY":                        "Herald 短信 API 密钥",
-	"TLS_CERT_FILE":                      "Herald 服务端 TLS 证书路径",
-	"TLS_KEY_FILE":                       "Herald 服务端 TLS 私钥路径",
-	"TLS_CA_CERT_FILE":                   "Herald 客户端 CA（mTLS）",
-	"TLS_CLIENT_CA_FILE":                 "Herald 客户端 CA 别名",
-	"HERALD_SESSION_STORAGE_ENABLED":     "Herald Redis 会话存储",
-	"HERALD_SESSION_DEFAULT_TTL":         "Herald 会话默认 TTL",
-	"HERALD_SESSION_KEY_PREFIX":          "Herald 会话 Redis 键前缀",
-	"AUDIT_ENABLED":                      "Herald 审计开关",
-	"AUDIT_MASK_DESTINATION":             "Herald 审计脱敏目标地址",
-	"AUDIT_TTL":                          "Herald 审计记录 TTL",
-	"AUDIT_STORAGE_TYPE":                 "Herald 审计存储类型",
-	"AUDIT_DATABASE_URL":                 "Herald 审计数据库 URL",
-	"AUDIT_TABLE_NAME":                   "Herald 审计表名",
-	"AUDIT_FILE_PATH":                    "Herald 审计文件路径",
-	"AUDIT_LOKI_URL":                     "Herald 审计 Loki URL",
-	"AUDIT_WRITER_QUEUE_SIZE":            "Herald 审计写入队列大小",
-	"AUDIT_WRITER_WORKERS":               "Herald 审计写入 worker 数",
-	"TEMPLATE_DIR":                       "Herald 邮件/短信模板目录",
+	"SMS_PROVIDER":                   "Herald 短信供应商名称",
+	"SMS_API_BASE_URL":               "Herald 短信 HTTP API base URL",
+	"SMS_API_KEY":                    "Herald 短信 API 密钥",
+	"TLS_CERT_FILE":                  "Herald 服务端 TLS 证书路径",
+	"TLS_KEY_FILE":                   "Herald 服务端 TLS 私钥路径",
+	"TLS_CA_CERT_FILE":               "Herald 客户端 CA（mTLS）",
+	"TLS_CLIENT_CA_FILE":             "Herald 客户端 CA 别名",
+	"HERALD_SESSION_STORAGE_ENABLED": "Herald Redis 会话存储",
+	"HERALD_SESSION_DEFAULT_TTL":     "Herald 会话默认 TTL",
+	"HERALD_SESSION_KEY_PREFIX":      "Herald 会话 Redis 键前缀",
+	"AUDIT_ENABLED":                  "Herald 审计开关",
+	"AUDIT_MASK_DESTINATION":         "Herald 审计脱敏目标地址",
+	"AUDIT_TTL":                      "Herald 审计记录 TTL",
+	"AUDIT_STORAGE_TYPE":             "Herald 审计存储类型",
+	"AUDIT_DATABASE_URL":             "Herald 审计数据库 URL",
+	"AUDIT_TABLE_NAME":               "Herald 审计表名",
+	"AUDIT_FILE_PATH":                "Herald 审计文件路径",
+	"AUDIT_LOKI_URL":                 "Herald 审计 Loki URL",
+	"AUDIT_WRITER_QUEUE_SIZE":        "Herald 审计写入队列大小",
+	"AUDIT_WRITER_WORKERS":           "Herald 审计写入 worker 数",
+	"TEMPLATE_DIR":                   "Herald 邮件/短信模板目录",
 	// herald-totp (container env names; REDIS_PASSWORD/REDIS_DB reuse comment from Herald above)
-	"TOTP_ISSUER":                        "herald-totp TOTP Issuer",
-	"TOTP_PERIOD":                        "herald-totp TOTP 周期（秒）",
-	"TOTP_DIGITS":                        "herald-totp TOTP 位数",
-	"TOTP_SKEW":                          "herald-totp 时间步长偏移",
-	"ENROLL_TTL":                         "herald-totp 绑定流程临时状态 TTL",
-	"HERALD_TOTP_HMAC_KEYS":              "herald-totp 多密钥 HMAC JSON",
-	"RATE_LIMIT_PER_SUBJECT":             "herald-totp 每 subject 每小时限流",
+	"TOTP_ISSUER":            "herald-totp TOTP Issuer",
+	"TOTP_PERIOD":            "herald-totp TOTP 周期（秒）",
+	"TOTP_DIGITS":            "herald-totp TOTP 位数",
+	"TOTP_SKEW":              "herald-totp 时间步长偏移",
+	"ENROLL_TTL":             "herald-totp 绑定流程临时状态 TTL",
+	"HERALD_TOTP_HMAC_KEYS":  "herald-totp 多密钥 HMAC JSON",
+	"RATE_LIMIT_PER_SUBJECT": "herald-totp 每 subject 每小时限流",
 	// Warden (container env names)
-	"DATA_DIR":                           "Warden 本地用户数据目录",
-	"RESPONSE_FIELDS":                    "Warden API 响应字段白名单",
-	"REMOTE_DECRYPT_ENABLED":             "Warden 远程响应 RSA 解密",
-	"REMOTE_RSA_PRIVATE_KEY_FILE":        "Warden RSA 私钥文件路径",
-	"REMOTE_RSA_PRIVATE_KEY":             "Warden RSA 私钥内联 PEM",
-	"TRUSTED_PROXY_IPS":                  "Warden 信任的代理 IP",
-	"HEALTH_CHECK_IP_WHITELIST":          "Warden 健康检查 IP 白名单",
-	"IP_WHITELIST":                       "Warden 全局 IP 白名单",
-	"WARDEN_HMAC_KEYS":                   "Warden HMAC 密钥 JSON",
-	"WARDEN_HMAC_TIMESTAMP_TOLERANCE":    "Warden HMAC 时间戳容差（秒）",
-	"WARDEN_TLS_CERT":                    "Warden 服务端 TLS 证书路径",
-	"WARDEN_TLS_KEY":                     "Warden 服务端 TLS 私钥路径",
-	"WARDEN_TLS_CA":                      "Warden 客户端 CA（mTLS）",
-	"WARDEN_TLS_REQUIRE_CLIENT_CERT":     "Warden 是否要求客户端证书",
+	"DATA_DIR":                        "Warden 本地用户数据目录",
+	"RESPONSE_FIELDS":                 "Warden API 响应字段白名单",
+	"REMOTE_DECRYPT_ENABLED":          "Warden 远程响应 RSA 解密",
+	"REMOTE_RSA_PRIVATE_KEY_FILE":     "Warden RSA 私钥文件路径",
+	"REMOTE_RSA_PRIVATE_KEY":          "Warden RSA 私钥内联 PEM",
+	"TRUSTED_PROXY_IPS":               "Warden 信任的代理 IP",
+	"HEALTH_CHECK_IP_WHITELIST":       "Warden 健康检查 IP 白名单",
+	"IP_WHITELIST":                    "Warden 全局 IP 白名单",
+	"WARDEN_HMAC_KEYS":                "Warden HMAC 密钥 JSON",
+	"WARDEN_HMAC_TIMESTAMP_TOLERANCE": "Warden HMAC 时间戳容差（秒）",
+	"WARDEN_TLS_CERT":                 "Warden 服务端 TLS 证书路径",
+	"WARDEN_TLS_KEY":                  "Warden 服务端 TLS 私钥路径",
+	"WARDEN_TLS_CA":                   "Warden 客户端 CA（mTLS）",
+	"WARDEN_TLS_REQUIRE_CLIENT_CERT":  "Warden 是否要求客户端证书",
 }
 
 // LoadCompose 读取并解析 compose 文件为 map。
@@ -247,45 +266,6 @@ func ParseCompose(data []byte) (map[string]interface{}, error) {
 // envVarRegex 匹配 ${VAR:-default} 或 ${VAR}
 var envVarRegex = regexp.MustCompile(`\$\{([^}:]+)(?::-([^}]*))?\}`)
 
-// envLineRegex 匹配 environment 列表项 "- KEY=VALUE" 或 "- KEY=${VAR:-default}"
-var envLineRegex = regexp.MustCompile(`^(\s+)-\s+([^=]+)=`)
-
-// injectEnvComments 在生成的 YAML 中为 environment 列表项插入注释行（便于用户查看和修改）。
-func injectEnvComments(yml []byte, comments map[string]string) []byte {
-	if len(comments) == 0 {
-		return yml
-	}
-	lines := strings.Split(string(yml), "\n")
-	var out []string
-	inEnv := false
-	baseIndent := 0
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == "environment:" {
-			inEnv = true
-			baseIndent = len(line) - len(strings.TrimLeft(line, " \t"))
-			out = append(out, line)
-			continue
-		}
-		lead := len(line) - len(strings.TrimLeft(line, " \t"))
-		// 离开 environment 块：缩进不大于 baseIndent，且不是空行/注释，且不是 env 列表项（- KEY=VAL）
-		if inEnv && lead <= baseIndent && trimmed != "" && !strings.HasPrefix(trimmed, "#") && envLineRegex.FindStringSubmatch(line) == nil {
-			inEnv = false
-		}
-		if inEnv {
-			if m := envLineRegex.FindStringSubmatch(line); len(m) >= 3 {
-				key := strings.TrimSpace(m[2])
-				if c, ok := comments[key]; ok && c != "" {
-					indent := m[1]
-					out = append(out, indent+"# "+c)
-				}
-			}
-		}
-		out = append(out, line)
-	}
-	return []byte(strings.Join(out, "\n"))
-}
-
 // ExtractEnvVars 从 compose map 中扫描 image、environment、labels 等中的 ${VAR:-default}，返回变量名到默认值的映射。
 func ExtractEnvVars(compose map[string]interface{}) map[string]string {
 	vars := make(map[string]string)
@@ -446,12 +426,12 @@ func EnvBodyFromVars(vars map[string]string, optionalOverride string, meta *EnvM
 			if k == "HERALD_TOTP_IMAGE" {
 				lines = append(lines, "# TOTP 2FA (optional): Herald proxies to herald-totp; Stargate uses Herald client for enroll/verify")
 			}
-			lines = append(lines, k+"="+v)
+			lines = append(lines, FormatDotEnvLine(k, v))
 		}
 	}
 	for k, v := range vars {
 		if !seen[k] {
-			lines = append(lines, k+"="+v)
+			lines = append(lines, FormatDotEnvLine(k, v))
 		}
 	}
 	if optionalOverride != "" {
@@ -584,55 +564,21 @@ func copyMap(m map[string]interface{}) map[string]interface{} {
 	return out
 }
 
-func copyServices(svcs map[string]interface{}) map[string]interface{} {
-	if svcs == nil {
-		return nil
-	}
-	out := make(map[string]interface{}, len(svcs))
-	for k, v := range svcs {
-		if m, ok := v.(map[string]interface{}); ok {
-			out[k] = copyMap(m)
-		} else {
-			out[k] = v
-		}
-	}
-	return out
-}
-
+// splitComposeComment 返回 swarm / k8s 输出的文件头（切分 mode 的文件头见 ModeDef.Header）。
 func splitComposeComment(name string) string {
 	switch name {
-	case "traefik":
-		return `# Stargate Suite with Traefik - 三合一（由 canonical 生成）
-# 使用：docker compose -f build/traefik/docker-compose.yml up -d
+	case "swarm":
+		return `# Stargate Suite - Docker Swarm stack（由 canonical 生成，服务集合与 traefik 三合一一致）
+# docker stack deploy 不读取 .env，需先导出变量：set -a; . build/swarm/.env; set +a
+# 部署：docker stack deploy -c build/swarm/docker-compose.yml the-gate
+# 注意：顶层 secrets 的 file 指向与本文件一同生成的 ./secrets/<小写变量名>；Redis 固定在 manager 节点（named volume）。
 #
 `
-	case "traefik-herald":
-		return `# Herald 独立 compose - Herald + herald-totp（TOTP 2FA）+ Redis（由 canonical 生成）
-# 使用前先创建共享网络：docker network create the-gate-network
-# 启动：docker compose -f build/traefik-herald/docker-compose.yml up -d
-#
-`
-	case "traefik-warden":
-		return `# Warden 独立 compose - 仅白名单用户服务及其 Redis（由 canonical 生成）
-# 使用前先创建共享网络：docker network create the-gate-network
-# 启动：docker compose -f build/traefik-warden/docker-compose.yml up -d
-#
-`
-	case "traefik-stargate":
-		return `# Stargate 独立 compose - 仅 Forward Auth 与示例受保护服务（由 canonical 生成）
-# 依赖：Herald、Warden 已用独立 compose 启动，且与 Stargate 同属 the-gate-network。
-# 启动：docker compose -f build/traefik-stargate/docker-compose.yml up -d
-#
-`
-	case "image":
-		return `# Stargate Suite - 预构建镜像运行（由 canonical 生成）
-# 使用：docker compose -f build/image/docker-compose.yml up -d
-#
-`
-	case "build":
-		return `# Stargate Suite - 从源码构建运行（由 canonical 生成）
-# 使用：docker compose -f build/build/docker-compose.yml up -d --build
-# 注意：build context 为 ../../herald、../../warden、../../stargate，需在 stargate-suite 根目录执行。
+	case "k8s":
+		return `# Stargate Suite - Kubernetes 清单（由 canonical 生成，服务集合与 traefik 三合一一致）
+# 使用：kubectl apply -f build/k8s/k8s.yaml
+# 注意：warden 的 data.json 需先创建 ConfigMap：kubectl -n the-gate create configmap warden-data-json --from-file=data.json=fixtures/warden/data.json
+#       Middleware / IngressRoute 需集群已安装 Traefik CRD（traefik.io/v1alpha1）；gzip 等外部 middleware 不在此生成。
 #
 `
 	default:
@@ -641,686 +587,421 @@ func splitComposeComment(name string) string {
 }
 
 // applyOptions 对单个服务应用 Options（健康检查、端口、容器名、环境变量）。
-func applyOptions(svc map[string]interface{}, serviceName string, opts *Options) {
+func applyOptions(svc *Service, serviceName string, opts *Options) {
 	if opts == nil {
 		return
 	}
 	if !opts.HealthCheck {
-		delete(svc, "healthcheck")
+		delete(svc.Extra, "healthcheck")
 	} else if opts.HealthCheckInterval != "" || opts.HealthCheckStartPeriod != "" {
-		// 覆盖健康检查间隔与启动延迟。保留两分支以兼容不同 unmarshal 结果（yaml.v3 通常为 map[interface{}]interface{}）。
-		if hc, ok := svc["healthcheck"].(map[string]interface{}); ok {
-			if opts.HealthCheckInterval != "" {
-				hc["interval"] = opts.HealthCheckInterval
-			}
-			if opts.HealthCheckStartPeriod != "" {
-				hc["start_period"] = opts.HealthCheckStartPeriod
-			}
-		}
-		if hc, ok := svc["healthcheck"].(map[interface{}]interface{}); ok {
+		// 覆盖健康检查间隔与启动延迟
+		if hc, ok := toStringMap(svc.Extra["healthcheck"]); ok {
+			hc = copyMap(hc)
 			if opts.HealthCheckInterval != "" {
 				hc["interval"] = opts.HealthCheckInterval
 			}
 			if opts.HealthCheckStartPeriod != "" {
 				hc["start_period"] = opts.HealthCheckStartPeriod
 			}
+			svc.Extra["healthcheck"] = hc
 		}
 	}
 	if !opts.ExposePorts {
-		if ports, ok := svc["ports"]; ok {
-			switch p := ports.(type) {
-			case []interface{}:
-				if len(p) > 0 {
-					var expose []interface{}
-					for _, item := range p {
-						s, _ := item.(string)
-						// "host:container" -> container port; "port" -> port
-						if idx := strings.Index(s, ":"); idx >= 0 {
-							s = s[idx+1:]
-						}
-						if s != "" {
-							expose = append(expose, s)
-						}
-					}
-					if len(expose) > 0 {
-						delete(svc, "ports")
-						svc["expose"] = expose
-					}
-				}
+		// 不暴露端口时改为仅容器内可达的 expose（取各映射的容器端口）
+		var expose []interface{}
+		for _, p := range svc.Ports {
+			target := p.Target
+			if p.Protocol != "" {
+				target += "/" + p.Protocol
 			}
-		}
-	} else {
-		// 暴露端口时，可选覆盖主机端口
-		if ports, ok := svc["ports"].([]interface{}); ok && len(ports) > 0 {
-			var hostPort string
-			switch serviceName {
-			case "herald":
-				hostPort = strings.TrimSpace(opts.PortHerald)
-				if hostPort != "" {
-					ports[0] = hostPort + ":8082"
-				}
-			case "warden":
-				hostPort = strings.TrimSpace(opts.PortWarden)
-				if hostPort != "" {
-					ports[0] = hostPort + ":8081"
-				}
-			case "herald-redis":
-				hostPort = strings.TrimSpace(opts.PortHeraldRedis)
-				if hostPort != "" {
-					ports[0] = hostPort + ":6379"
-				}
-			case "herald-totp":
-				hostPort = strings.TrimSpace(opts.PortHeraldTotp)
-				if hostPort != "" {
-					ports[0] = hostPort + ":8084"
-				}
-			case "herald-smtp":
-				hostPort = strings.TrimSpace(opts.PortHeraldSmtp)
-				if hostPort != "" {
-					ports[0] = hostPort + ":8085"
-				}
-			case "owlmail":
-				hostPort = strings.TrimSpace(opts.PortOwlmail)
-				if hostPort != "" && len(ports) > 1 {
-					ports[1] = hostPort + ":1080"
-				}
+			if target != "" {
+				expose = append(expose, target)
 			}
 		}
+		if len(expose) > 0 {
+			svc.Ports = nil
+			svc.Extra["expose"] = expose
+		}
+	} else if hostPort, idx := hostPortOption(serviceName, opts); hostPort != "" && idx < len(svc.Ports) {
+		// 暴露端口时，可选覆盖主机端口
+		svc.Ports[idx].Published = hostPort
 	}
 	if opts.ContainerNamePrefix != "" {
 		if suffix, ok := serviceNameToContainerSuffix[serviceName]; ok {
-			svc["container_name"] = opts.ContainerNamePrefix + suffix
+			svc.Extra["container_name"] = opts.ContainerNamePrefix + suffix
 		}
 		if serviceName == "stargate" {
 			prefix := opts.ContainerNamePrefix
-			if env, ok := svc["environment"].([]interface{}); ok {
-				for i, e := range env {
-					s, _ := e.(string)
-					if strings.HasPrefix(s, "WARDEN_URL=") {
-						env[i] = "WARDEN_URL=http://" + prefix + "warden:8081"
-					}
-					if strings.HasPrefix(s, "HERALD_URL=") {
-						env[i] = "HERALD_URL=http://" + prefix + "herald:8082"
-					}
-					if strings.HasPrefix(s, "HERALD_TOTP_BASE_URL=") {
-						env[i] = "HERALD_TOTP_BASE_URL=http://" + prefix + "herald-totp:8084"
-					}
-				}
-			}
-			if labels, ok := svc["labels"].([]interface{}); ok {
-				for i, l := range labels {
-					s, _ := l.(string)
-					if strings.Contains(s, "forwardauth.address=http://stargate/_auth") {
-						labels[i] = strings.Replace(s, "http://stargate/_auth", "http://"+prefix+"stargate/_auth", 1)
-					}
+			svc.Environment.Replace("WARDEN_URL", "http://"+prefix+"warden:8081")
+			svc.Environment.Replace("HERALD_URL", "http://"+prefix+"herald:8082")
+			svc.Environment.Replace("HERALD_TOTP_BASE_URL", "http://"+prefix+"herald-totp:8084")
+			svc.Labels.Update(func(key, value string) (string, bool) {
+				if strings.HasSuffix(key, ".forwardauth.address") && strings.HasPrefix(value, "http://stargate/_auth") {
+					return strings.Replace(value, "http://stargate/_auth", "http://"+prefix+"stargate/_auth", 1), true
 				}
-			}
+				return "", false
+			})
 		}
 	}
 	// EnvOverrides 仅用于生成 .env（在 Generate 中合并进 vars），不写入 compose 的 environment，
 	// 以便生成的 compose 保留 ${VAR:-default} 形式，用户通过 .env 覆盖即可生效。
 }
 
-// applyOptionsToCompose 对整份 compose（out）应用 Options：每个服务 applyOptions，并处理 Traefik 网络。
-func applyOptionsToCompose(out map[string]interface{}, opts *Options) {
+// hostPortOption 返回服务可覆盖的主机端口（Options 中的值，未设置为空）及其在 ports 中的下标；通道服务的主机端口见 applyProviders。
+func hostPortOption(serviceName string, opts *Options) (string, int) {
+	switch serviceName {
+	case "herald":
+		return strings.TrimSpace(opts.PortHerald), 0
+	case "warden":
+		return strings.TrimSpace(opts.PortWarden), 0
+	case "herald-redis":
+		return strings.TrimSpace(opts.PortHeraldRedis), 0
+	case "herald-totp":
+		return strings.TrimSpace(opts.PortHeraldTotp), 0
+	}
+	return "", 0
+}
+
+// applyOptionsToCompose 对整份 compose（p）应用 Options：每个服务 applyOptions，并处理 Traefik 网络与 labels。
+func applyOptionsToCompose(p *Project, opts *Options) {
 	if opts == nil {
 		return
 	}
-	services, _ := out["services"].(map[string]interface{})
-	for name, s := range services {
-		svc, _ := s.(map[string]interface{})
-		if svc != nil {
-			applyOptions(svc, name, opts)
-		}
+	for name, svc := range p.Services {
+		applyOptions(svc, name, opts)
 	}
-	networks, _ := out["networks"].(map[string]interface{})
-	if networks == nil {
+	if p.Networks == nil {
 		return
 	}
-	traefikName := "traefik"
-	if opts.TraefikNetworkName != "" {
-		traefikName = opts.TraefikNetworkName
+	traefikName := traefikNetworkName(opts)
+	isTraefik := func(name string) bool { return name == "traefik" || name == traefikName }
+	if opts.TraefikNetwork {
+		for _, svc := range p.Services {
+			applyTraefikLabelOptions(svc, opts)
+		}
 	}
 	if !opts.TraefikNetwork {
-		delete(networks, "traefik")
-		delete(networks, traefikName)
-		if services != nil {
-			for _, name := range []string{"stargate", "protected-service"} {
-				if s, ok := services[name]; ok {
-					svc, _ := s.(map[string]interface{})
-					if svc == nil {
-						continue
-					}
-					if n, ok := svc["networks"]; ok {
-						switch nlist := n.(type) {
-						case []interface{}:
-							var kept []interface{}
-							for _, v := range nlist {
-								s, _ := v.(string)
-								if s != "traefik" && s != traefikName {
-									kept = append(kept, v)
-								}
-							}
-							svc["networks"] = kept
-						}
-					}
-					if name == "stargate" || name == "protected-service" {
-						if labels, ok := svc["labels"].([]interface{}); ok {
-							var kept []interface{}
-							for _, l := range labels {
-								s, _ := l.(string)
-								if !strings.HasPrefix(s, "traefik.") {
-									kept = append(kept, l)
-								}
-							}
-							svc["labels"] = kept
-						}
+		delete(p.Networks, "traefik")
+		delete(p.Networks, traefikName)
+		for _, name := range []string{"stargate", "protected-service"} {
+			svc, ok := p.Services[name]
+			if !ok {
+				continue
+			}
+			if svc.Networks != nil {
+				kept := make([]ServiceNetwork, 0, len(svc.Networks))
+				for _, n := range svc.Networks {
+					if !isTraefik(n.Name) {
+						kept = append(kept, n)
 					}
 				}
+				svc.Networks = kept
 			}
+			svc.Labels.Filter(func(l KeyValue) bool { return !strings.HasPrefix(l.Key, "traefik.") })
 		}
 	} else if traefikName != "traefik" {
-		if v, ok := networks["traefik"]; ok {
-			delete(networks, "traefik")
-			networks[traefikName] = v
+		if v, ok := p.Networks["traefik"]; ok {
+			delete(p.Networks, "traefik")
+			p.Networks[traefikName] = v
 		}
-		if services != nil {
-			for _, name := range []string{"stargate", "protected-service"} {
-				if s, ok := services[name]; ok {
-					svc, _ := s.(map[string]interface{})
-					if svc == nil {
-						continue
-					}
-					if n, ok := svc["networks"].([]interface{}); ok {
-						for i, v := range n {
-							if s, _ := v.(string); s == "traefik" {
-								n[i] = traefikName
-							}
-						}
-					}
-					if labels, ok := svc["labels"].([]interface{}); ok {
-						for i, l := range labels {
-							s, _ := l.(string)
-							if strings.Contains(s, "traefik.docker.network=traefik") {
-								labels[i] = strings.Replace(s, "traefik.docker.network=traefik", "traefik.docker.network="+traefikName, 1)
-							}
-						}
-					}
+		for _, name := range []string{"stargate", "protected-service"} {
+			svc, ok := p.Services[name]
+			if !ok {
+				continue
+			}
+			for i := range svc.Networks {
+				if svc.Networks[i].Name == "traefik" {
+					svc.Networks[i].Name = traefikName
 				}
 			}
+			svc.Labels.Update(func(key, value string) (string, bool) {
+				return traefikName, key == "traefik.docker.network" && value == "traefik"
+			})
 		}
 	}
 }
 
+// traefikNetworkName 返回 Options 中的 Traefik 网络名，默认 "traefik"。
+func traefikNetworkName(opts *Options) string {
+	if opts.TraefikNetworkName != "" {
+		return opts.TraefikNetworkName
+	}
+	return "traefik"
+}
+
+// stargateTotpEnvKeys 为未包含 herald-totp 服务时须从 Stargate environment 中移除的变量。
+var stargateTotpEnvKeys = map[string]bool{
+	"HERALD_TOTP_ENABLED": true, "HERALD_TOTP_BASE_URL": true, "HERALD_TOTP_API_KEY": true, "HERALD_TOTP_HMAC_SECRET": true,
+}
+
 // stripStargateTotpEnvAndDependsOn 从 stargate 服务的 environment 与 depends_on 中移除 HERALD_TOTP_* 与 herald-totp 依赖。
-func stripStargateTotpEnvAndDependsOn(svcs map[string]interface{}) {
-	stargate, ok := svcs["stargate"].(map[string]interface{})
+func stripStargateTotpEnvAndDependsOn(svcs map[string]*Service) {
+	stargate, ok := svcs["stargate"]
 	if !ok {
 		return
 	}
-	if env, ok := stargate["environment"].([]interface{}); ok {
-		var kept []interface{}
-		for _, e := range env {
-			s, _ := e.(string)
-			// Remove all HERALD_TOTP_* from Stargate when herald-totp service is not included
-			if s != "" && !strings.HasPrefix(s, "HERALD_TOTP_ENABLED=") && !strings.HasPrefix(s, "HERALD_TOTP_BASE_URL=") && !strings.HasPrefix(s, "HERALD_TOTP_API_KEY=") && !strings.HasPrefix(s, "HERALD_TOTP_HMAC_SECRET=") {
-				kept = append(kept, e)
-			}
-		}
-		stargate["environment"] = kept
-	}
-	if dep, ok := stargate["depends_on"]; ok {
-		switch d := dep.(type) {
-		case []interface{}:
-			var kept []interface{}
-			for _, v := range d {
-				if s, _ := v.(string); s != "herald-totp" {
-					kept = append(kept, v)
-				}
-			}
-			stargate["depends_on"] = kept
-		case map[string]interface{}:
-			// 使用新 map 避免修改共享的 full，否则后续 mode（如 traefik）会丢失 herald-totp 依赖
-			newDep := make(map[string]interface{}, len(d))
-			for k, v := range d {
-				if k != "herald-totp" {
-					newDep[k] = v
-				}
-			}
-			stargate["depends_on"] = newDep
-		}
-	}
+	stargate.Environment.Filter(func(e KeyValue) bool { return !stargateTotpEnvKeys[e.Key] })
+	stargate.RemoveDependency("herald-totp")
 }
 
 // removeDependsOnService 从指定服务的 depends_on 中移除 target。
-func removeDependsOnService(svcs map[string]interface{}, serviceName, target string) {
-	svc, ok := svcs[serviceName].(map[string]interface{})
-	if !ok {
-		return
-	}
-	dep, ok := svc["depends_on"]
-	if !ok {
-		return
-	}
-	switch d := dep.(type) {
-	case []interface{}:
-		var kept []interface{}
-		for _, v := range d {
-			if s, _ := v.(string); s != target {
-				kept = append(kept, v)
-			}
-		}
-		svc["depends_on"] = kept
-	case map[string]interface{}:
-		delete(d, target)
+func removeDependsOnService(svcs map[string]*Service, serviceName, target string) {
+	if svc, ok := svcs[serviceName]; ok {
+		svc.RemoveDependency(target)
 	}
 }
 
-// injectOwlmailService 向 compose 的 services 中注入 owlmail 服务（本地 SMTP + Web 收件箱，用于测试时捕获邮件）。
-func injectOwlmailService(svcs map[string]interface{}, opts *Options) {
-	prefix := opts.ContainerNamePrefix
-	if prefix == "" {
-		prefix = "the-gate-"
+// keyValues 由 KEY=VALUE 字符串构造 KeyValues（用于注入的服务）。
+func keyValues(items ...string) KeyValues {
+	out := make(KeyValues, 0, len(items))
+	for _, item := range items {
+		k, v, _ := strings.Cut(item, "=")
+		out = append(out, KeyValue{Key: k, Value: &v})
 	}
-	webPort := "1080"
-	if p := strings.TrimSpace(opts.PortOwlmail); p != "" {
-		webPort = p
-	}
-	owlmail := map[string]interface{}{
-		"image":          "ghcr.io/soulteary/owlmail:latest",
-		"container_name": prefix + "owlmail",
-		"ports":          []interface{}{"1025:1025", webPort + ":1080"},
-		"environment": []interface{}{
-			"MAILDEV_SMTP_PORT=1025",
-			"MAILDEV_WEB_PORT=1080",
-			"MAILDEV_WEB_IP=0.0.0.0",
-		},
-		"networks": []interface{}{"the-gate-network"},
-		"healthcheck": map[string]interface{}{
-			"test":         []interface{}{"CMD-SHELL", "wget -q --spider http://localhost:1080/healthz || exit 1"},
-			"interval":     "10s",
-			"timeout":      "3s",
-			"retries":      3,
-			"start_period": "5s",
-		},
-		"restart": "unless-stopped",
-	}
-	svcs["owlmail"] = owlmail
+	return out
 }
 
 // injectStargateRedisService 向 compose 注入 stargate-redis 服务及卷，并为 stargate 服务添加 depends_on。
-// 仅在 mode 为 traefik 或 traefik-stargate 且 opts.StargateSessionRedisUseBuiltin 为 true 时调用。
-func injectStargateRedisService(out map[string]interface{}, opts *Options) {
-	if opts == nil || !opts.StargateSessionRedisUseBuiltin {
-		return
-	}
-	svcs, _ := out["services"].(map[string]interface{})
-	if svcs == nil {
+// 仅在 mode 包含 stargate 且 opts.StargateSessionRedisUseBuiltin 为 true 时调用。
+func injectStargateRedisService(p *Project, opts *Options) {
+	if opts == nil || !opts.StargateSessionRedisUseBuiltin || p.Services == nil {
 		return
 	}
 	prefix := opts.ContainerNamePrefix
 	if prefix == "" {
 		prefix = "the-gate-"
 	}
-	redisImage := "${STARGATE_REDIS_IMAGE:-redis:8.4-alpine}"
-	stargateRedis := map[string]interface{}{
-		"image":          redisImage,
-		"container_name": prefix + "stargate-redis",
-		"expose":         []interface{}{"6379"},
-		"volumes":        []interface{}{"stargate-redis-data:/data"},
-		"networks":       []interface{}{"the-gate-network"},
-		"healthcheck": map[string]interface{}{
-			"test":     []interface{}{"CMD", "redis-cli", "ping"},
-			"interval": "5s",
-			"timeout":  "3s",
-			"retries":  5,
+	p.Services["stargate-redis"] = &Service{
+		Volumes:  []Volume{{Type: "volume", Source: "stargate-redis-data", Target: "/data"}},
+		Networks: []ServiceNetwork{{Name: "the-gate-network"}},
+		Extra: map[string]interface{}{
+			"image":          "${STARGATE_REDIS_IMAGE:-redis:8.4-alpine}",
+			"container_name": prefix + "stargate-redis",
+			"expose":         []interface{}{"6379"},
+			"healthcheck": map[string]interface{}{
+				"test":     []interface{}{"CMD", "redis-cli", "ping"},
+				"interval": "5s",
+				"timeout":  "3s",
+				"retries":  5,
+			},
+			"restart": "unless-stopped",
 		},
-		"restart": "unless-stopped",
 	}
-	svcs["stargate-redis"] = stargateRedis
-
-	volumes, _ := out["volumes"].(map[string]interface{})
-	if volumes == nil {
-		volumes = make(map[string]interface{})
-		out["volumes"] = volumes
+	if p.Volumes == nil {
+		p.Volumes = make(map[string]interface{})
 	}
-	volumes["stargate-redis-data"] = map[string]interface{}{"driver": "local"}
+	p.Volumes["stargate-redis-data"] = map[string]interface{}{"driver": "local"}
 
 	// stargate 依赖 stargate-redis
-	if stargate, ok := svcs["stargate"].(map[string]interface{}); ok {
-		depMap := make(map[string]interface{})
-		if dep, ok := stargate["depends_on"]; ok {
-			switch d := dep.(type) {
-			case map[string]interface{}:
-				for k, v := range d {
-					depMap[k] = v
-				}
-			case map[interface{}]interface{}:
-				for k, v := range d {
-					if s, ok := k.(string); ok {
-						depMap[s] = v
-					}
-				}
-			case []interface{}:
-				for _, v := range d {
-					if s, ok := v.(string); ok {
-						depMap[s] = map[string]interface{}{"condition": "service_healthy"}
-					}
-				}
-			}
-		}
-		depMap["stargate-redis"] = map[string]interface{}{"condition": "service_healthy"}
-		stargate["depends_on"] = depMap
-	}
-}
-
-// patchHeraldSmtpForOwlmail 将 herald-smtp 的 SMTP 配置改为指向 owlmail，并增加 depends_on: owlmail。
-func patchHeraldSmtpForOwlmail(svcs map[string]interface{}) {
-	heraldSmtp, ok := svcs["herald-smtp"].(map[string]interface{})
-	if !ok {
-		return
-	}
-	owlmailEnv := map[string]string{
-		"SMTP_HOST":         "owlmail",
-		"SMTP_PORT":         "1025",
-		"SMTP_USE_STARTTLS": "false",
-		"SMTP_USER":         "",
-		"SMTP_PASSWORD":     "",
-		"SMTP_FROM":         "noreply@test.local",
-	}
-	if envList, ok := heraldSmtp["environment"].([]interface{}); ok {
-		used := make(map[string]bool)
-		var newList []interface{}
-		for _, e := range envList {
-			s, _ := e.(string)
-			if idx := strings.Index(s, "="); idx >= 0 {
-				key := strings.TrimSpace(s[:idx])
-				if v, ok := owlmailEnv[key]; ok {
-					newList = append(newList, key+"="+v)
-					used[key] = true
-				} else {
-					newList = append(newList, s)
-				}
-			} else {
-				newList = append(newList, e)
-			}
-		}
-		for k, v := range owlmailEnv {
-			if !used[k] {
-				newList = append(newList, k+"="+v)
-			}
-		}
-		heraldSmtp["environment"] = newList
-	}
-	if dep, ok := heraldSmtp["depends_on"]; ok {
-		switch d := dep.(type) {
-		case []interface{}:
-			heraldSmtp["depends_on"] = append(d, "owlmail")
-		default:
-			heraldSmtp["depends_on"] = []interface{}{dep, "owlmail"}
-		}
-	} else {
-		heraldSmtp["depends_on"] = []interface{}{"owlmail"}
+	if stargate, ok := p.Services["stargate"]; ok {
+		stargate.AddDependency("stargate-redis", "service_healthy")
 	}
 }
 
-func applyStargateSplitOverrides(svc map[string]interface{}, containerNamePrefix string) {
+func applyStargateSplitOverrides(svc *Service, containerNamePrefix string) {
 	prefix := containerNamePrefix
 	if prefix == "" {
 		prefix = "the-gate-"
 	}
-	delete(svc, "depends_on")
-	if env, ok := svc["environment"].([]interface{}); ok {
-		for i, e := range env {
-			s, _ := e.(string)
-			if s == "WARDEN_URL=http://warden:8081" {
-				env[i] = "WARDEN_URL=http://" + prefix + "warden:8081"
-			}
-			if s == "HERALD_URL=http://herald:8082" {
-				env[i] = "HERALD_URL=http://" + prefix + "herald:8082"
-			}
-			if strings.HasPrefix(s, "HERALD_TOTP_BASE_URL=") {
-				env[i] = "HERALD_TOTP_BASE_URL=http://" + prefix + "herald-totp:8084"
-			}
-		}
-	}
-	if labels, ok := svc["labels"].([]interface{}); ok {
-		for i, l := range labels {
-			s, _ := l.(string)
-			if s == "traefik.http.middlewares.stargate-auth.forwardauth.address=http://stargate/_auth" {
-				labels[i] = "traefik.http.middlewares.stargate-auth.forwardauth.address=http://" + prefix + "stargate/_auth"
-			}
+	svc.DependsOn = nil
+	svc.Environment.Update(func(key, value string) (string, bool) {
+		switch {
+		case key == "WARDEN_URL" && value == "http://warden:8081":
+			return "http://" + prefix + "warden:8081", true
+		case key == "HERALD_URL" && value == "http://herald:8082":
+			return "http://" + prefix + "herald:8082", true
+		case key == "HERALD_TOTP_BASE_URL":
+			return "http://" + prefix + "herald-totp:8084", true
 		}
+		return "", false
+	})
+	svc.Labels.Update(func(key, value string) (string, bool) {
+		return "http://" + prefix + "stargate/_auth", key == "traefik.http.middlewares.stargate-auth.forwardauth.address" && value == "http://stargate/_auth"
+	})
+}
+
+// encodeCompose 序列化 compose（见 encodeLayout），带上 .env 注释并加上文件头 header。
+func encodeCompose(out map[string]interface{}, header string, layout *yaml.Node, meta *EnvMeta) ([]byte, error) {
+	outData, err := encodeLayout(out, layout, getComments(meta))
+	if err != nil {
+		return nil, err
 	}
+	return append([]byte(header), outData...), nil
 }
 
-// generateImageOrBuild 生成 image 或 build 模式的 compose：仅核心服务 + the-gate-network（bridge），无 Traefik；build 模式将 herald/warden/stargate 的 image 替换为 build。meta 用于 .env 注释映射。
-func generateImageOrBuild(full map[string]interface{}, mode string, opts *Options, meta *EnvMeta) ([]byte, error) {
-	services, _ := full["services"].(map[string]interface{})
-	if services == nil {
-		return nil, fmt.Errorf("compose missing services")
+// GenerateOne 根据 mode 从完整 compose 生成一份 compose YAML；opts 为 nil 时使用默认行为。保留用于兼容，无 meta 时使用内置注释。
+func GenerateOne(full map[string]interface{}, mode string, opts *Options) ([]byte, error) {
+	yml, _, err := generateOneImpl(&Source{Compose: full}, mode, opts, nil, "")
+	return yml, err
+}
+
+// generateOneImpl 实现 GenerateOne 逻辑；src.Layout、src.Modes 可选（见 Source）；meta 可选，用于注释与 .env 顺序；
+// envOverride 为 .env 内容，k8s/swarm/secrets 文件据此解析变量实际值。
+// 第二个返回值为需写入 build/<mode>/ 的附加文件（相对路径 -> 内容），仅 Options.SecretsFiles、TraefikDynamicFile、注入了内置 Traefik 或 swarm 挂载了 secrets 时非空。
+func generateOneImpl(src *Source, mode string, opts *Options, meta *EnvMeta, envOverride string) ([]byte, map[string][]byte, error) {
+	if services, _ := src.Compose["services"].(map[string]interface{}); services == nil {
+		return nil, nil, fmt.Errorf("compose missing services")
 	}
-	volumes, _ := full["volumes"].(map[string]interface{})
-	out := make(map[string]interface{})
-	outSvcs := make(map[string]interface{})
-	for _, name := range imageBuildServices {
-		if svc, ok := services[name]; ok {
-			svcMap, _ := svc.(map[string]interface{})
-			if svcMap != nil {
-				outSvcs[name] = copyMap(svcMap)
-			} else {
-				outSvcs[name] = svc
-			}
-		}
+
+	switch mode {
+	case "k8s":
+		// k8s 模式：以全量 traefik 的服务集合为基础转换为 Kubernetes 清单
+		yml, err := generateK8s(src, opts, meta, envOverride)
+		return yml, nil, err
+	case "swarm":
+		// swarm 模式：全量 traefik 服务转换为 docker stack deploy 可用的 stack 文件
+		return generateSwarm(src, opts, meta, envOverride)
+	}
+	def, err := src.modeDef(mode)
+	if err != nil {
+		return nil, nil, err
 	}
-	out["services"] = outSvcs
-	// image/build 不包含 herald-totp 服务，必须从 stargate 的 depends_on 与 environment 中移除 TOTP 相关项，否则 docker compose config 会报 "depends on undefined service herald-totp"
-	stripStargateTotpEnvAndDependsOn(outSvcs)
-	outVol := make(map[string]interface{})
-	for _, vn := range imageBuildVolumes {
-		if v, ok := volumes[vn]; ok {
-			outVol[vn] = v
-		}
+	out, err := buildSplitCompose(src, def, opts)
+	if err != nil {
+		return nil, nil, err
 	}
-	out["volumes"] = outVol
-	out["networks"] = map[string]interface{}{
-		"the-gate-network": map[string]interface{}{"driver": "bridge"},
+	var files map[string][]byte
+	if opts != nil && opts.SecretsFiles {
+		files = applySecretsFiles(out, opts, resolvedEnvVars(src, opts, envOverride))
 	}
-	if opts == nil {
-		opts = &Options{}
-	}
-	optsCopy := *opts
-	optsCopy.TraefikNetwork = false
-	applyOptionsToCompose(out, &optsCopy)
-	if !optsCopy.UseNamedVolume {
-		applyRedisBindPaths(out, &optsCopy)
-	}
-	if mode == "build" {
-		svcs, _ := out["services"].(map[string]interface{})
-		if svcs != nil {
-			for name, bc := range buildContexts {
-				if svc, ok := svcs[name].(map[string]interface{}); ok {
-					delete(svc, "image")
-					svc["build"] = map[string]interface{}{
-						"context":    bc.Context,
-						"dockerfile": bc.Dockerfile,
-					}
-				}
-			}
+	if opts != nil && (opts.TraefikDynamicFile || opts.BundledTraefik) {
+		traefikFiles, err := applyTraefikFiles(out, opts, resolvedEnvVars(src, opts, envOverride))
+		if err != nil {
+			return nil, nil, err
+		}
+		if files == nil && len(traefikFiles) > 0 {
+			files = make(map[string][]byte)
+		}
+		for k, v := range traefikFiles {
+			files[k] = v
 		}
 	}
-	var buf bytes.Buffer
-	enc := yaml.NewEncoder(&buf)
-	enc.SetIndent(2)
-	if err := enc.Encode(out); err != nil {
-		return nil, err
-	}
-	outData := buf.Bytes()
-	if bytes.HasPrefix(outData, []byte("---\n")) {
-		outData = outData[4:]
+	yml, err := encodeCompose(out.Map(), def.headerComment(), src.Layout, meta)
+	if err != nil {
+		return nil, nil, err
 	}
-	outData = injectEnvComments(outData, getComments(meta))
-	header := splitComposeComment(mode)
-	return append([]byte(header), outData...), nil
+	return yml, files, nil
 }
 
-// GenerateOne 根据 mode 从完整 compose 生成一份 compose YAML；opts 为 nil 时使用默认行为。保留用于兼容，无 meta 时使用内置注释。
-func GenerateOne(full map[string]interface{}, mode string, opts *Options) ([]byte, error) {
-	return generateOneImpl(full, mode, opts, nil)
-}
-
-// generateOneImpl 实现 GenerateOne 逻辑；meta 可选，用于注释与 .env 顺序。
-func generateOneImpl(full map[string]interface{}, mode string, opts *Options, meta *EnvMeta) ([]byte, error) {
-	services, _ := full["services"].(map[string]interface{})
-	if services == nil {
+// buildSplitCompose 按 mode 定义 def 切分完整 compose（含 source.Providers 中的通道服务）并应用 Options，返回未序列化的 Project。
+// 可选服务的增删按 mode 中实际包含的服务处理，与 mode 名无关（如自定义的 traefik-herald-warden 同样受 smtpEnabled 等控制）。
+func buildSplitCompose(source *Source, def *ModeDef, opts *Options) (*Project, error) {
+	src, err := ProjectFromMap(source.composeWithProviders())
+	if err != nil {
+		return nil, err
+	}
+	if src.Services == nil {
 		return nil, fmt.Errorf("compose missing services")
 	}
-	volumes, _ := full["volumes"].(map[string]interface{})
 	prefix := "the-gate-"
 	if opts != nil && opts.ContainerNamePrefix != "" {
 		prefix = opts.ContainerNamePrefix
 	}
 
-	// image / build 模式：仅核心服务，无 Traefik 网络
-	if mode == "image" || mode == "build" {
-		return generateImageOrBuild(full, mode, opts, meta)
-	}
-
-	var def *splitDef
-	for i := range traefikSplitDefs {
-		if traefikSplitDefs[i].name == mode {
-			def = &traefikSplitDefs[i]
-			break
-		}
-	}
-	if def == nil {
-		return nil, fmt.Errorf("unknown mode: %s", mode)
-	}
-
-	out := make(map[string]interface{})
-	if def.services == nil {
-		// 全量 traefik；若需应用 opts 则复制避免污染 full
-		if opts != nil {
-			out["services"] = copyServices(services)
-			out["volumes"] = full["volumes"]
-			if n, _ := full["networks"].(map[string]interface{}); n != nil {
-				out["networks"] = copyMap(n)
-			} else {
-				out["networks"] = full["networks"]
-			}
-		} else {
-			out["services"] = full["services"]
-			out["volumes"] = full["volumes"]
-			out["networks"] = full["networks"]
-		}
+	// ProjectFromMap 已复制服务与顶层 networks / volumes，修改不影响 full
+	out := &Project{}
+	if len(def.Services) == 0 {
+		out.Services = src.Services
+		out.Volumes = src.Volumes
 	} else {
-		outSvcs := make(map[string]interface{})
-		for _, name := range def.services {
-			if svc, ok := services[name]; ok {
-				svcMap, _ := svc.(map[string]interface{})
-				if svcMap == nil {
-					outSvcs[name] = svc
-					continue
-				}
-				clone := copyMap(svcMap)
-				if def.stargateOverrides && name == "stargate" {
-					applyStargateSplitOverrides(clone, prefix)
-				}
-				outSvcs[name] = clone
+		out.Services = make(map[string]*Service)
+		for _, name := range def.Services {
+			if svc, ok := src.Services[name]; ok {
+				out.Services[name] = svc
 			}
 		}
-		out["services"] = outSvcs
-		if len(def.volumes) > 0 && volumes != nil {
-			outVol := make(map[string]interface{})
-			for _, vn := range def.volumes {
-				if v, ok := volumes[vn]; ok {
-					outVol[vn] = v
+		if len(def.Volumes) > 0 && src.Volumes != nil {
+			out.Volumes = make(map[string]interface{})
+			for _, vn := range def.Volumes {
+				if v, ok := src.Volumes[vn]; ok {
+					out.Volumes[vn] = v
 				}
 			}
-			out["volumes"] = outVol
 		}
-		outNet := make(map[string]interface{})
-		if def.stargateOverrides {
-			outNet["the-gate-network"] = map[string]interface{}{"external": true}
-			outNet["traefik"] = map[string]interface{}{"external": true}
-		} else {
-			outNet["the-gate-network"] = map[string]interface{}{"external": true}
-		}
-		out["networks"] = outNet
 	}
-
-	// 全量 traefik 且未启用 DingTalk 时，从 compose 中移除 herald-dingtalk 服务
-	if mode == "traefik" && opts != nil && !opts.IncludeDingTalk {
-		if svcs, ok := out["services"].(map[string]interface{}); ok {
-			delete(svcs, "herald-dingtalk")
-		}
+	if svc, ok := out.Services["stargate"]; ok && def.RewriteStargateURLs {
+		applyStargateSplitOverrides(svc, prefix)
 	}
-	// 全量 traefik 或 traefik-herald 且未启用 SMTP 时，从 compose 中移除 herald-smtp 服务（opts 为 nil 时视为未启用）
-	if (mode == "traefik" || mode == "traefik-herald") && (opts == nil || !opts.IncludeSmtp) {
-		if svcs, ok := out["services"].(map[string]interface{}); ok {
-			delete(svcs, "herald-smtp")
+	switch def.Network {
+	case ModeNetworkExternal:
+		out.Networks = map[string]interface{}{"the-gate-network": map[string]interface{}{"external": true}}
+		if usesNetwork(out.Services, "traefik") {
+			out.Networks["traefik"] = map[string]interface{}{"external": true}
 		}
-	}
-	// 启用 SMTP 且搭配 OwlMail 测试时：注入 owlmail 服务，并让 herald-smtp 指向其 SMTP（本地测试，无需真实邮件服务器）
-	if (mode == "traefik" || mode == "traefik-herald") && opts != nil && opts.IncludeSmtp && opts.UseOwlmailForSmtp {
-		if svcs, ok := out["services"].(map[string]interface{}); ok {
-			injectOwlmailService(svcs, opts)
-			patchHeraldSmtpForOwlmail(svcs)
+	case ModeNetworkBridge:
+		out.Networks = map[string]interface{}{"the-gate-network": map[string]interface{}{"driver": "bridge"}}
+		// 不接入 Traefik：按 TraefikNetwork=false 应用 Options（opts 为 nil 时同零值 Options）
+		optsCopy := Options{}
+		if opts != nil {
+			optsCopy = *opts
 		}
+		optsCopy.TraefikNetwork = false
+		opts = &optsCopy
+	default:
+		out.Networks = src.Networks
 	}
-	// 全量 traefik 或 traefik-herald 且未启用 TOTP 时，从 compose 中移除 herald-totp 服务，并从 stargate 环境变量与 depends_on 中移除相关项
-	if (mode == "traefik" || mode == "traefik-herald") && (opts == nil || !opts.IncludeTotp) {
-		if svcs, ok := out["services"].(map[string]interface{}); ok {
-			delete(svcs, "herald-totp")
-			stripStargateTotpEnvAndDependsOn(svcs)
-		}
+	svcs := out.Services
+
+	// Herald 通道：移除未启用的通道服务，启用的按需注入 mock（如 SMTP 搭配 OwlMail，无需真实邮件服务器）
+	if err := applyProviders(out, src.Services, source.Providers, opts, prefix); err != nil {
+		return nil, err
 	}
-	// traefik-stargate 且未启用 TOTP 时，仅从 stargate 环境变量与 depends_on 中移除 TOTP 相关项（该 split 本身不含 herald-totp 服务）
-	if mode == "traefik-stargate" && (opts == nil || !opts.IncludeTotp) {
-		if svcs, ok := out["services"].(map[string]interface{}); ok {
-			stripStargateTotpEnvAndDependsOn(svcs)
-		}
+	// 未启用 TOTP 时移除 herald-totp 服务，并从 stargate 环境变量与 depends_on 中移除相关项；
+	// 非外部网络的 mode 不含 herald-totp 时同样移除，否则 docker compose config 会报 "depends on undefined service herald-totp"
+	if _, ok := svcs["herald-totp"]; opts == nil || !opts.IncludeTotp || (!ok && def.Network != ModeNetworkExternal) {
+		delete(svcs, "herald-totp")
+		stripStargateTotpEnvAndDependsOn(svcs)
 	}
-	// traefik 或 traefik-stargate 且启用「Stargate 会话 Redis 使用内置容器」时，注入 stargate-redis 服务
-	if (mode == "traefik" || mode == "traefik-stargate") && opts != nil && opts.StargateSessionRedisUseBuiltin {
+	// 启用「Stargate 会话 Redis 使用内置容器」且包含 stargate 时，注入 stargate-redis 服务
+	if _, ok := svcs["stargate"]; ok && opts != nil && opts.StargateSessionRedisUseBuiltin {
 		injectStargateRedisService(out, opts)
 	}
-	// Warden 无 Redis 场景：可选移除 warden-redis 服务（适用于 traefik / traefik-warden）。
-	if opts != nil && opts.DisableWardenRedisService && (mode == "traefik" || mode == "traefik-warden") {
-		if svcs, ok := out["services"].(map[string]interface{}); ok {
-			delete(svcs, "warden-redis")
-			removeDependsOnService(svcs, "warden", "warden-redis")
-		}
-		if vols, ok := out["volumes"].(map[string]interface{}); ok {
-			delete(vols, "warden-redis-data")
-		}
+	// Warden 无 Redis 场景：可选移除 warden-redis 服务与其卷
+	if _, ok := svcs["warden-redis"]; ok && opts != nil && opts.DisableWardenRedisService {
+		delete(svcs, "warden-redis")
+		removeDependsOnService(svcs, "warden", "warden-redis")
+		delete(out.Volumes, "warden-redis-data")
 	}
 
 	applyOptionsToCompose(out, opts)
 
+	// 内置 Traefik：仅在仍有服务接入 Traefik 网络时注入（bridge mode 已按 TraefikNetwork=false 处理）
+	if opts != nil && opts.BundledTraefik && opts.TraefikNetwork {
+		if name := traefikNetworkName(opts); usesNetwork(svcs, name) {
+			injectBundledTraefik(out, opts, prefix, name)
+		}
+	}
+
 	// Redis 数据：命名卷 vs 绑定路径
 	if opts != nil && !opts.UseNamedVolume {
 		applyRedisBindPaths(out, opts)
 	}
-
-	var buf bytes.Buffer
-	enc := yaml.NewEncoder(&buf)
-	enc.SetIndent(2)
-	if err := enc.Encode(out); err != nil {
-		return nil, err
+	for name, bc := range def.Build {
+		if svc, ok := svcs[name]; ok {
+			delete(svc.Extra, "image")
+			svc.Extra["build"] = map[string]interface{}{
+				"context":    bc.Context,
+				"dockerfile": bc.Dockerfile,
+			}
+		}
 	}
-	outData := buf.Bytes()
-	// Encoder 会写入文档起始符 "---\n"，docker-compose 通常不需要，去掉以保持风格一致
-	if bytes.HasPrefix(outData, []byte("---\n")) {
-		outData = outData[4:]
+	return out, nil
+}
+
+// usesNetwork 判断是否有服务加入名为 name 的网络。
+func usesNetwork(svcs map[string]*Service, name string) bool {
+	for _, svc := range svcs {
+		for _, n := range svc.Networks {
+			if n.Name == name {
+				return true
+			}
+		}
 	}
-	outData = injectEnvComments(outData, getComments(meta))
-	header := splitComposeComment(mode)
-	return append([]byte(header), outData...), nil
+	return false
 }
 
 // applyRedisBindPaths 将 herald-redis / warden-redis 的命名卷改为绑定路径，并从顶层 volumes 中移除对应命名卷。
-func applyRedisBindPaths(out map[string]interface{}, opts *Options) {
+func applyRedisBindPaths(p *Project, opts *Options) {
 	defaultHerald := "./data/herald-redis"
 	if opts.HeraldRedisDataPath != "" {
 		defaultHerald = opts.HeraldRedisDataPath
@@ -1329,52 +1010,178 @@ func applyRedisBindPaths(out map[string]interface{}, opts *Options) {
 	if opts.WardenRedisDataPath != "" {
 		defaultWarden = opts.WardenRedisDataPath
 	}
-	services, _ := out["services"].(map[string]interface{})
-	if services != nil {
-		if svc, ok := services["herald-redis"].(map[string]interface{}); ok {
-			svc["volumes"] = []interface{}{"${HERALD_REDIS_DATA_PATH:-" + defaultHerald + "}:/data"}
-		}
-		if svc, ok := services["warden-redis"].(map[string]interface{}); ok {
-			svc["volumes"] = []interface{}{"${WARDEN_REDIS_DATA_PATH:-" + defaultWarden + "}:/data"}
-		}
+	if svc, ok := p.Services["herald-redis"]; ok {
+		svc.Volumes = []Volume{{Type: "bind", Source: "${HERALD_REDIS_DATA_PATH:-" + defaultHerald + "}", Target: "/data"}}
 	}
-	volumes, _ := out["volumes"].(map[string]interface{})
-	if volumes != nil {
-		delete(volumes, "herald-redis-data")
-		delete(volumes, "warden-redis-data")
-		if len(volumes) == 0 {
-			delete(out, "volumes")
+	if svc, ok := p.Services["warden-redis"]; ok {
+		svc.Volumes = []Volume{{Type: "bind", Source: "${WARDEN_REDIS_DATA_PATH:-" + defaultWarden + "}", Target: "/data"}}
+	}
+	if p.Volumes != nil {
+		delete(p.Volumes, "herald-redis-data")
+		delete(p.Volumes, "warden-redis-data")
+		if len(p.Volumes) == 0 {
+			p.Volumes = nil
 		}
 	}
 }
 
 // Generated 表示单次生成结果：多份 compose 与一份 .env。
 type Generated struct {
-	Composes map[string][]byte // mode -> docker-compose.yml 内容
-	Env      []byte            // .env 内容
+	Composes map[string][]byte            // mode -> docker-compose.yml 内容
+	Env      []byte                       // 全部变量的 .env 内容（各 mode 共用的旧格式）
+	Envs     map[string][]byte            // mode -> 仅含该 mode 输出中引用变量的 .env 内容
+	Files    map[string]map[string][]byte // mode -> 相对 build/<mode>/ 的附加文件（如 secrets/herald_api_key）-> 内容；无则为 nil
+	Warnings []string                     // 不阻断生成的提示：EnvOverrides 校验、跨服务密钥不一致（GeneratedSecretIssues）与仍以环境变量传入的密钥（SecretsFiles）
+}
+
+// EnvFor 返回 mode 的 .env 内容；无按 mode 裁剪的结果时回退为 Env。
+func (g *Generated) EnvFor(mode string) []byte {
+	if b, ok := g.Envs[mode]; ok {
+		return b
+	}
+	return g.Env
 }
 
 // Generate 从完整 compose 生成指定 modes 的 compose 与 .env；envOverride 可选覆盖 .env 内容（为空则从 compose 推断）；opts 为 nil 时使用默认；meta 可选，为 nil 时使用内置 order/注释/默认 .env。
+// 输出的键按键名排序；需保持 canonical 的顺序与注释时使用 Source.Generate。
 func Generate(full map[string]interface{}, modes []string, envOverride string, opts *Options, meta *EnvMeta) (*Generated, error) {
+	return generate(&Source{Compose: full}, modes, envOverride, opts, meta)
+}
+
+func generate(src *Source, modes []string, envOverride string, opts *Options, meta *EnvMeta) (*Generated, error) {
 	if err := ValidateOptions(opts); err != nil {
 		return nil, err
 	}
+	if err := validateProviderPorts(src.Providers, opts); err != nil {
+		return nil, err
+	}
+	var overrides map[string]string
+	if envOverride != "" {
+		var err error
+		if overrides, err = ParseDotEnv(envOverride); err != nil {
+			return nil, fmt.Errorf("env override: %w", err)
+		}
+	}
+	out := &Generated{Composes: make(map[string][]byte), Envs: make(map[string][]byte)}
 	if meta != nil && opts != nil && len(opts.EnvOverrides) > 0 {
-		if errs := ValidateEnvOverrides(opts.EnvOverrides, meta.ServiceAllowedEnvKeys()); len(errs) > 0 {
-			for _, e := range errs {
-				fmt.Fprintf(os.Stderr, "validate env: %s\n", e)
+		out.Warnings = ValidateEnvOverrides(opts.EnvOverrides, meta.ServiceAllowedEnvKeys())
+	}
+	for _, mode := range modes {
+		yml, files, err := generateOneImpl(src, mode, opts, meta, envOverride)
+		if err != nil {
+			return nil, err
+		}
+		out.Composes[mode] = yml
+		if len(files) > 0 {
+			if out.Files == nil {
+				out.Files = make(map[string]map[string][]byte)
 			}
+			out.Files[mode] = files
 		}
 	}
-	out := &Generated{Composes: make(map[string][]byte), Env: nil}
+	// 各 mode 的 .env 取值来源：envOverride 为空时为 compose 默认值与 Options 覆盖，否则仅为 envOverride 中的变量（与 Env 一致）
+	vars := envVarsForOptions(src, opts)
+	if envOverride != "" {
+		out.Env = []byte(envOverride)
+		vars = overrides
+	} else {
+		body, err := verifiedEnvBody(vars, meta)
+		if err != nil {
+			return nil, err
+		}
+		out.Env = []byte(body)
+	}
+	if len(out.Env) == 0 {
+		out.Env = []byte(DefaultEnvBody(meta))
+	}
 	for _, mode := range modes {
-		yml, err := generateOneImpl(full, mode, opts, meta)
+		refs, err := modeEnvRefs(src, mode, opts, out.Composes[mode])
 		if err != nil {
 			return nil, err
 		}
-		out.Composes[mode] = yml
+		// envOverride 按原文裁剪，保留用户的注释、引号与书写顺序
+		if envOverride != "" {
+			body, err := FilterDotEnv(envOverride, refs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", mode, err)
+			}
+			out.Envs[mode] = []byte(body)
+			continue
+		}
+		picked := make(map[string]string)
+		for k, v := range vars {
+			if refs[k] {
+				picked[k] = v
+			}
+		}
+		body, err := verifiedEnvBody(picked, meta)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mode, err)
+		}
+		out.Envs[mode] = []byte(body)
+	}
+	// 外部网络的 mode 为同一部署的拆分部分（如 traefik-herald + traefik-stargate），其密钥跨 mode 比较
+	var unit []string
+	for _, mode := range modes {
+		if def := lookupModeDef(src.Modes, mode); def != nil && def.Network == ModeNetworkExternal {
+			unit = append(unit, mode)
+		}
+	}
+	issues, err := GeneratedSecretIssues(out, unit)
+	if err != nil {
+		return nil, err
+	}
+	out.Warnings = append(out.Warnings, issues...)
+	plaintext, err := plaintextSecretWarnings(out, opts)
+	if err != nil {
+		return nil, err
+	}
+	out.Warnings = append(out.Warnings, plaintext...)
+	return out, nil
+}
+
+// verifiedEnvBody 调用 EnvBodyFromVars 并确认结果能被 docker compose 原样读回（引号、转义、$ 替换）。
+func verifiedEnvBody(vars map[string]string, meta *EnvMeta) (string, error) {
+	body := EnvBodyFromVars(vars, "", meta)
+	if err := VerifyDotEnv(body, vars); err != nil {
+		return "", err
+	}
+	return body, nil
+}
+
+// modeEnvRefs 返回 mode 输出引用的变量名：compose/swarm 取自生成的 YAML；k8s 清单中已无变量引用，取其转换来源（traefik 服务集合）。
+func modeEnvRefs(src *Source, mode string, opts *Options, yml []byte) (map[string]bool, error) {
+	if mode == "k8s" {
+		def, err := src.modeDef("traefik")
+		if err != nil {
+			return nil, err
+		}
+		out, err := buildSplitCompose(src, def, opts)
+		if err != nil {
+			return nil, err
+		}
+		return EnvRefs(out.Map()), nil
+	}
+	compose, err := ParseCompose(yml)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", mode, err)
 	}
-	vars := ExtractEnvVars(full)
+	return EnvRefs(compose), nil
+}
+
+// resolvedEnvVars 返回各变量的实际值：compose 默认值与 Options 覆盖（envVarsForOptions），再叠加 envOverride（.env 内容）。
+func resolvedEnvVars(src *Source, opts *Options, envOverride string) map[string]string {
+	vars := envVarsForOptions(src, opts)
+	overrides, _ := ParseDotEnv(envOverride)
+	for k, v := range overrides {
+		vars[k] = v
+	}
+	return vars
+}
+
+// envVarsForOptions 从 compose（含通道服务）推断 .env 变量并按 Options 合并覆盖、移除未启用服务的变量；供 .env 与 k8s ConfigMap/Secret 共用。
+func envVarsForOptions(src *Source, opts *Options) map[string]string {
+	vars := ExtractEnvVars(src.composeWithProviders())
 	if opts != nil && len(opts.EnvOverrides) > 0 {
 		for k, v := range opts.EnvOverrides {
 			vars[k] = v
@@ -1393,32 +1200,7 @@ func Generate(full map[string]interface{}, modes []string, envOverride string, o
 		}
 		vars["WARDEN_REDIS_ENABLED"] = "false"
 	}
-	if opts != nil && !opts.IncludeDingTalk {
-		for _, k := range []string{
-			"HERALD_DINGTALK_IMAGE", "HERALD_DINGTALK_API_URL", "HERALD_DINGTALK_API_KEY",
-			"DINGTALK_APP_KEY", "DINGTALK_APP_SECRET", "DINGTALK_AGENT_ID", "DINGTALK_LOOKUP_MODE",
-			"HERALD_DINGTALK_IDEMPOTENCY_TTL",
-		} {
-			delete(vars, k)
-		}
-	}
-	if opts == nil || !opts.IncludeSmtp {
-		for _, k := range []string{
-			"HERALD_SMTP_IMAGE", "HERALD_SMTP_API_URL", "HERALD_SMTP_API_KEY",
-			"SMTP_HOST", "SMTP_PORT", "SMTP_USER", "SMTP_PASSWORD", "SMTP_FROM", "SMTP_USE_STARTTLS",
-			"HERALD_SMTP_IDEMPOTENCY_TTL",
-		} {
-			delete(vars, k)
-		}
-	}
-	if opts != nil && opts.IncludeSmtp && opts.UseOwlmailForSmtp {
-		vars["SMTP_HOST"] = "owlmail"
-		vars["SMTP_PORT"] = "1025"
-		vars["SMTP_USE_STARTTLS"] = "false"
-		vars["SMTP_USER"] = ""
-		vars["SMTP_PASSWORD"] = ""
-		vars["SMTP_FROM"] = "noreply@test.local"
-	}
+	applyProviderEnvVars(vars, src.Providers, opts)
 	if opts == nil || !opts.IncludeTotp {
 		for _, k := range []string{
 			"HERALD_TOTP_ENABLED", "HERALD_TOTP_BASE_URL", "HERALD_TOTP_API_KEY",
@@ -1428,22 +1210,24 @@ func Generate(full map[string]interface{}, modes []string, envOverride string, o
 			delete(vars, k)
 		}
 	}
-	if envOverride != "" {
-		out.Env = []byte(envOverride)
-	} else {
-		out.Env = []byte(EnvBodyFromVars(vars, "", meta))
-	}
-	if len(out.Env) == 0 {
-		out.Env = []byte(DefaultEnvBody(meta))
+	return vars
+}
+
+// OutputFileName 返回 mode 在 build/<mode>/ 下的清单文件名：k8s 为 k8s.yaml，其余为 docker-compose.yml。
+func OutputFileName(mode string) string {
+	if mode == "k8s" {
+		return "k8s.yaml"
 	}
-	return out, nil
+	return "docker-compose.yml"
 }
 
-// AllTraefikModes 返回所有可由 canonical 生成的 traefik 相关 mode。
+// AllTraefikModes 返回内置 mode 定义（DefaultModeDefs）中接入 Traefik 的 mode。
 func AllTraefikModes() []string {
 	var modes []string
-	for _, d := range traefikSplitDefs {
-		modes = append(modes, d.name)
+	for _, d := range DefaultModeDefs {
+		if d.Network != ModeNetworkBridge {
+			modes = append(modes, d.Name)
+		}
 	}
 	return modes
 }
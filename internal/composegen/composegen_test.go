@@ -1,10 +1,42 @@
 package composegen
 
 import (
-	"gopkg.in/yaml.v3"
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
+
+	"gopkg.in/yaml.v3"
 )
 
+// canonicalComposePath 为仓库中的 canonical compose，供需要完整服务集合的测试与基准加载。
+const canonicalComposePath = "../../compose/canonical/docker-compose.yml"
+
+// loadCanonical 加载 canonical compose，失败时终止测试。
+func loadCanonical(tb testing.TB) *Source {
+	tb.Helper()
+	src, err := LoadSource(canonicalComposePath)
+	if err != nil {
+		tb.Fatalf("LoadSource: %v", err)
+	}
+	return src
+}
+
+// generatedProject 将生成结果中 mode 的 compose 解析为 Project，失败时终止测试。
+func generatedProject(tb testing.TB, gen *Generated, mode string) *Project {
+	tb.Helper()
+	out, err := ParseCompose(gen.Composes[mode])
+	if err != nil {
+		tb.Fatalf("ParseCompose %s: %v", mode, err)
+	}
+	p, err := ProjectFromMap(out)
+	if err != nil {
+		tb.Fatalf("ProjectFromMap %s: %v", mode, err)
+	}
+	return p
+}
+
 // TestGenerateImageOrBuildStargateNoHeraldTotp 确保 image/build 模式下生成的 compose 中 stargate 不依赖 herald-totp，否则 docker compose config 会报错。
 func TestGenerateImageOrBuildStargateNoHeraldTotp(t *testing.T) {
 	full := map[string]interface{}{
@@ -44,9 +76,9 @@ func TestGenerateImageOrBuildStargateNoHeraldTotp(t *testing.T) {
 	}
 
 	for _, mode := range []string{"image", "build"} {
-		yml, err := generateImageOrBuild(full, mode, nil, nil)
+		yml, err := GenerateOne(full, mode, nil)
 		if err != nil {
-			t.Fatalf("generateImageOrBuild(%q): %v", mode, err)
+			t.Fatalf("GenerateOne(%q): %v", mode, err)
 		}
 		var out struct {
 			Services map[string]struct {
@@ -77,3 +109,205 @@ func TestGenerateImageOrBuildStargateNoHeraldTotp(t *testing.T) {
 		}
 	}
 }
+
+func TestGeneratePerModeEnv(t *testing.T) {
+	full := map[string]interface{}{
+		"services": map[string]interface{}{
+			"herald": map[string]interface{}{
+				"image":       "herald:${HERALD_TAG:-test}",
+				"environment": []interface{}{"API_KEY=${HERALD_API_KEY:-test-herald-api-key}", "SMTP_API_KEY=${HERALD_SMTP_API_KEY:-}"},
+			},
+			"warden": map[string]interface{}{
+				"image":       "warden:test",
+				"environment": []interface{}{"API_KEY=${WARDEN_API_KEY:-test-warden-api-key}"},
+			},
+			"stargate": map[string]interface{}{
+				"image":       "stargate:test",
+				"environment": []interface{}{"LOGIN_PAGE_TITLE=${LOGIN_PAGE_TITLE:-Stargate - Login}", "WARDEN_API_KEY=${WARDEN_API_KEY:-test-warden-api-key}"},
+			},
+		},
+	}
+	gen, err := Generate(full, []string{"traefik-warden", "image"}, "", nil, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	warden, _ := ParseDotEnv(string(gen.EnvFor("traefik-warden")))
+	if _, ok := warden["WARDEN_API_KEY"]; !ok || len(warden) != 1 {
+		t.Errorf("traefik-warden .env: want only WARDEN_API_KEY, got %v", warden)
+	}
+	image, _ := ParseDotEnv(string(gen.EnvFor("image")))
+	for _, k := range []string{"HERALD_TAG", "HERALD_API_KEY", "WARDEN_API_KEY", "LOGIN_PAGE_TITLE"} {
+		if _, ok := image[k]; !ok {
+			t.Errorf("image .env missing %s: %v", k, image)
+		}
+	}
+	if shared, _ := ParseDotEnv(string(gen.Env)); len(shared) < len(image) {
+		t.Errorf("shared .env should keep every variable, got %d < %d", len(shared), len(image))
+	}
+
+	// envOverride 按原文裁剪：保留注释与引号，格式错误时报错而非生成残缺的 .env
+	override := "# Warden\n# API key shared with Stargate\nWARDEN_API_KEY='k 1'\n\n# Herald\nHERALD_API_KEY=h # inline\nHERALD_TAG=v2\n"
+	if gen, err = Generate(full, []string{"traefik-warden", "image"}, override, nil, nil); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if got, want := string(gen.EnvFor("traefik-warden")), "# Warden\n# API key shared with Stargate\nWARDEN_API_KEY='k 1'\n"; got != want {
+		t.Errorf("traefik-warden .env from override = %q, want %q", got, want)
+	}
+	if got := string(gen.EnvFor("image")); got != override {
+		t.Errorf("image .env from override = %q, want the override unchanged", got)
+	}
+	if _, err := Generate(full, []string{"image"}, "WARDEN_API_KEY=k\nNOT A LINE\n", nil, nil); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("invalid envOverride: err = %v, want a parse error", err)
+	}
+}
+
+// TestGenerateConcurrentSharedSource 以不同 Options 并发调用同一份已缓存 Source 的 Generate（如并发的 /api/generate），
+// 结果须与串行调用一致且源 compose 不被修改；配合 go test -race 检查数据竞争。
+func TestGenerateConcurrentSharedSource(t *testing.T) {
+	src, err := ParseSource([]byte(`
+services:
+  herald:
+    image: herald:test
+    container_name: the-gate-herald
+    ports:
+      - "8082:8082"
+    environment:
+      - API_KEY=${HERALD_API_KEY:-test-herald-api-key}
+    depends_on:
+      herald-redis:
+        condition: service_healthy
+    networks:
+      - the-gate-network
+    healthcheck:
+      test: ["CMD", "true"]
+      interval: 10s
+  herald-redis:
+    image: redis:test
+    volumes:
+      - herald-redis-data:/data
+    networks:
+      - the-gate-network
+  warden:
+    image: warden:test
+    environment:
+      - REDIS=${WARDEN_REDIS_ADDR:-warden-redis:6379}
+    depends_on:
+      warden-redis:
+        condition: service_healthy
+    volumes:
+      - ./data.json:/app/data.json:ro
+    networks:
+      - the-gate-network
+  warden-redis:
+    image: redis:test
+    volumes:
+      - warden-redis-data:/data
+    networks:
+      - the-gate-network
+  stargate:
+    image: stargate:test
+    ports: []
+    environment:
+      - WARDEN_URL=${WARDEN_URL:-http://warden:8081}
+      - HERALD_TOTP_BASE_URL=${HERALD_TOTP_BASE_URL:-http://herald-totp:8084}
+    depends_on:
+      warden:
+        condition: service_healthy
+    networks:
+      - the-gate-network
+      - traefik
+    labels:
+      - "traefik.docker.network=traefik"
+      - "traefik.http.middlewares.stargate-auth.forwardauth.address=http://stargate/_auth"
+volumes:
+  herald-redis-data:
+  warden-redis-data:
+networks:
+  the-gate-network:
+    name: the-gate-network
+  traefik:
+    external: true
+`))
+	if err != nil {
+		t.Fatalf("ParseSource: %v", err)
+	}
+	before, _ := yaml.Marshal(src.Compose)
+	modes := []string{"image", "build", "traefik", "traefik-herald", "traefik-warden", "traefik-stargate", "swarm", "k8s"}
+	variants := []*Options{
+		nil,
+		{HealthCheck: true, TraefikNetwork: true, ExposePorts: true, UseNamedVolume: true},
+		{HealthCheckInterval: "5s", HealthCheck: true, TraefikNetworkName: "edge", TraefikNetwork: true, ContainerNamePrefix: "x-", PortHerald: "9082", DisableWardenRedisService: true},
+		{ExposePorts: false, StargateSessionRedisUseBuiltin: true, SecretsFiles: true, HeraldRedisDataPath: "./redis"},
+	}
+	want := make([]*Generated, len(variants))
+	for i, opts := range variants {
+		if want[i], err = src.Generate(modes, "", opts, nil); err != nil {
+			t.Fatalf("Generate variant %d: %v", i, err)
+		}
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8*len(variants))
+	for n := 0; n < 8; n++ {
+		for i, opts := range variants {
+			wg.Add(1)
+			go func(i int, opts *Options) {
+				defer wg.Done()
+				got, err := src.Generate(modes, "", opts, nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				for _, mode := range modes {
+					if !bytes.Equal(got.Composes[mode], want[i].Composes[mode]) || !bytes.Equal(got.EnvFor(mode), want[i].EnvFor(mode)) {
+						errs <- fmt.Errorf("variant %d mode %s differs from the sequential result", i, mode)
+						return
+					}
+				}
+			}(i, opts)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if after, _ := yaml.Marshal(src.Compose); !bytes.Equal(before, after) {
+		t.Errorf("Generate modified the source compose:\n%s", after)
+	}
+}
+
+// 以下基准对比 serve 每个请求从磁盘读取 canonical 与 env-meta（旧行为）与复用已解析快照的开销：
+// go test -bench Generate -benchmem ./internal/composegen
+const benchEnvMetaPath = "../../config/env-meta.yaml"
+
+var benchModes = []string{"traefik", "traefik-herald", "traefik-warden", "traefik-stargate"}
+
+func BenchmarkGenerateLoadPerRequest(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		src, err := LoadSource(canonicalComposePath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		meta, err := LoadEnvMeta(benchEnvMetaPath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := src.Generate(benchModes, "", nil, meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateCachedSnapshot(b *testing.B) {
+	src := loadCanonical(b)
+	meta, err := LoadEnvMeta(benchEnvMetaPath)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := src.Generate(benchModes, "", nil, meta); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
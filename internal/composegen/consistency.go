@@ -0,0 +1,143 @@
+package composegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ServiceEnvRef 指某服务 environment 中的一个变量。
+type ServiceEnvRef struct {
+	Service string
+	Env     string
+}
+
+func (r ServiceEnvRef) String() string { return r.Service + " " + r.Env }
+
+// secretPairs 为须跨服务取相同值的密钥：调用方持有的密钥须与被调用服务的配置一致，否则鉴权或签名校验失败。
+var secretPairs = [][2]ServiceEnvRef{
+	{{"stargate", "HERALD_API_KEY"}, {"herald", "API_KEY"}},
+	{{"stargate", "HERALD_HMAC_SECRET"}, {"herald", "HMAC_SECRET"}},
+	{{"stargate", "WARDEN_API_KEY"}, {"warden", "API_KEY"}},
+	{{"stargate", "HERALD_TOTP_API_KEY"}, {"herald-totp", "API_KEY"}},
+	{{"stargate", "HERALD_TOTP_HMAC_SECRET"}, {"herald-totp", "HMAC_SECRET"}},
+	{{"herald", "HERALD_DINGTALK_API_KEY"}, {"herald-dingtalk", "API_KEY"}},
+	{{"herald", "HERALD_SMTP_API_KEY"}, {"herald-smtp", "API_KEY"}},
+}
+
+// ServiceEnv 解析 compose 中各服务的实际环境变量：environment 中的变量引用按 vars 经 Interpolate 替换
+// （无法解析的值保留原文），返回 服务名 -> 变量名 -> 值。
+func ServiceEnv(compose map[string]interface{}, vars map[string]string) map[string]map[string]string {
+	out := make(map[string]map[string]string)
+	services, _ := compose["services"].(map[string]interface{})
+	lookup := MapLookup(vars)
+	interpolate := func(s string) string {
+		v, err := Interpolate(s, lookup)
+		if err != nil {
+			return s
+		}
+		return v
+	}
+	for name, s := range services {
+		svc, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		env := make(map[string]string)
+		switch e := svc["environment"].(type) {
+		case []interface{}:
+			for _, item := range e {
+				str, _ := item.(string)
+				if idx := strings.Index(str, "="); idx > 0 {
+					env[str[:idx]] = interpolate(str[idx+1:])
+				}
+			}
+		case map[string]interface{}:
+			for k, v := range e {
+				if v == nil {
+					env[k] = ""
+					continue
+				}
+				env[k] = interpolate(fmt.Sprint(v))
+			}
+		}
+		out[name] = env
+	}
+	return out
+}
+
+// CheckSecretConsistency 按 secretPairs 检查 serviceEnv 中两侧服务的值是否一致，返回不一致项（不含密钥值）；
+// 任一侧服务不存在或未声明该变量时跳过（如未启用 herald-totp）。
+func CheckSecretConsistency(serviceEnv map[string]map[string]string) []string {
+	var errs []string
+	for _, pair := range secretPairs {
+		a, okA := serviceEnv[pair[0].Service][pair[0].Env]
+		b, okB := serviceEnv[pair[1].Service][pair[1].Env]
+		if !okA || !okB || a == b {
+			continue
+		}
+		errs = append(errs, fmt.Sprintf("secret mismatch: %s and %s must be equal", pair[0], pair[1]))
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// CheckSecretConsistencyAcross 按 secretPairs 逐对检查同一部署的各部分（如拆分 mode 的 build/<mode>/，部分名 -> ServiceEnv）：
+// 两侧服务分别在不同部分时比较其值，结果与 parts 的遍历顺序无关；同一部分内的不一致由 CheckSecretConsistency 报告，此处不重复。
+func CheckSecretConsistencyAcross(parts map[string]map[string]map[string]string) []string {
+	var errs []string
+	for _, pair := range secretPairs {
+		for nameA, envA := range parts {
+			a, ok := envA[pair[0].Service][pair[0].Env]
+			if !ok {
+				continue
+			}
+			for nameB, envB := range parts {
+				b, ok := envB[pair[1].Service][pair[1].Env]
+				if nameA == nameB || !ok || a == b {
+					continue
+				}
+				errs = append(errs, fmt.Sprintf("secret mismatch: %s %s and %s %s must be equal", nameA, pair[0], nameB, pair[1]))
+			}
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// GeneratedSecretIssues 检查生成结果中跨服务共享的密钥：各 mode 以其 compose 与该 mode 的 .env（EnvFor）解析服务实际环境变量后
+// 单独检查，unit 中的 mode（同一部署的拆分部分，如 traefik-herald、traefik-stargate）再逐对跨 mode 检查；非 compose 输出（k8s）跳过。
+func GeneratedSecretIssues(g *Generated, unit []string) ([]string, error) {
+	modes := make([]string, 0, len(g.Composes))
+	for m := range g.Composes {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+	inUnit := make(map[string]bool, len(unit))
+	for _, m := range unit {
+		inUnit[m] = true
+	}
+	var issues []string
+	parts := make(map[string]map[string]map[string]string)
+	for _, mode := range modes {
+		if OutputFileName(mode) != "docker-compose.yml" {
+			continue
+		}
+		compose, err := ParseCompose(g.Composes[mode])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mode, err)
+		}
+		vars, err := ParseDotEnv(string(g.EnvFor(mode)))
+		if err != nil {
+			return nil, fmt.Errorf("%s .env: %w", mode, err)
+		}
+		env := ServiceEnv(compose, vars)
+		for _, e := range CheckSecretConsistency(env) {
+			issues = append(issues, mode+": "+e)
+		}
+		if inUnit[mode] {
+			parts[mode] = env
+		}
+	}
+	return append(issues, CheckSecretConsistencyAcross(parts)...), nil
+}
@@ -0,0 +1,74 @@
+package composegen
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestCheckSecretConsistency 确保分别编辑的拆分模式 .env 中共享密钥不一致时被报告，一致或一侧服务缺失时不报告。
+func TestCheckSecretConsistency(t *testing.T) {
+	herald := map[string]interface{}{"services": map[string]interface{}{
+		"herald": map[string]interface{}{"environment": []interface{}{
+			"API_KEY=${HERALD_API_KEY:-test-herald-api-key}",
+			"HMAC_SECRET=${HERALD_HMAC_SECRET:-test-hmac-secret}",
+		}},
+	}}
+	stargate := map[string]interface{}{"services": map[string]interface{}{
+		"stargate": map[string]interface{}{"environment": map[string]interface{}{
+			"HERALD_API_KEY":     "${HERALD_API_KEY:-test-herald-api-key}",
+			"HERALD_HMAC_SECRET": "${HERALD_HMAC_SECRET:-test-hmac-secret}",
+			"WARDEN_API_KEY":     "${WARDEN_API_KEY:-test-warden-api-key}",
+		}},
+	}}
+	same := map[string]map[string]map[string]string{"h": ServiceEnv(herald, nil), "s": ServiceEnv(stargate, nil)}
+	if errs := CheckSecretConsistencyAcross(same); len(errs) != 0 {
+		t.Errorf("defaults should be consistent, got %v", errs)
+	}
+	edited := map[string]map[string]map[string]string{"h": ServiceEnv(herald, map[string]string{"HERALD_API_KEY": "rotated"}), "s": ServiceEnv(stargate, nil)}
+	errs := CheckSecretConsistencyAcross(edited)
+	if len(errs) != 1 || !strings.Contains(errs[0], "s stargate HERALD_API_KEY and h herald API_KEY") {
+		t.Errorf("want one HERALD_API_KEY mismatch, got %v", errs)
+	}
+	if strings.Contains(strings.Join(errs, ""), "rotated") {
+		t.Errorf("mismatch report must not contain secret values: %v", errs)
+	}
+	merged := ServiceEnv(herald, map[string]string{"HERALD_API_KEY": "rotated"})
+	merged["stargate"] = ServiceEnv(stargate, nil)["stargate"]
+	if errs := CheckSecretConsistency(merged); len(errs) != 1 {
+		t.Errorf("want one mismatch within a single compose, got %v", errs)
+	}
+}
+
+// TestGeneratedSecretIssues 确保生成结果按各 mode 的 compose 与 .env 检查密钥：拆分模式的 .env 分别编辑后不一致时被报告，
+// 生成时的不一致项写入 Generated.Warnings。
+func TestGeneratedSecretIssues(t *testing.T) {
+	src := loadCanonical(t)
+	modes := []string{"traefik-herald", "traefik-stargate", "image"}
+	gen, err := src.Generate(modes, "", nil, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if len(gen.Warnings) != 0 {
+		t.Errorf("defaults should be consistent, got %v", gen.Warnings)
+	}
+	gen.Envs["traefik-herald"] = append(gen.Envs["traefik-herald"], "HERALD_API_KEY=rotated\n"...)
+	issues, err := GeneratedSecretIssues(gen, []string{"traefik-herald", "traefik-stargate"})
+	if err != nil {
+		t.Fatalf("GeneratedSecretIssues: %v", err)
+	}
+	want := []string{"secret mismatch: traefik-stargate stargate HERALD_API_KEY and traefik-herald herald API_KEY must be equal"}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("issues = %v\nwant %v", issues, want)
+	}
+	gen.Envs["image"] = append(gen.Envs["image"], "WARDEN_API_KEY=rotated\n"...)
+	if issues, _ := GeneratedSecretIssues(gen, nil); len(issues) != 0 {
+		t.Errorf("modes outside a unit should not be compared across each other: %v", issues)
+	}
+	// image 中 warden 与 stargate 共用 WARDEN_API_KEY，改 .env 后两侧仍一致；改写单侧 compose 时报告
+	gen.Composes["image"] = bytes.Replace(gen.Composes["image"], []byte("API_KEY=${WARDEN_API_KEY"), []byte("API_KEY=${WARDEN_KEY_RENAMED"), 1)
+	if issues, _ := GeneratedSecretIssues(gen, nil); len(issues) != 1 || !strings.HasPrefix(issues[0], "image: ") {
+		t.Errorf("want one mismatch within image, got %v", issues)
+	}
+}
@@ -0,0 +1,175 @@
+package composegen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DeployRequirements 为某 mode 的输出在部署前需要、但 Generate 不生成的内容，以及实际使用的镜像（供部署包 README / manifest）。
+type DeployRequirements struct {
+	// Networks 为 external: true 的网络名，需在 up 前 docker network create
+	Networks []string `json:"networks,omitempty"`
+	// Files 为相对 build/<mode>/ 的文件（如 warden 挂载的 data.json），不含 Generate 已输出的 secrets 等文件
+	Files []string `json:"files,omitempty"`
+	// Namespace 为 k8s 清单中工作负载所在的 namespace
+	Namespace string `json:"namespace,omitempty"`
+	// ConfigMaps 为 k8s 清单引用的 ConfigMap 名 -> 文件名，需在 apply 后自行创建
+	ConfigMaps map[string]string `json:"configMaps,omitempty"`
+	// Images 为 服务 -> 镜像（已代入 .env）
+	Images map[string]string `json:"images,omitempty"`
+	// Builds 为 build 模式下 服务 -> build context（相对 build/<mode>/）
+	Builds map[string]string `json:"builds,omitempty"`
+}
+
+// Requirements 分析 gen 中 mode 的输出：compose 取 external 网络、相对路径挂载与 configs/secrets 文件、代入 .env 后的镜像；
+// k8s 清单取 subPath 挂载的 ConfigMap 与容器镜像。
+func Requirements(gen *Generated, mode string) (*DeployRequirements, error) {
+	if gen == nil {
+		return nil, fmt.Errorf("no generated output")
+	}
+	data, ok := gen.Composes[mode]
+	if !ok {
+		return nil, fmt.Errorf("mode %s was not generated", mode)
+	}
+	if OutputFileName(mode) != "docker-compose.yml" {
+		return k8sRequirements(data)
+	}
+	resolved, err := ResolveCompose(data, gen.EnvFor(mode))
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", mode, err)
+	}
+	compose, err := ParseCompose(resolved)
+	if err != nil {
+		return nil, err
+	}
+	req := &DeployRequirements{Images: make(map[string]string), Builds: make(map[string]string)}
+	if networks, ok := compose["networks"].(map[string]interface{}); ok {
+		for key, n := range networks {
+			def, _ := n.(map[string]interface{})
+			if ext, _ := def["external"].(bool); !ext {
+				continue
+			}
+			name := key
+			if s, ok := def["name"].(string); ok && s != "" {
+				name = s
+			}
+			req.Networks = append(req.Networks, name)
+		}
+	}
+	files := make(map[string]bool)
+	addFile := func(src string) {
+		if !strings.HasPrefix(src, "./") {
+			return
+		}
+		rel := path.Clean(src)
+		if _, generated := gen.Files[mode][rel]; !generated {
+			files[rel] = true
+		}
+	}
+	services, _ := compose["services"].(map[string]interface{})
+	for name, s := range services {
+		svc, _ := s.(map[string]interface{})
+		if image, ok := svc["image"].(string); ok {
+			req.Images[name] = image
+		}
+		switch b := svc["build"].(type) {
+		case string:
+			req.Builds[name] = b
+		case map[string]interface{}:
+			req.Builds[name], _ = b["context"].(string)
+		}
+		vols, _ := svc["volumes"].([]interface{})
+		for _, v := range vols {
+			switch t := v.(type) {
+			case string:
+				addFile(strings.SplitN(t, ":", 2)[0])
+			case map[string]interface{}:
+				if t["type"] == "bind" {
+					src, _ := t["source"].(string)
+					addFile(src)
+				}
+			}
+		}
+	}
+	for _, section := range []string{"configs", "secrets"} {
+		defs, _ := compose[section].(map[string]interface{})
+		for _, d := range defs {
+			def, _ := d.(map[string]interface{})
+			if f, ok := def["file"].(string); ok {
+				addFile(f)
+			}
+		}
+	}
+	for f := range files {
+		req.Files = append(req.Files, f)
+	}
+	sort.Strings(req.Networks)
+	sort.Strings(req.Files)
+	return req, nil
+}
+
+// k8sRequirements 遍历 k8s 多文档清单中的 Pod 模板：容器镜像，以及以 subPath 挂载的 ConfigMap 卷（对应 compose 的相对路径文件）。
+func k8sRequirements(data []byte) (*DeployRequirements, error) {
+	req := &DeployRequirements{Images: make(map[string]string), ConfigMaps: make(map[string]string)}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("parse k8s manifest: %w", err)
+		}
+		if meta, ok := doc["metadata"].(map[string]interface{}); ok && req.Namespace == "" {
+			req.Namespace, _ = meta["namespace"].(string)
+		}
+		spec, _ := doc["spec"].(map[string]interface{})
+		tmpl, _ := spec["template"].(map[string]interface{})
+		podSpec, _ := tmpl["spec"].(map[string]interface{})
+		if podSpec == nil {
+			continue
+		}
+		configMaps := make(map[string]bool)
+		vols, _ := podSpec["volumes"].([]interface{})
+		for _, v := range vols {
+			vol, _ := v.(map[string]interface{})
+			if cm, ok := vol["configMap"].(map[string]interface{}); ok {
+				if name, _ := cm["name"].(string); name != "" {
+					configMaps[name] = true
+				}
+			}
+		}
+		containers, _ := podSpec["containers"].([]interface{})
+		for _, c := range containers {
+			container, _ := c.(map[string]interface{})
+			name, _ := container["name"].(string)
+			if image, ok := container["image"].(string); ok {
+				req.Images[name] = image
+			}
+			mounts, _ := container["volumeMounts"].([]interface{})
+			for _, m := range mounts {
+				mount, _ := m.(map[string]interface{})
+				vol, _ := mount["name"].(string)
+				if sub, _ := mount["subPath"].(string); sub != "" && configMaps[vol] {
+					req.ConfigMaps[vol] = sub
+				}
+			}
+		}
+	}
+	files := make(map[string]bool)
+	for _, f := range req.ConfigMaps {
+		files[f] = true
+	}
+	for f := range files {
+		req.Files = append(req.Files, f)
+	}
+	sort.Strings(req.Files)
+	return req, nil
+}
@@ -0,0 +1,44 @@
+package composegen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRequirements(t *testing.T) {
+	compose := []byte(`services:
+  warden:
+    image: warden:${WARDEN_TAG:-v1}
+    volumes:
+      - ./data.json:/app/data.json:ro
+      - ./secrets/warden_api_key:/run/secrets/key:ro
+      - /etc/localtime:/etc/localtime:ro
+networks:
+  the-gate-network:
+    driver: bridge
+  edge:
+    external: true
+    name: traefik
+`)
+	gen := &Generated{
+		Composes: map[string][]byte{"traefik-warden": compose},
+		Env:      []byte("WARDEN_TAG=v2\n"),
+		Files:    map[string]map[string][]byte{"traefik-warden": {"secrets/warden_api_key": []byte("k")}},
+	}
+	req, err := Requirements(gen, "traefik-warden")
+	if err != nil {
+		t.Fatalf("Requirements: %v", err)
+	}
+	if strings.Join(req.Networks, ",") != "traefik" {
+		t.Errorf("Networks = %v, want [traefik]", req.Networks)
+	}
+	if strings.Join(req.Files, ",") != "data.json" {
+		t.Errorf("Files = %v, want [data.json] (generated secrets excluded)", req.Files)
+	}
+	if req.Images["warden"] != "warden:v2" {
+		t.Errorf("Images[warden] = %q, want warden:v2", req.Images["warden"])
+	}
+	if _, err := Requirements(gen, "image"); err == nil {
+		t.Error("Requirements for a mode that was not generated should fail")
+	}
+}
@@ -0,0 +1,313 @@
+package composegen
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ParseDotEnv 按 docker compose 使用的 dotenv 语法解析 .env 文本：
+//   - 空行与 # 注释行忽略，可选 export 前缀；
+//   - 无引号值去除首尾空白，空白后的 # 起为行内注释；
+//   - 单引号值按字面取值，双引号值支持 \n、\r、\t、\"、\\、\$ 转义；两者均可跨行（如 PEM 私钥），闭合引号后仅允许注释；
+//   - 无引号与双引号值中的变量引用按 Interpolate 替换为此前已解析的变量（不读取进程环境），$$ 为字面 $，与 docker compose 一致。
+//
+// 格式错误的行被跳过并记入返回的 error（带行号），其余变量照常返回，便于导入时提示而不丢弃整份文件。
+func ParseDotEnv(text string) (map[string]string, error) {
+	p := &dotenvParser{src: strings.ReplaceAll(text, "\r\n", "\n"), line: 1}
+	vars := make(map[string]string)
+	var errs []error
+	for {
+		key, val, ok, err := p.next(MapLookup(vars))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			break
+		}
+		vars[key] = val
+	}
+	return vars, errors.Join(errs...)
+}
+
+type dotenvParser struct {
+	src  string
+	pos  int
+	line int
+}
+
+func (p *dotenvParser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *dotenvParser) peek() byte { return p.src[p.pos] }
+
+func (p *dotenvParser) advance() {
+	if p.src[p.pos] == '\n' {
+		p.line++
+	}
+	p.pos++
+}
+
+func (p *dotenvParser) skipBlank() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+func (p *dotenvParser) skipLine() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+	if !p.eof() {
+		p.advance()
+	}
+}
+
+// next 解析下一条赋值，值中的变量引用经 lookup 替换；ok 为 false 且 err 为 nil 表示已到末尾。出错时已跳过该行。
+func (p *dotenvParser) next(lookup LookupFunc) (key, val string, ok bool, err error) {
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return "", "", false, nil
+		}
+		if c := p.peek(); c == '\n' || c == '#' {
+			p.skipLine()
+			continue
+		}
+		break
+	}
+	line := p.line
+	fail := func(format string, args ...interface{}) (string, string, bool, error) {
+		p.skipLine()
+		return "", "", false, fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+	if strings.HasPrefix(p.src[p.pos:], "export") && len(p.src) > p.pos+6 && (p.src[p.pos+6] == ' ' || p.src[p.pos+6] == '\t') {
+		p.pos += 6
+		p.skipBlank()
+	}
+	start := p.pos
+	for !p.eof() && isDotEnvKeyChar(p.peek()) {
+		p.pos++
+	}
+	key = p.src[start:p.pos]
+	if key == "" {
+		return fail("invalid variable name")
+	}
+	p.skipBlank()
+	if p.eof() || p.peek() != '=' {
+		return fail("expected = after %s", key)
+	}
+	p.pos++
+	hadBlank := !p.eof() && (p.peek() == ' ' || p.peek() == '\t')
+	p.skipBlank()
+	if p.eof() {
+		return key, "", true, nil
+	}
+	switch q := p.peek(); q {
+	case '\'', '"':
+		p.advance()
+		var sb strings.Builder
+		closed := false
+		for !p.eof() {
+			c := p.peek()
+			if c == q {
+				p.advance()
+				closed = true
+				break
+			}
+			if c == '\\' && q == '"' && p.pos+1 < len(p.src) {
+				if r, ok := dotenvEscapes[p.src[p.pos+1]]; ok {
+					if r == '$' {
+						// 转义的 $ 不参与变量替换
+						sb.WriteByte('$')
+					}
+					sb.WriteByte(r)
+					p.pos += 2
+					continue
+				}
+			}
+			sb.WriteByte(c)
+			p.advance()
+		}
+		if !closed {
+			return "", "", false, fmt.Errorf("line %d: unterminated %c quote in %s", line, q, key)
+		}
+		p.skipBlank()
+		if !p.eof() && p.peek() != '\n' && p.peek() != '#' {
+			return fail("unexpected characters after quoted value of %s", key)
+		}
+		p.skipLine()
+		if q == '\'' {
+			return key, sb.String(), true, nil
+		}
+		if val, err = Interpolate(sb.String(), lookup); err != nil {
+			return "", "", false, fmt.Errorf("line %d: %w", line, err)
+		}
+		return key, val, true, nil
+	}
+	start = p.pos
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+	val = p.src[start:p.pos]
+	p.skipLine()
+	if hadBlank && strings.HasPrefix(val, "#") {
+		return key, "", true, nil
+	}
+	for i := 1; i < len(val); i++ {
+		if val[i] == '#' && (val[i-1] == ' ' || val[i-1] == '\t') {
+			val = val[:i]
+			break
+		}
+	}
+	if val, err = Interpolate(strings.TrimSpace(val), lookup); err != nil {
+		return "", "", false, fmt.Errorf("line %d: %w", line, err)
+	}
+	return key, val, true, nil
+}
+
+// FilterDotEnv 返回 text 中仅保留 keep 内变量的 .env 文本：保留的赋值按原文输出（引号、行内注释与顺序不变），
+// 紧接其上的注释行随之保留、随被移除的赋值一起移除，空行隔开的注释（如分组标题）原样保留；
+// 保留的值中引用的此前变量一并保留，使文件内的替换结果不变。text 须能被 ParseDotEnv 解析。
+func FilterDotEnv(text string, keep map[string]bool) (string, error) {
+	type chunk struct {
+		key  string // 为空表示注释行或空行
+		text string
+	}
+	src := strings.ReplaceAll(text, "\r\n", "\n")
+	p := &dotenvParser{src: src, line: 1}
+	// 逐项扫描时不关心取值，变量一律视为已设置，避免 ${VAR:?err} 报错
+	set := func(string) (string, bool) { return "x", true }
+	var chunks []chunk
+	for {
+		start := p.pos
+		p.skipBlank()
+		if p.eof() {
+			break
+		}
+		if c := p.peek(); c == '\n' || c == '#' {
+			p.skipLine()
+			chunks = append(chunks, chunk{text: src[start:p.pos]})
+			continue
+		}
+		p.pos = start
+		key, _, ok, err := p.next(set)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			break
+		}
+		chunks = append(chunks, chunk{key: key, text: src[start:p.pos]})
+	}
+
+	kept := make(map[string]bool)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		c := chunks[i]
+		if c.key == "" || !(keep[c.key] || kept[c.key]) {
+			continue
+		}
+		kept[c.key] = true
+		_, _ = Interpolate(c.text[strings.Index(c.text, "=")+1:], func(name string) (string, bool) {
+			kept[name] = true
+			return "x", true
+		})
+	}
+
+	var sb, pending strings.Builder
+	for _, c := range chunks {
+		switch {
+		case c.key != "":
+			if kept[c.key] {
+				sb.WriteString(pending.String())
+				sb.WriteString(c.text)
+			}
+			pending.Reset()
+		case strings.TrimSpace(c.text) != "":
+			pending.WriteString(c.text)
+		default:
+			sb.WriteString(pending.String())
+			pending.Reset()
+			if out := sb.String(); out != "" && !strings.HasSuffix(out, "\n\n") {
+				sb.WriteString(c.text)
+			}
+		}
+	}
+	sb.WriteString(pending.String())
+	out := strings.TrimRight(sb.String(), "\n")
+	if out == "" {
+		return "", nil
+	}
+	return out + "\n", nil
+}
+
+// dotenvEscapes 为双引号值中支持的转义；其他 \x 原样保留。
+var dotenvEscapes = map[byte]byte{'n': '\n', 'r': '\r', 't': '\t', '"': '"', '\\': '\\', '$': '$'}
+
+func isDotEnvKeyChar(c byte) bool {
+	return isNameChar(c) || c == '.' || c == '-'
+}
+
+// FormatDotEnvValue 将值序列化为 ParseDotEnv（及 docker compose）可原样读回的形式，按值选择引用方式：
+//   - 不含空白、#、引号、反斜杠、$ 与换行时不加引号；
+//   - 不含单引号与换行时使用单引号（字面值，$ 与 JSON 无需转义）；
+//   - 否则使用双引号，转义 \、"、换行，$ 写为 $$ 以免被替换。
+func FormatDotEnvValue(value string) string {
+	if !strings.ContainsAny(value, " \t#\"'\\$\n\r") {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", "$$")
+	return `"` + r.Replace(value) + `"`
+}
+
+// FormatDotEnvLine 返回 KEY=VALUE 行（值经 FormatDotEnvValue）。
+func FormatDotEnvLine(key, value string) string {
+	return key + "=" + FormatDotEnvValue(value)
+}
+
+// FormatDotEnv 按键名排序序列化 vars，每行一条。
+func FormatDotEnv(vars map[string]string) string {
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		sb.WriteString(FormatDotEnvLine(k, vars[k]))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// VerifyDotEnv 重新解析 body，确认与 want 完全一致（键集合与值均相同）；不一致时返回列出变量名的错误（不含值）。
+func VerifyDotEnv(body string, want map[string]string) error {
+	got, err := ParseDotEnv(body)
+	if err != nil {
+		return err
+	}
+	var problems []string
+	for k, v := range want {
+		g, ok := got[k]
+		switch {
+		case !ok:
+			problems = append(problems, k+" is missing")
+		case g != v:
+			problems = append(problems, k+" changes when re-parsed")
+		}
+	}
+	for k := range got {
+		if _, ok := want[k]; !ok {
+			problems = append(problems, "unexpected "+k)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf(".env round trip: %s", strings.Join(problems, "; "))
+}
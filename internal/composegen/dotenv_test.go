@@ -0,0 +1,125 @@
+package composegen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	text := "# comment\n" +
+		"export PLAIN=value # trailing comment\n" +
+		"HASH=a#b\n" +
+		"EMPTY=\n" +
+		"SPACED =  padded  \n" +
+		"SINGLE='lit \\n $X # kept'\n" +
+		"DOUBLE=\"line1\\nline2 \\\"q\\\"\" # comment\n" +
+		"JSON='{\"key-1\":\"secret\"}'\n" +
+		"PEM=\"-----BEGIN KEY-----\nabc\n-----END KEY-----\"\n" +
+		"WIN=crlf\r\n"
+	got, err := ParseDotEnv(text)
+	if err != nil {
+		t.Fatalf("ParseDotEnv: %v", err)
+	}
+	want := map[string]string{
+		"PLAIN":  "value",
+		"HASH":   "a#b",
+		"EMPTY":  "",
+		"SPACED": "padded",
+		"SINGLE": `lit \n $X # kept`,
+		"DOUBLE": "line1\nline2 \"q\"",
+		"JSON":   `{"key-1":"secret"}`,
+		"PEM":    "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"WIN":    "crlf",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d vars, want %d: %q", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+
+	got, err = ParseDotEnv("OK=1\nno equals\nBAD=\"open\n")
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("want error for line 2, got %v", err)
+	}
+	if got["OK"] != "1" {
+		t.Errorf("valid lines should still be parsed, got %q", got)
+	}
+
+	vars := map[string]string{
+		"A": "plain",
+		"B": "Copyright © 2024 - Stargate",
+		"C": `{"key-1":"secret"}`,
+		"D": "-----BEGIN KEY-----\r\nabc\n-----END KEY-----",
+		"E": `back\slash # and 'quotes'`,
+		"F": " padded ",
+		"G": "",
+	}
+	back, err := ParseDotEnv(FormatDotEnv(vars))
+	if err != nil {
+		t.Fatalf("round trip: %v", err)
+	}
+	for k, v := range vars {
+		if back[k] != v {
+			t.Errorf("round trip %s = %q, want %q", k, back[k], v)
+		}
+	}
+}
+
+func TestDotEnvDollarQuoting(t *testing.T) {
+	got, err := ParseDotEnv("A=x\nB=${A}-y\nC='${A}'\nD=\"\\$A $$A ${A}\"\nE=$$A\n")
+	if err != nil {
+		t.Fatalf("ParseDotEnv: %v", err)
+	}
+	want := map[string]string{"A": "x", "B": "x-y", "C": "${A}", "D": "$A $A x", "E": "$A"}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+
+	vars := map[string]string{
+		"PLAIN":    "herald-redis:6379",
+		"FOOTER":   "Copyright © 2024 - Stargate",
+		"BCRYPT":   "bcrypt:$2a$10$rs3cCV4/gqlGVTV7iuESbu",
+		"JSON":     `{"key-1":"$ecret"}`,
+		"MIXED":    `it's $HOME`,
+		"PEM":      "-----BEGIN KEY-----\n$abc\n-----END KEY-----",
+		"TRAILING": "ends with $",
+	}
+	for k, line := range map[string]string{
+		"PLAIN":  "PLAIN=herald-redis:6379",
+		"FOOTER": "FOOTER='Copyright © 2024 - Stargate'",
+		"MIXED":  `MIXED="it's $$HOME"`,
+	} {
+		if got := FormatDotEnvLine(k, vars[k]); got != line {
+			t.Errorf("FormatDotEnvLine(%s) = %s, want %s", k, got, line)
+		}
+	}
+	if err := VerifyDotEnv(FormatDotEnv(vars), vars); err != nil {
+		t.Errorf("VerifyDotEnv: %v", err)
+	}
+	if err := VerifyDotEnv("BCRYPT=bcrypt:$2a$10$rs3c\n", map[string]string{"BCRYPT": "bcrypt:$2a$10$rs3c"}); err == nil || strings.Contains(err.Error(), "$2a") {
+		t.Errorf("VerifyDotEnv: want error naming only the key for an unquoted $, got %v", err)
+	}
+}
+
+// TestFilterDotEnv 确保裁剪保留赋值原文与其上的注释，被引用的此前变量一并保留，跨行引号值整体保留或移除。
+func TestFilterDotEnv(t *testing.T) {
+	text := "# header\n\n# base\nBASE=x\nDROP=1\n# key\nKEY=\"-----BEGIN-----\n${BASE}\n-----END-----\"\n# gone\nGONE='a\nb'\nexport LAST=${KEY:?missing}\n"
+	got, err := FilterDotEnv(text, map[string]bool{"KEY": true, "UNUSED": true})
+	if err != nil {
+		t.Fatalf("FilterDotEnv: %v", err)
+	}
+	if want := "# header\n\n# base\nBASE=x\n# key\nKEY=\"-----BEGIN-----\n${BASE}\n-----END-----\"\n"; got != want {
+		t.Errorf("FilterDotEnv =\n%q\nwant\n%q", got, want)
+	}
+	if got, _ := FilterDotEnv(text, map[string]bool{"LAST": true}); !strings.Contains(got, "BASE=x") || !strings.Contains(got, "export LAST=") || strings.Contains(got, "GONE") {
+		t.Errorf("FilterDotEnv(LAST) should keep its dependencies only:\n%s", got)
+	}
+	if _, err := FilterDotEnv("A='open\n", map[string]bool{"A": true}); err == nil {
+		t.Error("unterminated quote should be an error")
+	}
+}
@@ -0,0 +1,278 @@
+package composegen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LookupFunc 返回变量值及是否已设置（区分未设置与空值：${VAR-d} 仅在未设置时取默认值，${VAR:-d} 在空值时也取默认值）。
+type LookupFunc func(name string) (string, bool)
+
+// MapLookup 以 map 为变量来源（如解析后的 .env）。
+func MapLookup(vars map[string]string) LookupFunc {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+// Interpolate 按 docker compose 规则替换 s 中的变量引用：$VAR、${VAR}、${VAR:-d}、${VAR-d}、${VAR:?err}、${VAR?err}、
+// ${VAR:+alt}、${VAR+alt}；默认值/替代值可嵌套引用（如 ${A:-${B:-x}}），仅在被使用时求值。$$ 为字面 $；
+// 其后不是变量名或 { 的 $ 原样保留（如正则中的 ...$）。
+func Interpolate(s string, lookup LookupFunc) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c != '$' || i+1 >= len(s) {
+			sb.WriteByte(c)
+			i++
+			continue
+		}
+		next := s[i+1]
+		switch {
+		case next == '$':
+			sb.WriteByte('$')
+			i += 2
+		case next == '{':
+			end, err := matchBrace(s, i+2)
+			if err != nil {
+				return "", err
+			}
+			v, err := expandBraced(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(v)
+			i = end + 1
+		case isNameStart(next):
+			j := i + 2
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			v, _ := lookup(s[i+1 : j])
+			sb.WriteString(v)
+			i = j
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String(), nil
+}
+
+// matchBrace 返回从 start 起与 ${ 配对的 } 的下标（跳过嵌套的 ${...} 与 $$）。
+func matchBrace(s string, start int) (int, error) {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '$':
+			i++
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("invalid interpolation format: unterminated ${ in %q", s)
+}
+
+// expandBraced 求值 ${...} 的内部 body（不含 ${ 与 }）。
+func expandBraced(body string, lookup LookupFunc) (string, error) {
+	n := 0
+	for n < len(body) && isNameChar(body[n]) {
+		n++
+	}
+	name, rest := body[:n], body[n:]
+	if name == "" || !isNameStart(name[0]) {
+		return "", fmt.Errorf("invalid interpolation format: ${%s}", body)
+	}
+	val, set := lookup(name)
+	if rest == "" {
+		return val, nil
+	}
+	op := rest[:1]
+	colon := op == ":"
+	if colon {
+		if len(rest) < 2 {
+			return "", fmt.Errorf("invalid interpolation format: ${%s}", body)
+		}
+		op = rest[1:2]
+		rest = rest[2:]
+	} else {
+		rest = rest[1:]
+	}
+	// 带冒号时空值视同未设置
+	present := set && (!colon || val != "")
+	switch op {
+	case "-":
+		if present {
+			return val, nil
+		}
+		return Interpolate(rest, lookup)
+	case "+":
+		if !present {
+			return "", nil
+		}
+		return Interpolate(rest, lookup)
+	case "?":
+		if present {
+			return val, nil
+		}
+		msg, err := Interpolate(rest, lookup)
+		if err != nil {
+			return "", err
+		}
+		if msg == "" {
+			msg = "required variable is missing a value"
+		}
+		return "", fmt.Errorf("%s: %s", name, msg)
+	}
+	return "", fmt.Errorf("invalid interpolation format: ${%s}", body)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
+
+// InterpolateCompose 返回 compose 的副本，其中所有字符串值按 lookup 替换（键名不替换）；
+// 错误带有所在路径（如 services.stargate.environment[3]）。遍历按键名排序，错误信息稳定。
+func InterpolateCompose(compose map[string]interface{}, lookup LookupFunc) (map[string]interface{}, error) {
+	out, err := interpolateValue(compose, lookup, "")
+	if err != nil {
+		return nil, err
+	}
+	m, _ := out.(map[string]interface{})
+	return m, nil
+}
+
+func interpolateValue(v interface{}, lookup LookupFunc, path string) (interface{}, error) {
+	switch t := v.(type) {
+	case string:
+		s, err := Interpolate(t, lookup)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return s, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make(map[string]interface{}, len(t))
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			r, err := interpolateValue(t[k], lookup, p)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			r, err := interpolateValue(item, lookup, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// ResolveCompose 将 .env（env）应用到 compose YAML，返回变量全部替换后的文档，效果类似离线的 docker compose config
+// （不合并 shell 环境变量，不做类型规范化）。
+func ResolveCompose(composeData, env []byte) ([]byte, error) {
+	compose, err := ParseCompose(composeData)
+	if err != nil {
+		return nil, err
+	}
+	vars, err := ParseDotEnv(string(env))
+	if err != nil {
+		return nil, fmt.Errorf("parse .env: %w", err)
+	}
+	resolved, err := InterpolateCompose(compose, MapLookup(vars))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(resolved); err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(buf.Bytes(), []byte("---\n")), nil
+}
+
+// Resolve 对 Generate 结果中的每个 compose 输出调用 ResolveCompose（k8s 清单跳过），返回 mode -> 解析后的 YAML。
+func Resolve(gen *Generated) (map[string][]byte, error) {
+	if gen == nil {
+		return nil, nil
+	}
+	out := make(map[string][]byte, len(gen.Composes))
+	for mode, data := range gen.Composes {
+		if OutputFileName(mode) != "docker-compose.yml" {
+			continue
+		}
+		resolved, err := ResolveCompose(data, gen.EnvFor(mode))
+		if err != nil {
+			return nil, fmt.Errorf("resolve %s: %w", mode, err)
+		}
+		out[mode] = resolved
+	}
+	return out, nil
+}
+
+// EnvRefs 返回 compose 中所有字符串值引用的变量名（含嵌套默认值与 $VAR），用于按 mode 裁剪 .env；
+// 分别按「均未设置」与「均已设置」求值一次，使 :- 与 :+ 两侧的引用都被收集。
+func EnvRefs(compose map[string]interface{}) map[string]bool {
+	refs := make(map[string]bool)
+	record := func(set bool) LookupFunc {
+		return func(name string) (string, bool) {
+			refs[name] = true
+			if set {
+				return "x", true
+			}
+			return "", false
+		}
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch t := v.(type) {
+		case string:
+			_, _ = Interpolate(t, record(false))
+			_, _ = Interpolate(t, record(true))
+		case map[string]interface{}:
+			for _, item := range t {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range t {
+				walk(item)
+			}
+		}
+	}
+	walk(compose)
+	return refs
+}
@@ -0,0 +1,56 @@
+package composegen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	lookup := MapLookup(map[string]string{"SET": "v", "EMPTY": "", "INNER": "in"})
+	cases := []struct {
+		in, want string
+	}{
+		{"${SET}", "v"},
+		{"$SET/x", "v/x"},
+		{"${UNSET}", ""},
+		{"${EMPTY:-d}", "d"},
+		{"${EMPTY-d}", ""},
+		{"${UNSET-d}", "d"},
+		{"${SET:+alt}", "alt"},
+		{"${EMPTY:+alt}", ""},
+		{"${UNSET:-${INNER:-x}-y}", "in-y"},
+		{"${UNSET:-${NONE:-x}}", "x"},
+		{"${SET:?must be set}", "v"},
+		{"$$SET", "$SET"},
+		{"^(X-.*)$", "^(X-.*)$"},
+	}
+	for _, c := range cases {
+		got, err := Interpolate(c.in, lookup)
+		if err != nil || got != c.want {
+			t.Errorf("Interpolate(%q) = %q, %v; want %q", c.in, got, err, c.want)
+		}
+	}
+	for _, in := range []string{"${EMPTY:?must be set}", "${UNSET?}", "${SET", "${1BAD}", "${SET:x}"} {
+		if _, err := Interpolate(in, lookup); err == nil {
+			t.Errorf("Interpolate(%q): expected error", in)
+		}
+	}
+
+	out, err := ResolveCompose([]byte(`services:
+  stargate:
+    image: stargate:${TAG:-latest}
+    environment:
+      - PASSWORDS=${PASSWORDS:-plaintext:test1234}
+`), []byte("PASSWORDS=sha512:abc\n"))
+	if err != nil {
+		t.Fatalf("ResolveCompose: %v", err)
+	}
+	for _, want := range []string{"image: stargate:latest", "PASSWORDS=sha512:abc"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("resolved compose missing %q:\n%s", want, out)
+		}
+	}
+	if _, err := ResolveCompose([]byte("services:\n  a:\n    image: ${IMG:?image required}\n"), nil); err == nil || !strings.Contains(err.Error(), "services.a.image") {
+		t.Errorf("ResolveCompose: want error with path, got %v", err)
+	}
+}
@@ -0,0 +1,483 @@
+package composegen
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// k8s 模式的固定命名：所有对象放在 k8sNamespace；.env 变量拆为 ConfigMap（普通）与 Secret（敏感）。
+const (
+	k8sNamespace      = "the-gate"
+	k8sConfigMapName  = "the-gate-env"
+	k8sSecretName     = "the-gate-secrets"
+	k8sStorageRequest = "1Gi"
+	k8sPartOf         = "the-gate"
+	k8sTraefikAPI     = "traefik.io/v1alpha1"
+)
+
+// singleEnvRefRegex 匹配整个值仅为一个 ${VAR} / ${VAR:-default} 引用的情况（k8s 改为引用 ConfigMap/Secret，swarm 据此识别密钥变量）。
+var singleEnvRefRegex = regexp.MustCompile(`^\$\{([^}:]+)(?::-([^}]*))?\}$`)
+
+// k8sHTTPProbeRegex 识别 canonical 中 "curl -f http://localhost:<port><path>" 形式的健康检查，转换为 httpGet 探针。
+var k8sHTTPProbeRegex = regexp.MustCompile(`curl -f http://localhost:(\d+)(/\S*)`)
+
+// k8sConverter 保存一次 k8s 生成过程中的变量解析结果与被引用的 .env 键。
+type k8sConverter struct {
+	opts *Options
+	vars map[string]string
+	used map[string]string // 被 env 引用的变量 -> 值
+}
+
+// resolve 将字符串中的 ${VAR:-default} 替换为当前 .env 值（无值时用默认值）。
+func (c *k8sConverter) resolve(s string) string {
+	return envVarRegex.ReplaceAllStringFunc(s, func(m string) string {
+		sub := envVarRegex.FindStringSubmatch(m)
+		if v, ok := c.vars[sub[1]]; ok {
+			return v
+		}
+		return sub[2]
+	})
+}
+
+// envEntry 将 compose 的一条环境变量转换为容器 env：整值为变量引用时指向 ConfigMap/Secret，否则解析为字面值。
+func (c *k8sConverter) envEntry(name, value string) map[string]interface{} {
+	m := singleEnvRefRegex.FindStringSubmatch(value)
+	if m == nil {
+		return map[string]interface{}{"name": name, "value": c.resolve(value)}
+	}
+	key := m[1]
+	val, ok := c.vars[key]
+	if !ok {
+		val = m[2]
+	}
+	c.used[key] = val
+	refKind, refName := "configMapKeyRef", k8sConfigMapName
+	if IsSecretEnvKey(c.opts, key) {
+		refKind, refName = "secretKeyRef", k8sSecretName
+	}
+	return map[string]interface{}{
+		"name":      name,
+		"valueFrom": map[string]interface{}{refKind: map[string]interface{}{"name": refName, "key": key}},
+	}
+}
+
+// containerEnv 转换服务的 environment（载入时已统一列表与映射写法）；只有键、取值来自 shell 环境的项跳过。
+func (c *k8sConverter) containerEnv(svc *Service) []interface{} {
+	var out []interface{}
+	for _, item := range svc.Environment {
+		if item.Value == nil {
+			continue
+		}
+		out = append(out, c.envEntry(item.Key, *item.Value))
+	}
+	return out
+}
+
+// k8sContainerPorts 从 ports（取容器端口）、expose 及 Traefik loadbalancer 端口 label 收集容器端口。
+func k8sContainerPorts(svc *Service) []int {
+	seen := make(map[int]bool)
+	add := func(s string) {
+		s = strings.TrimSuffix(strings.TrimSpace(s), "/tcp")
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			seen[n] = true
+		}
+	}
+	for _, p := range svc.Ports {
+		add(p.Target)
+	}
+	if list, ok := svc.Extra["expose"].([]interface{}); ok {
+		for _, p := range list {
+			add(fmt.Sprintf("%v", p))
+		}
+	}
+	if len(seen) == 0 {
+		for _, l := range svc.Labels {
+			if l.Value != nil && strings.HasSuffix(l.Key, ".loadbalancer.server.port") {
+				add(*l.Value)
+			}
+		}
+	}
+	ports := make([]int, 0, len(seen))
+	for p := range seen {
+		ports = append(ports, p)
+	}
+	sort.Ints(ports)
+	return ports
+}
+
+func k8sPortName(port int) string {
+	return "tcp-" + strconv.Itoa(port)
+}
+
+func k8sSeconds(v interface{}) (int, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return 0, false
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false
+	}
+	sec := int(d / time.Second)
+	if sec < 1 {
+		sec = 1
+	}
+	return sec, true
+}
+
+// k8sProbe 将 compose healthcheck 转换为探针：curl 本地 HTTP 检查转 httpGet，其余转 exec；interval/timeout/retries/start_period 对应 period/timeout/failureThreshold/initialDelay。
+func k8sProbe(svc *Service) map[string]interface{} {
+	hc, ok := svc.Extra["healthcheck"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	test, _ := hc["test"].([]interface{})
+	if len(test) < 2 {
+		return nil
+	}
+	probe := make(map[string]interface{})
+	kind, _ := test[0].(string)
+	switch kind {
+	case "CMD-SHELL":
+		cmd, _ := test[1].(string)
+		if m := k8sHTTPProbeRegex.FindStringSubmatch(cmd); m != nil {
+			port, _ := strconv.Atoi(m[1])
+			probe["httpGet"] = map[string]interface{}{"path": m[2], "port": port}
+		} else {
+			probe["exec"] = map[string]interface{}{"command": []interface{}{"sh", "-c", cmd}}
+		}
+	case "CMD":
+		probe["exec"] = map[string]interface{}{"command": test[1:]}
+	default:
+		return nil
+	}
+	if n, ok := k8sSeconds(hc["interval"]); ok {
+		probe["periodSeconds"] = n
+	}
+	if n, ok := k8sSeconds(hc["timeout"]); ok {
+		probe["timeoutSeconds"] = n
+	}
+	if n, ok := hc["retries"].(int); ok {
+		probe["failureThreshold"] = n
+	}
+	if n, ok := k8sSeconds(hc["start_period"]); ok {
+		probe["initialDelaySeconds"] = n
+	}
+	return probe
+}
+
+func k8sMeta(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      name,
+		"namespace": k8sNamespace,
+		"labels":    map[string]interface{}{"app.kubernetes.io/name": name, "app.kubernetes.io/part-of": k8sPartOf},
+	}
+}
+
+var resourceNameInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// fileResourceName 为服务挂载的相对路径文件生成 ConfigMap / swarm config 名，如 warden + ./data.json -> warden-data-json。
+func fileResourceName(service, src string) string {
+	return service + "-" + strings.Trim(resourceNameInvalid.ReplaceAllString(strings.ToLower(path.Base(src)), "-"), "-")
+}
+
+// k8sWorkload 为单个 compose 服务生成 Service 与 Deployment（挂载命名卷时为 StatefulSet + PVC 模板）。
+func (c *k8sConverter) k8sWorkload(name string, svc *Service, namedVolumes map[string]interface{}) []interface{} {
+	container := map[string]interface{}{
+		"name":  name,
+		"image": c.resolve(fmt.Sprintf("%v", svc.Extra["image"])),
+	}
+	// compose 的 command 覆盖镜像 CMD，对应容器的 args（如 sms-sink 复用 stargate-suite 镜像）
+	switch cmd := svc.Extra["command"].(type) {
+	case []interface{}:
+		container["args"] = cmd
+	case string:
+		args := make([]interface{}, 0)
+		for _, f := range strings.Fields(cmd) {
+			args = append(args, f)
+		}
+		container["args"] = args
+	}
+	ports := k8sContainerPorts(svc)
+	if len(ports) > 0 {
+		var cp []interface{}
+		for _, p := range ports {
+			cp = append(cp, map[string]interface{}{"name": k8sPortName(p), "containerPort": p})
+		}
+		container["ports"] = cp
+	}
+	if env := c.containerEnv(svc); len(env) > 0 {
+		container["env"] = env
+	}
+	if probe := k8sProbe(svc); probe != nil {
+		container["readinessProbe"] = probe
+		container["livenessProbe"] = copyMap(probe)
+	}
+
+	var mounts, podVolumes, claims []interface{}
+	for _, v := range svc.Volumes {
+		switch {
+		case v.Type == "volume" && hasKey(namedVolumes, v.Source):
+			mounts = append(mounts, map[string]interface{}{"name": v.Source, "mountPath": v.Target})
+			claims = append(claims, map[string]interface{}{
+				"metadata": map[string]interface{}{"name": v.Source},
+				"spec": map[string]interface{}{
+					"accessModes": []interface{}{"ReadWriteOnce"},
+					"resources":   map[string]interface{}{"requests": map[string]interface{}{"storage": k8sStorageRequest}},
+				},
+			})
+		case v.Type == "bind" && strings.HasPrefix(v.Source, "./"):
+			// 相对路径文件（如 warden 的 ./data.json）由同名 ConfigMap 提供，需在 apply 前自行创建
+			cmName := fileResourceName(name, v.Source)
+			mounts = append(mounts, map[string]interface{}{"name": cmName, "mountPath": v.Target, "subPath": path.Base(v.Source), "readOnly": v.ReadOnly})
+			podVolumes = append(podVolumes, map[string]interface{}{"name": cmName, "configMap": map[string]interface{}{"name": cmName}})
+		}
+		// 绝对主机路径（如 /etc/localtime）与集群节点相关，不转换
+	}
+	if len(mounts) > 0 {
+		container["volumeMounts"] = mounts
+	}
+
+	selector := map[string]interface{}{"app.kubernetes.io/name": name}
+	podSpec := map[string]interface{}{"containers": []interface{}{container}}
+	if len(podVolumes) > 0 {
+		podSpec["volumes"] = podVolumes
+	}
+	template := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": name, "app.kubernetes.io/part-of": k8sPartOf}},
+		"spec":     podSpec,
+	}
+	spec := map[string]interface{}{
+		"replicas": 1,
+		"selector": map[string]interface{}{"matchLabels": selector},
+		"template": template,
+	}
+	kind := "Deployment"
+	if len(claims) > 0 {
+		kind = "StatefulSet"
+		spec["serviceName"] = name
+		spec["volumeClaimTemplates"] = claims
+	}
+	var docs []interface{}
+	if len(ports) > 0 {
+		var sp []interface{}
+		for _, p := range ports {
+			sp = append(sp, map[string]interface{}{"name": k8sPortName(p), "port": p, "targetPort": p})
+		}
+		svcSpec := map[string]interface{}{"selector": selector, "ports": sp}
+		if kind == "StatefulSet" {
+			svcSpec["clusterIP"] = "None"
+		}
+		docs = append(docs, map[string]interface{}{"apiVersion": "v1", "kind": "Service", "metadata": k8sMeta(name), "spec": svcSpec})
+	}
+	docs = append(docs, map[string]interface{}{"apiVersion": "apps/v1", "kind": kind, "metadata": k8sMeta(name), "spec": spec})
+	return docs
+}
+
+func hasKey(m map[string]interface{}, k string) bool {
+	_, ok := m[k]
+	return ok
+}
+
+// k8sTraefikResources 按服务的 Traefik labels 生成 Middleware（forwardAuth）与 IngressRoute，与 compose 中 labels 的效果一致；
+// 未启用 Traefik（labels 已移除）时不生成。仅引用本清单中定义的 middleware，gzip、redir-https 等外部 middleware 略过。
+func (c *k8sConverter) k8sTraefikResources(services map[string]*Service, names []string) []interface{} {
+	type router struct {
+		name, service string
+		fields        map[string]string
+	}
+	middlewares := make(map[string]map[string]interface{})
+	var routers []router
+	backendPorts := make(map[string]int) // traefik service 名 -> 端口
+	backendOwner := make(map[string]string)
+	for _, name := range names {
+		byRouter := make(map[string]map[string]string)
+		for _, l := range services[name].Labels {
+			if l.Value == nil {
+				continue
+			}
+			key, val := c.resolve(l.Key), c.resolve(*l.Value)
+			parts := strings.Split(key, ".")
+			switch {
+			case len(parts) == 6 && parts[1] == "http" && parts[2] == "middlewares" && parts[4] == "forwardauth":
+				mw := middlewares[parts[3]]
+				if mw == nil {
+					mw = make(map[string]interface{})
+					middlewares[parts[3]] = mw
+				}
+				switch parts[5] {
+				case "address":
+					mw["address"] = strings.Replace(val, "://"+name+"/", "://"+name+"."+k8sNamespace+".svc.cluster.local/", 1)
+				case "authResponseHeaders":
+					var hs []interface{}
+					for _, h := range strings.Split(val, ",") {
+						hs = append(hs, strings.TrimSpace(h))
+					}
+					mw["authResponseHeaders"] = hs
+				case "trustForwardHeader":
+					mw["trustForwardHeader"] = val == "true"
+				default:
+					mw[parts[5]] = val
+				}
+			case (len(parts) == 5 || len(parts) == 6 && parts[4] == "tls") && parts[1] == "http" && parts[2] == "routers":
+				if byRouter[parts[3]] == nil {
+					byRouter[parts[3]] = make(map[string]string)
+				}
+				byRouter[parts[3]][strings.Join(parts[4:], ".")] = val
+			case len(parts) == 7 && parts[1] == "http" && parts[2] == "services" && parts[4] == "loadbalancer" && parts[6] == "port":
+				if p, err := strconv.Atoi(val); err == nil {
+					backendPorts[parts[3]] = p
+					backendOwner[parts[3]] = name
+				}
+			}
+		}
+		rnames := make([]string, 0, len(byRouter))
+		for r := range byRouter {
+			rnames = append(rnames, r)
+		}
+		sort.Strings(rnames)
+		for _, r := range rnames {
+			routers = append(routers, router{name: r, service: name, fields: byRouter[r]})
+		}
+	}
+
+	var docs []interface{}
+	mwNames := make([]string, 0, len(middlewares))
+	for n := range middlewares {
+		mwNames = append(mwNames, n)
+	}
+	sort.Strings(mwNames)
+	for _, n := range mwNames {
+		docs = append(docs, map[string]interface{}{
+			"apiVersion": k8sTraefikAPI,
+			"kind":       "Middleware",
+			"metadata":   k8sMeta(n),
+			"spec":       map[string]interface{}{"forwardAuth": middlewares[n]},
+		})
+	}
+	for _, r := range routers {
+		backend := r.fields["service"]
+		if backend == "" || strings.HasSuffix(backend, "@internal") {
+			continue
+		}
+		port, ok := backendPorts[backend]
+		if !ok {
+			continue
+		}
+		route := map[string]interface{}{
+			"match":    r.fields["rule"],
+			"kind":     "Rule",
+			"services": []interface{}{map[string]interface{}{"name": backendOwner[backend], "port": port}},
+		}
+		if p, err := strconv.Atoi(r.fields["priority"]); err == nil {
+			route["priority"] = p
+		}
+		var mws []interface{}
+		for _, m := range strings.Split(r.fields["middlewares"], ",") {
+			if m = strings.TrimSpace(m); m != "" && middlewares[m] != nil {
+				mws = append(mws, map[string]interface{}{"name": m})
+			}
+		}
+		if len(mws) > 0 {
+			route["middlewares"] = mws
+		}
+		spec := map[string]interface{}{"routes": []interface{}{route}}
+		if ep := r.fields["entrypoints"]; ep != "" {
+			var eps []interface{}
+			for _, e := range strings.Split(ep, ",") {
+				eps = append(eps, strings.TrimSpace(e))
+			}
+			spec["entryPoints"] = eps
+		}
+		if r.fields["tls"] == "true" {
+			tls := map[string]interface{}{}
+			if resolver := r.fields["tls.certresolver"]; resolver != "" {
+				tls["certResolver"] = resolver
+			}
+			spec["tls"] = tls
+		}
+		docs = append(docs, map[string]interface{}{
+			"apiVersion": k8sTraefikAPI,
+			"kind":       "IngressRoute",
+			"metadata":   k8sMeta(r.name),
+			"spec":       spec,
+		})
+	}
+	return docs
+}
+
+// generateK8s 生成 k8s 模式清单：服务集合与全量 traefik 模式一致（同样遵循 IncludeTotp、DisableWardenRedisService、
+// StargateSessionRedisUseBuiltin 等 Options），再转换为 Namespace、ConfigMap、Secret、Service、Deployment/StatefulSet 及 Traefik CRD。
+func generateK8s(src *Source, opts *Options, meta *EnvMeta, envOverride string) ([]byte, error) {
+	def, err := src.modeDef("traefik")
+	if err != nil {
+		return nil, err
+	}
+	// 容器名前缀在 k8s 中无意义（以 Service 名互访），Redis 数据统一使用 PVC；Traefik 由集群提供，不注入内置 Traefik
+	var k8sOpts *Options
+	if opts != nil {
+		o := *opts
+		o.ContainerNamePrefix = ""
+		o.UseNamedVolume = true
+		o.BundledTraefik = false
+		k8sOpts = &o
+	}
+	p, err := buildSplitCompose(src, def, k8sOpts)
+	if err != nil {
+		return nil, err
+	}
+	c := &k8sConverter{opts: k8sOpts, vars: resolvedEnvVars(src, k8sOpts, envOverride), used: make(map[string]string)}
+
+	names := make([]string, 0, len(p.Services))
+	for n := range p.Services {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var workloads []interface{}
+	for _, n := range names {
+		workloads = append(workloads, c.k8sWorkload(n, p.Services[n], p.Volumes)...)
+	}
+	traefik := c.k8sTraefikResources(p.Services, names)
+
+	cmData := make(map[string]interface{})
+	secretData := make(map[string]interface{})
+	for k, v := range c.used {
+		if IsSecretEnvKey(c.opts, k) {
+			secretData[k] = v
+		} else {
+			cmData[k] = v
+		}
+	}
+	docs := []interface{}{
+		map[string]interface{}{"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]interface{}{"name": k8sNamespace}},
+		map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "metadata": k8sMeta(k8sConfigMapName), "data": cmData},
+		map[string]interface{}{"apiVersion": "v1", "kind": "Secret", "metadata": k8sMeta(k8sSecretName), "type": "Opaque", "stringData": secretData},
+	}
+	docs = append(docs, workloads...)
+	docs = append(docs, traefik...)
+
+	var buf bytes.Buffer
+	buf.WriteString(splitComposeComment("k8s"))
+	for i, d := range docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(d); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
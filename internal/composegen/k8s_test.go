@@ -0,0 +1,158 @@
+package composegen
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestGenerateK8sSecretsAndStatefulSet 确保 k8s 模式将敏感变量放入 Secret、挂载命名卷的服务生成 StatefulSet。
+func TestGenerateK8sSecretsAndStatefulSet(t *testing.T) {
+	full := map[string]interface{}{
+		"services": map[string]interface{}{
+			"herald": map[string]interface{}{
+				"image": "herald:${HERALD_TAG:-test}",
+				"ports": []interface{}{"8082:8082"},
+				"environment": []interface{}{
+					"API_KEY=${HERALD_API_KEY:-test-key}",
+					"REDIS_ADDR=${HERALD_REDIS_ADDR:-herald-redis:6379}",
+				},
+			},
+			"herald-redis": map[string]interface{}{
+				"image":   "redis:test",
+				"expose":  []interface{}{"6379"},
+				"volumes": []interface{}{"herald-redis-data:/data"},
+			},
+		},
+		"volumes": map[string]interface{}{"herald-redis-data": nil},
+	}
+	yml, err := generateK8s(&Source{Compose: full}, nil, nil, "")
+	if err != nil {
+		t.Fatalf("generateK8s: %v", err)
+	}
+	kinds := make(map[string]bool) // kind/name
+	var secret, configMap map[string]interface{}
+	dec := yaml.NewDecoder(bytes.NewReader(yml))
+	for {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err != nil {
+			break
+		}
+		meta, _ := doc["metadata"].(map[string]interface{})
+		kinds[fmt.Sprintf("%v/%v", doc["kind"], meta["name"])] = true
+		switch doc["kind"] {
+		case "Secret":
+			secret, _ = doc["stringData"].(map[string]interface{})
+		case "ConfigMap":
+			configMap, _ = doc["data"].(map[string]interface{})
+		}
+	}
+	for _, want := range []string{"Namespace/the-gate", "Deployment/herald", "StatefulSet/herald-redis", "Service/herald-redis"} {
+		if !kinds[want] {
+			t.Errorf("missing %s in output, got %v", want, kinds)
+		}
+	}
+	if secret["HERALD_API_KEY"] != "test-key" {
+		t.Errorf("HERALD_API_KEY should be in Secret, got secret=%v", secret)
+	}
+	if configMap["HERALD_REDIS_ADDR"] != "herald-redis:6379" {
+		t.Errorf("HERALD_REDIS_ADDR should be in ConfigMap, got configMap=%v", configMap)
+	}
+	if _, leaked := configMap["HERALD_API_KEY"]; leaked {
+		t.Errorf("HERALD_API_KEY must not be in ConfigMap")
+	}
+}
+
+// TestGenerateK8sVolumes 确保长语法的命名卷生成 PVC 模板、长语法与短语法的相对路径文件挂载为 ConfigMap 并保留只读标记，
+// 长语法 ports 与映射写法的 environment 同样转换。
+func TestGenerateK8sVolumes(t *testing.T) {
+	full := map[string]interface{}{
+		"services": map[string]interface{}{
+			"warden": map[string]interface{}{
+				"image": "warden:test",
+				"ports": []interface{}{map[string]interface{}{"target": 8081, "published": "8081"}},
+				"environment": map[string]interface{}{
+					"PORT": "8081",
+				},
+				"volumes": []interface{}{
+					"./data.json:/app/data.json:ro",
+					map[string]interface{}{"type": "bind", "source": "./rules.yaml", "target": "/app/rules.yaml", "bind": map[string]interface{}{"create_host_path": false}},
+					"/etc/localtime:/etc/localtime:ro",
+				},
+			},
+			"warden-redis": map[string]interface{}{
+				"image":   "redis:test",
+				"volumes": []interface{}{map[string]interface{}{"type": "volume", "source": "warden-redis-data", "target": "/data", "volume": map[string]interface{}{"nocopy": true}}},
+			},
+		},
+		"volumes": map[string]interface{}{"warden-redis-data": nil},
+	}
+	yml, err := generateK8s(&Source{Compose: full}, nil, nil, "")
+	if err != nil {
+		t.Fatalf("generateK8s: %v", err)
+	}
+	type container struct {
+		Ports []struct {
+			ContainerPort int `yaml:"containerPort"`
+		} `yaml:"ports"`
+		Env          []map[string]string      `yaml:"env"`
+		VolumeMounts []map[string]interface{} `yaml:"volumeMounts"`
+	}
+	workloads := make(map[string]struct {
+		Kind string
+		Spec struct {
+			VolumeClaimTemplates []interface{} `yaml:"volumeClaimTemplates"`
+			Template             struct {
+				Spec struct {
+					Containers []container `yaml:"containers"`
+				} `yaml:"spec"`
+			} `yaml:"template"`
+		}
+	})
+	dec := yaml.NewDecoder(bytes.NewReader(yml))
+	for {
+		var doc struct {
+			Kind     string `yaml:"kind"`
+			Metadata struct {
+				Name string `yaml:"name"`
+			} `yaml:"metadata"`
+			Spec yaml.Node `yaml:"spec"`
+		}
+		if err := dec.Decode(&doc); err != nil {
+			break
+		}
+		if doc.Kind != "Deployment" && doc.Kind != "StatefulSet" {
+			continue
+		}
+		w := workloads[doc.Metadata.Name]
+		w.Kind = doc.Kind
+		if err := doc.Spec.Decode(&w.Spec); err != nil {
+			t.Fatalf("%s spec: %v", doc.Metadata.Name, err)
+		}
+		workloads[doc.Metadata.Name] = w
+	}
+	if redis := workloads["warden-redis"]; redis.Kind != "StatefulSet" || len(redis.Spec.VolumeClaimTemplates) != 1 {
+		t.Errorf("warden-redis = %s with %d claims, want a StatefulSet with 1 claim", redis.Kind, len(redis.Spec.VolumeClaimTemplates))
+	}
+	warden := workloads["warden"]
+	if warden.Kind != "Deployment" || len(warden.Spec.Template.Spec.Containers) != 1 {
+		t.Fatalf("warden = %+v", warden)
+	}
+	c := warden.Spec.Template.Spec.Containers[0]
+	if len(c.Ports) != 1 || c.Ports[0].ContainerPort != 8081 {
+		t.Errorf("warden ports = %v, want containerPort 8081", c.Ports)
+	}
+	if len(c.Env) != 1 || c.Env[0]["name"] != "PORT" || c.Env[0]["value"] != "8081" {
+		t.Errorf("warden env = %v", c.Env)
+	}
+	want := []map[string]interface{}{
+		{"name": "warden-data-json", "mountPath": "/app/data.json", "subPath": "data.json", "readOnly": true},
+		{"name": "warden-rules-yaml", "mountPath": "/app/rules.yaml", "subPath": "rules.yaml", "readOnly": false},
+	}
+	if !reflect.DeepEqual(c.VolumeMounts, want) {
+		t.Errorf("warden volumeMounts = %v\nwant %v", c.VolumeMounts, want)
+	}
+}
@@ -0,0 +1,331 @@
+package composegen
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source 为已解析的 canonical compose：Compose 供各 mode 转换使用，Layout 为原文档节点，输出时据此还原键顺序、注释与引号风格，
+// 使生成结果可与 canonical 直接对比；Modes 为切分 mode 定义（config/modes.yaml，见 LoadModes），为空时使用 DefaultModeDefs；
+// Providers 为 Herald 通道描述（config/providers.yaml，见 LoadProviders），为空时使用 DefaultProviders。
+type Source struct {
+	Compose   map[string]interface{}
+	Layout    *yaml.Node
+	Modes     []ModeDef
+	Providers []Provider
+}
+
+// LoadSource 读取并解析 compose 文件，同时保留其文档节点。
+func LoadSource(path string) (*Source, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read compose: %w", err)
+	}
+	return ParseSource(data)
+}
+
+// ParseSource 从内存解析 compose YAML，Compose 与 ParseCompose 的结果一致。
+func ParseSource(data []byte) (*Source, error) {
+	compose, err := ParseCompose(data)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse compose: %w", err)
+	}
+	return &Source{Compose: compose, Layout: &doc}, nil
+}
+
+// Generate 同包级 Generate，输出按 s.Layout 保持 canonical 的键顺序与注释。
+func (s *Source) Generate(modes []string, envOverride string, opts *Options, meta *EnvMeta) (*Generated, error) {
+	return generate(s, modes, envOverride, opts, meta)
+}
+
+// layoutRoot 返回文档节点中的顶层映射；layout 为 nil 或不是映射时返回 nil。
+func layoutRoot(layout *yaml.Node) *yaml.Node {
+	n := layout
+	if n != nil && n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	return n
+}
+
+// encodeLayout 将 compose 编码为 YAML（缩进 2，无文档起始符）：有 layout 时映射键按 canonical 的顺序排列（canonical 中没有的键按键名排在其后，
+// 新增的服务见 orderNewServices），并带上 canonical 中的注释（文档头注释除外，由各 mode 的文件头替代）；environment 列表项再加上 comments 中的说明。
+func encodeLayout(compose map[string]interface{}, layout *yaml.Node, comments map[string]string) ([]byte, error) {
+	var doc yaml.Node
+	if err := doc.Encode(compose); err != nil {
+		return nil, err
+	}
+	if ref := layoutRoot(layout); ref != nil {
+		applyLayout(layoutRoot(&doc), ref)
+		orderNewServices(mappingValue(layoutRoot(&doc), "services"), mappingValue(ref, "services"))
+	}
+	addEnvComments(&doc, comments)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	out := bytes.TrimPrefix(buf.Bytes(), []byte("---\n"))
+	if layout != nil {
+		out = spaceSections(out)
+	}
+	return out, nil
+}
+
+// applyLayout 按 ref（canonical 中对应位置的节点）调整 n：映射键重新排序，复制键、标量值上的注释与引号风格，递归处理子节点；
+// 序列项按原值、KEY= 前缀（environment / labels）与 ref 中的项对应，顺序不变。
+func applyLayout(n, ref *yaml.Node) {
+	if n == nil || ref == nil || n.Kind != ref.Kind {
+		return
+	}
+	copyComments(n, ref)
+	switch n.Kind {
+	case yaml.ScalarNode:
+		if n.Tag == ref.Tag {
+			n.Style = ref.Style
+			if n.Tag == "!!null" {
+				// 保持 canonical 中空值的写法（如 "warden-redis-data:" 而非 null）
+				n.Value = ref.Value
+			}
+		}
+	case yaml.MappingNode:
+		refIndex := make(map[string]int, len(ref.Content)/2)
+		for i := 0; i+1 < len(ref.Content); i += 2 {
+			refIndex[ref.Content[i].Value] = i
+		}
+		var known, rest []*yaml.Node
+		pos := make(map[*yaml.Node]int)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, val := n.Content[i], n.Content[i+1]
+			if j, ok := refIndex[key.Value]; ok {
+				copyComments(key, ref.Content[j])
+				applyLayout(val, ref.Content[j+1])
+				pos[key] = j
+				known = append(known, key, val)
+			} else {
+				rest = append(rest, key, val)
+			}
+		}
+		sortPairs(known, pos)
+		n.Content = append(known, rest...)
+	case yaml.SequenceNode:
+		if ref.Style&yaml.FlowStyle != 0 && len(ref.Content) > 0 && allScalars(n.Content) {
+			n.Style |= yaml.FlowStyle
+		}
+		byValue := make(map[string]*yaml.Node, len(ref.Content))
+		byKey := make(map[string]*yaml.Node, len(ref.Content))
+		for _, item := range ref.Content {
+			if item.Kind != yaml.ScalarNode {
+				continue
+			}
+			byValue[item.Value] = item
+			if k := envItemKey(item.Value); k != "" {
+				byKey[k] = item
+			}
+		}
+		for i, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				if i < len(ref.Content) {
+					applyLayout(item, ref.Content[i])
+				}
+				continue
+			}
+			if r, ok := byValue[item.Value]; ok {
+				applyLayout(item, r)
+			} else if r, ok := byKey[envItemKey(item.Value)]; ok {
+				applyLayout(item, r)
+			} else if envItemKey(item.Value) == "" && i < len(ref.Content) && ref.Content[i].Tag == item.Tag {
+				// 改写过的短语法项（如覆盖了主机端口的 ports）沿用同位置项的引号风格，不带注释
+				item.Style = ref.Content[i].Style
+			} else if envItemKey(item.Value) != "" && i > 0 && n.Content[i-1].Kind == yaml.ScalarNode {
+				// 新增或改名的 KEY=VALUE 项（如 Traefik label）沿用前一项的引号风格
+				item.Style = n.Content[i-1].Style
+			}
+		}
+	}
+}
+
+// orderNewServices 将 services 中 canonical（ref）没有的服务（如注入的 traefik、stargate-redis）按 canonical 各服务合并出的
+// 键顺序排列（见 orderLike）。
+func orderNewServices(services, ref *yaml.Node) {
+	if services == nil || ref == nil || services.Kind != yaml.MappingNode || ref.Kind != yaml.MappingNode {
+		return
+	}
+	known := make(map[string]bool, len(ref.Content)/2)
+	var refs []*yaml.Node
+	for i := 0; i+1 < len(ref.Content); i += 2 {
+		known[ref.Content[i].Value] = true
+		refs = append(refs, ref.Content[i+1])
+	}
+	for i := 0; i+1 < len(services.Content); i += 2 {
+		if !known[services.Content[i].Value] {
+			orderLike(services.Content[i+1], refs)
+		}
+	}
+}
+
+// orderLike 按 refs 中各映射的键顺序合并出的次序（新出现的键接在其在所属映射中的前一个键之后）排列映射 n 的键，
+// refs 都没有的键按原顺序排在其后；值为映射时以 refs 中同名键的值递归处理。
+func orderLike(n *yaml.Node, refs []*yaml.Node) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return
+	}
+	var order []string
+	children := make(map[string][]*yaml.Node)
+	for _, r := range refs {
+		if r.Kind != yaml.MappingNode {
+			continue
+		}
+		prev := -1
+		for i := 0; i+1 < len(r.Content); i += 2 {
+			key := r.Content[i].Value
+			children[key] = append(children[key], r.Content[i+1])
+			idx := -1
+			for j, k := range order {
+				if k == key {
+					idx = j
+					break
+				}
+			}
+			if idx < 0 {
+				idx = prev + 1
+				order = append(order[:idx], append([]string{key}, order[idx:]...)...)
+			}
+			prev = idx
+		}
+	}
+	index := make(map[string]int, len(order))
+	for i, k := range order {
+		index[k] = i
+	}
+	pos := make(map[*yaml.Node]int, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := n.Content[i]
+		if p, ok := index[key.Value]; ok {
+			pos[key] = p
+		} else {
+			pos[key] = len(order) + i
+		}
+		orderLike(n.Content[i+1], children[key.Value])
+	}
+	sortPairs(n.Content, pos)
+}
+
+func copyComments(n, ref *yaml.Node) {
+	n.HeadComment = ref.HeadComment
+	n.LineComment = ref.LineComment
+	n.FootComment = ref.FootComment
+}
+
+// sortPairs 按 pos 中的位置对键值对列表 kv（key, value, key, value...）做插入排序。
+func sortPairs(kv []*yaml.Node, pos map[*yaml.Node]int) {
+	for i := 2; i < len(kv); i += 2 {
+		for j := i; j >= 2 && pos[kv[j]] < pos[kv[j-2]]; j -= 2 {
+			kv[j], kv[j-2] = kv[j-2], kv[j]
+			kv[j+1], kv[j-1] = kv[j-1], kv[j+1]
+		}
+	}
+}
+
+func allScalars(nodes []*yaml.Node) bool {
+	for _, n := range nodes {
+		if n.Kind != yaml.ScalarNode {
+			return false
+		}
+	}
+	return true
+}
+
+// envItemKey 返回 KEY=VALUE 列表项的 KEY；不是该形式时返回空串。
+func envItemKey(s string) string {
+	if i := strings.Index(s, "="); i > 0 {
+		return s[:i]
+	}
+	return ""
+}
+
+// addEnvComments 为各服务 environment 列表项加上 comments 中的说明（接在 canonical 的分组注释之后）。
+func addEnvComments(doc *yaml.Node, comments map[string]string) {
+	if len(comments) == 0 {
+		return
+	}
+	services := mappingValue(layoutRoot(doc), "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 1; i < len(services.Content); i += 2 {
+		env := mappingValue(services.Content[i], "environment")
+		if env == nil || env.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, item := range env.Content {
+			key := envItemKey(item.Value)
+			if key == "" {
+				key = item.Value
+			}
+			c := comments[key]
+			if c == "" {
+				continue
+			}
+			if item.HeadComment != "" {
+				item.HeadComment += "\n"
+			}
+			item.HeadComment += "# " + c
+		}
+	}
+}
+
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// spaceSections 在顶层键之间、services 下各服务之间插入空行（与 canonical 的排版一致）；服务前的注释行与服务视为一体。
+func spaceSections(yml []byte) []byte {
+	lines := strings.Split(string(yml), "\n")
+	out := make([]string, 0, len(lines)+16)
+	top, prevIndent, prevComment := "", -1, false
+	for _, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" {
+			out = append(out, line)
+			continue
+		}
+		indent := len(line) - len(trimmed)
+		comment := strings.HasPrefix(trimmed, "#")
+		start := prevIndent >= 0 && (indent == 0 || indent == 2 && top == "services")
+		if start && prevIndent == indent && prevComment {
+			start = false
+		}
+		if start && indent == 2 && prevIndent == 0 {
+			start = false
+		}
+		if start {
+			out = append(out, "")
+		}
+		if indent == 0 && !comment {
+			top = strings.TrimSuffix(strings.SplitN(trimmed, ":", 2)[0], ":")
+		}
+		prevIndent, prevComment = indent, comment
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "\n"))
+}
@@ -0,0 +1,68 @@
+package composegen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceGenerateKeepsLayout(t *testing.T) {
+	src, err := ParseSource([]byte(`# canonical header
+
+services:
+  # Warden（看守）
+  warden:
+    image: ${WARDEN_IMAGE:-warden:test}
+    ports:
+      - "8081:8081"
+    environment:
+      - PORT=8081
+      # DingTalk channel (optional)
+      - WARDEN_URL=${WARDEN_URL:-}
+    networks:
+      - the-gate-network
+    healthcheck:
+      test: ["CMD", "true"]
+
+  warden-redis:
+    image: redis:test
+volumes:
+  warden-redis-data:
+`))
+	if err != nil {
+		t.Fatalf("ParseSource: %v", err)
+	}
+	opts := &Options{HealthCheck: true, ExposePorts: true, UseNamedVolume: true, PortWarden: "9081"}
+	gen, err := src.Generate([]string{"image"}, "", opts, &EnvMeta{Vars: map[string]EnvVarMeta{"PORT": {Comment: "服务监听端口"}}})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	yml := string(gen.Composes["image"])
+	want := `services:
+  # Warden（看守）
+  warden:
+    image: ${WARDEN_IMAGE:-warden:test}
+    ports:
+      - "9081:8081"
+    environment:
+      # 服务监听端口
+      - PORT=8081
+      # DingTalk channel (optional)
+      - WARDEN_URL=${WARDEN_URL:-}
+    networks:
+      - the-gate-network
+    healthcheck:
+      test: ["CMD", "true"]
+
+  warden-redis:
+    image: redis:test
+
+volumes:
+  warden-redis-data:
+`
+	if !strings.Contains(yml, want) {
+		t.Errorf("generated compose does not follow the canonical layout:\n%s", yml)
+	}
+	if strings.Contains(yml, "canonical header") {
+		t.Error("canonical file header should be replaced by the mode header")
+	}
+}
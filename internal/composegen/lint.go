@@ -0,0 +1,134 @@
+package composegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 生产就绪检查的严重级别：error 为上线前必须修正，warning 为建议修正。
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintFinding 为一条生产就绪检查结果；Rule 为稳定的规则 ID，可用于文档与 CI 过滤。
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Mode     string `json:"mode"`
+	Service  string `json:"service,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (f LintFinding) String() string {
+	where := f.Mode
+	if f.Service != "" {
+		where += "/" + f.Service
+	}
+	return fmt.Sprintf("%s [%s] %s: %s", f.Severity, f.Rule, where, f.Message)
+}
+
+// lintEnvRule 在服务 service 的实际环境变量 env 取值为 value（不区分大小写）时报告。
+type lintEnvRule struct {
+	id, severity string
+	service, env string
+	value        string
+	message      string
+}
+
+// lintEnvRules 为按服务环境变量取值判定的规则；变量名为服务内的名称（如 herald-totp 的 EXPOSE_SECRET_IN_ENROLL）。
+var lintEnvRules = []lintEnvRule{
+	{"herald-test-mode", LintError, "herald", "HERALD_TEST_MODE", "true", "HERALD_TEST_MODE=true returns verification codes in API responses; disable it in production"},
+	{"totp-expose-secret", LintWarning, "herald-totp", "EXPOSE_SECRET_IN_ENROLL", "true", "HERALD_TOTP_EXPOSE_SECRET_IN_ENROLL=true returns the TOTP secret on enroll; set it to false once enrollment uses the QR code only"},
+	{"warden-insecure-tls", LintError, "warden", "HTTP_INSECURE_TLS", "true", "WARDEN_HTTP_INSECURE_TLS=true skips TLS verification for the remote user list"},
+	{"audit-disabled", LintWarning, "herald", "AUDIT_ENABLED", "false", "Herald audit is disabled (HERALD_AUDIT_ENABLED=false)"},
+	{"audit-disabled", LintWarning, "stargate", "AUDIT_LOG_ENABLED", "false", "Stargate audit log is disabled (AUDIT_LOG_ENABLED=false)"},
+}
+
+// Lint 对 Generate 的结果做生产就绪检查：test-* 默认密钥、明文 PASSWORDS、测试/调试开关、Redis 端口暴露到宿主机、审计关闭等。
+// 仅检查 compose 输出（k8s 清单跳过）；结果按 mode 排序，同一 mode 内 error 在前。
+func Lint(gen *Generated) ([]LintFinding, error) {
+	if gen == nil {
+		return nil, nil
+	}
+	modes := make([]string, 0, len(gen.Composes))
+	for m := range gen.Composes {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+	var out []LintFinding
+	for _, mode := range modes {
+		findings, err := LintCompose(mode, gen.Composes[mode], gen.EnvFor(mode))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, findings...)
+	}
+	return out, nil
+}
+
+// LintCompose 检查单个 mode 的 compose 与其 .env（如磁盘上的 build/<mode>/），规则同 Lint。
+func LintCompose(mode string, composeData, env []byte) ([]LintFinding, error) {
+	if OutputFileName(mode) != "docker-compose.yml" {
+		return nil, nil
+	}
+	var compose map[string]interface{}
+	if err := yaml.Unmarshal(composeData, &compose); err != nil {
+		return nil, fmt.Errorf("lint %s: %w", mode, err)
+	}
+	vars, _ := ParseDotEnv(string(env))
+	serviceEnv := ServiceEnv(compose, vars)
+	services, _ := compose["services"].(map[string]interface{})
+	names := make([]string, 0, len(serviceEnv))
+	for n := range serviceEnv {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var out []LintFinding
+	add := func(rule, severity, service, msg string) {
+		out = append(out, LintFinding{Rule: rule, Severity: severity, Mode: mode, Service: service, Message: msg})
+	}
+	for _, name := range names {
+		env := serviceEnv[name]
+		keys := make([]string, 0, len(env))
+		for k := range env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v := env[k]
+			if IsSecretEnvKey(nil, k) && strings.HasPrefix(v, "test-") {
+				add("test-default-secret", LintError, name, fmt.Sprintf("%s uses the e2e default %q; generate a real secret (suite gen -generate-keys)", k, v))
+			}
+		}
+		if v, ok := env["PASSWORDS"]; ok && strings.HasPrefix(v, "plaintext:") {
+			add("plaintext-passwords", LintWarning, name, "PASSWORDS uses plaintext:; use a hashed format (bcrypt, sha512), e.g. from the keys page or POST /api/passwords")
+		}
+		for _, r := range lintEnvRules {
+			if r.service == name && strings.EqualFold(strings.TrimSpace(env[r.env]), r.value) {
+				add(r.id, r.severity, name, r.message)
+			}
+		}
+		if svc, ok := services[name].(map[string]interface{}); ok && isRedisService(svc) {
+			if ports, ok := svc["ports"].([]interface{}); ok && len(ports) > 0 {
+				add("redis-port-published", LintWarning, name, fmt.Sprintf("Redis port published to the host (%v); Redis has no password by default, disable exposePorts or remove the mapping", ports[0]))
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Severity != out[j].Severity {
+			return out[i].Severity == LintError
+		}
+		return false
+	})
+	return out, nil
+}
+
+func isRedisService(svc map[string]interface{}) bool {
+	image, _ := svc["image"].(string)
+	return strings.Contains(image, "redis")
+}
@@ -0,0 +1,44 @@
+package composegen
+
+import (
+	"testing"
+)
+
+// TestLintCompose 确保生产就绪检查按规则 ID 与严重级别报告 test-* 默认密钥、测试开关与 Redis 端口暴露，已替换的值不再报告。
+func TestLintCompose(t *testing.T) {
+	compose := []byte(`services:
+  herald:
+    image: herald:test
+    environment:
+      - API_KEY=${HERALD_API_KEY:-test-herald-api-key}
+      - HERALD_TEST_MODE=${HERALD_TEST_MODE:-false}
+  herald-redis:
+    image: redis:8.4-alpine
+    ports:
+      - "6379:6379"
+`)
+	findings, err := LintCompose("image", compose, []byte("HERALD_TEST_MODE=true\n"))
+	if err != nil {
+		t.Fatalf("LintCompose: %v", err)
+	}
+	got := make(map[string]string)
+	for _, f := range findings {
+		got[f.Rule+" "+f.Service] = f.Severity
+	}
+	want := map[string]string{
+		"test-default-secret herald":        LintError,
+		"herald-test-mode herald":           LintError,
+		"redis-port-published herald-redis": LintWarning,
+	}
+	for k, sev := range want {
+		if got[k] != sev {
+			t.Errorf("finding %q: want severity %q, got %q (all: %v)", k, sev, got[k], findings)
+		}
+	}
+	findings, _ = LintCompose("image", compose, []byte("HERALD_API_KEY=0123456789abcdef\n"))
+	for _, f := range findings {
+		if f.Rule == "test-default-secret" || f.Rule == "herald-test-mode" {
+			t.Errorf("unexpected finding after overriding defaults: %v", f)
+		}
+	}
+}
@@ -0,0 +1,764 @@
+package composegen
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Project 为 compose 文档的类型化视图：services 载入为 Service，顶层 networks / volumes 与其他键（configs、secrets、x-* 等）原样保留。
+// 各 map 为 nil 表示文档中没有该键，非 nil 的空 map 序列化为 {}。
+type Project struct {
+	Services map[string]*Service
+	Networks map[string]interface{}
+	Volumes  map[string]interface{}
+	Extra    map[string]interface{}
+}
+
+// Service 为单个 compose 服务：environment、labels、ports、depends_on、volumes、networks 在载入时统一列表与映射两种写法，
+// 其余键（image、healthcheck 等）原样保留在 Extra。切片为 nil 表示未声明该键，非 nil 的空切片序列化为 []。
+type Service struct {
+	Environment KeyValues
+	Labels      KeyValues
+	Ports       []Port
+	DependsOn   []Dependency
+	Volumes     []Volume
+	Networks    []ServiceNetwork
+	Extra       map[string]interface{}
+}
+
+// KeyValue 为 environment / labels 中的一项；Value 为 nil 表示只有键（environment 中的 "- KEY"，取值来自 shell 环境）。
+type KeyValue struct {
+	Key   string
+	Value *string
+}
+
+// KeyValues 为保持顺序的键值列表：列表写法按原顺序、映射写法按键名排序载入，序列化为 KEY=VALUE 列表。
+type KeyValues []KeyValue
+
+// Port 为 ports 中的一项；短语法 [host_ip:][published:]target[/protocol] 与长语法载入为同一结构，字段可含 ${VAR}。
+type Port struct {
+	HostIP    string
+	Published string
+	Target    string
+	Protocol  string
+	Extra     map[string]interface{} // 长语法中的其他键（mode、name、app_protocol 等）；非空时按长语法序列化
+}
+
+// Dependency 为 depends_on 中的一项；Condition 为空表示短语法（service_started）。
+type Dependency struct {
+	Service   string
+	Condition string
+	Extra     map[string]interface{} // restart、required 等
+}
+
+// Volume 为服务 volumes 中的一项；短语法 [source:]target[:mode] 与长语法载入为同一结构。
+type Volume struct {
+	Type     string // bind / volume / tmpfs 等；短语法按 Source 推断
+	Source   string
+	Target   string
+	ReadOnly bool
+	Mode     string                 // 短语法第三段中除 ro / rw 外的选项（如 z、cached），逗号分隔
+	Extra    map[string]interface{} // 长语法中的其他键（bind、volume、consistency 等）；非空时按长语法序列化
+}
+
+// ServiceNetwork 为服务加入的网络；Extra 为映射写法中的设置（aliases、ipv4_address 等），全部为空时序列化为列表。
+type ServiceNetwork struct {
+	Name  string
+	Extra map[string]interface{}
+}
+
+// Get 返回 key 的值；只有键（Value 为 nil）时返回空串与 true。
+func (kv KeyValues) Get(key string) (string, bool) {
+	for _, item := range kv {
+		if item.Key == key {
+			if item.Value == nil {
+				return "", true
+			}
+			return *item.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set 将 key 设为 value：已存在时原位替换，否则追加到末尾。
+func (kv *KeyValues) Set(key, value string) {
+	if !kv.Replace(key, value) {
+		*kv = append(*kv, KeyValue{Key: key, Value: &value})
+	}
+}
+
+// Replace 仅在 key 已存在时将其设为 value，返回是否替换。
+func (kv KeyValues) Replace(key, value string) bool {
+	for i := range kv {
+		if kv[i].Key == key {
+			kv[i].Value = &value
+			return true
+		}
+	}
+	return false
+}
+
+// Update 对每个有值的项调用 fn，fn 返回 true 时以其结果替换该值。
+func (kv KeyValues) Update(fn func(key, value string) (string, bool)) {
+	for i := range kv {
+		if kv[i].Value == nil {
+			continue
+		}
+		if v, ok := fn(kv[i].Key, *kv[i].Value); ok {
+			kv[i].Value = &v
+		}
+	}
+}
+
+// Filter 保留 keep 返回 true 的项；原为非 nil 时结果也非 nil（序列化时保留空列表）。
+func (kv *KeyValues) Filter(keep func(KeyValue) bool) {
+	if *kv == nil {
+		return
+	}
+	out := make(KeyValues, 0, len(*kv))
+	for _, item := range *kv {
+		if keep(item) {
+			out = append(out, item)
+		}
+	}
+	*kv = out
+}
+
+// HasDependency 返回 depends_on 中是否有 service。
+func (s *Service) HasDependency(service string) bool {
+	for _, d := range s.DependsOn {
+		if d.Service == service {
+			return true
+		}
+	}
+	return false
+}
+
+// AddDependency 添加依赖；已存在时更新其 condition。
+func (s *Service) AddDependency(service, condition string) {
+	for i := range s.DependsOn {
+		if s.DependsOn[i].Service == service {
+			s.DependsOn[i].Condition = condition
+			return
+		}
+	}
+	s.DependsOn = append(s.DependsOn, Dependency{Service: service, Condition: condition})
+}
+
+// RemoveDependency 从 depends_on 中移除 service；移除后为空时去掉 depends_on。
+func (s *Service) RemoveDependency(service string) {
+	var kept []Dependency
+	for _, d := range s.DependsOn {
+		if d.Service != service {
+			kept = append(kept, d)
+		}
+	}
+	s.DependsOn = kept
+}
+
+// ProjectFromMap 将 ParseCompose / LoadCompose 的结果载入为 Project；所有值（含 Extra 中嵌套的映射与列表）均为深拷贝，
+// 修改 Project 不会影响 compose，多个 goroutine 可同时从同一份 compose 载入。
+func ProjectFromMap(compose map[string]interface{}) (*Project, error) {
+	p := &Project{Extra: make(map[string]interface{})}
+	for k, v := range compose {
+		switch k {
+		case "services":
+			services, ok := toStringMap(v)
+			if !ok {
+				return nil, fmt.Errorf("services: expected a mapping, got %T", v)
+			}
+			p.Services = make(map[string]*Service, len(services))
+			for name, s := range services {
+				svc, err := ServiceFromMap(name, s)
+				if err != nil {
+					return nil, err
+				}
+				p.Services[name] = svc
+			}
+		case "networks", "volumes":
+			m, ok := toStringMap(v)
+			if !ok && v != nil {
+				return nil, fmt.Errorf("%s: expected a mapping, got %T", k, v)
+			}
+			if m != nil {
+				m, _ = deepCopy(m).(map[string]interface{})
+			}
+			if k == "networks" {
+				p.Networks = m
+			} else {
+				p.Volumes = m
+			}
+		default:
+			p.Extra[k] = deepCopy(v)
+		}
+	}
+	return p, nil
+}
+
+// Map 将 Project 序列化为 compose map（与 ParseCompose 的形态一致），供 YAML 编码及 k8s / swarm 转换使用。
+func (p *Project) Map() map[string]interface{} {
+	out := make(map[string]interface{}, len(p.Extra)+3)
+	for k, v := range p.Extra {
+		out[k] = v
+	}
+	if p.Services != nil {
+		services := make(map[string]interface{}, len(p.Services))
+		for name, svc := range p.Services {
+			services[name] = svc.Map()
+		}
+		out["services"] = services
+	}
+	if p.Networks != nil {
+		out["networks"] = p.Networks
+	}
+	if p.Volumes != nil {
+		out["volumes"] = p.Volumes
+	}
+	return out
+}
+
+// ServiceFromMap 载入名为 name 的服务（name 仅用于错误信息）。
+func ServiceFromMap(name string, v interface{}) (*Service, error) {
+	m, ok := toStringMap(v)
+	if !ok {
+		return nil, fmt.Errorf("services.%s: expected a mapping, got %T", name, v)
+	}
+	svc := &Service{Extra: make(map[string]interface{}, len(m))}
+	var err error
+	for k, val := range m {
+		where := "services." + name + "." + k
+		switch k {
+		case "environment":
+			svc.Environment, err = parseKeyValues(where, val)
+		case "labels":
+			svc.Labels, err = parseKeyValues(where, val)
+		case "ports":
+			svc.Ports, err = parsePorts(where, val)
+		case "depends_on":
+			svc.DependsOn, err = parseDependsOn(where, val)
+		case "volumes":
+			svc.Volumes, err = parseVolumes(where, val)
+		case "networks":
+			svc.Networks, err = parseServiceNetworks(where, val)
+		default:
+			svc.Extra[k] = deepCopy(val)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return svc, nil
+}
+
+// Map 将服务序列化为 compose map：environment / labels 为 KEY=VALUE 列表，ports / volumes 能用短语法时用短语法，
+// depends_on 全部为短语法时为列表、否则为带 condition 的映射，networks 无设置时为列表。
+func (s *Service) Map() map[string]interface{} {
+	out := make(map[string]interface{}, len(s.Extra)+6)
+	for k, v := range s.Extra {
+		out[k] = v
+	}
+	if s.Environment != nil {
+		out["environment"] = s.Environment.list()
+	}
+	if s.Labels != nil {
+		out["labels"] = s.Labels.list()
+	}
+	if s.Ports != nil {
+		ports := make([]interface{}, 0, len(s.Ports))
+		for _, p := range s.Ports {
+			ports = append(ports, p.value())
+		}
+		out["ports"] = ports
+	}
+	if s.DependsOn != nil {
+		out["depends_on"] = dependsOnValue(s.DependsOn)
+	}
+	if s.Volumes != nil {
+		vols := make([]interface{}, 0, len(s.Volumes))
+		for _, v := range s.Volumes {
+			vols = append(vols, v.value())
+		}
+		out["volumes"] = vols
+	}
+	if s.Networks != nil {
+		out["networks"] = serviceNetworksValue(s.Networks)
+	}
+	return out
+}
+
+// deepCopy 递归复制 YAML 解码得到的映射与列表（map[interface{}]interface{} 转为 map[string]interface{}），标量原样返回。
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[k] = deepCopy(val)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[fmt.Sprint(k)] = deepCopy(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = deepCopy(val)
+		}
+		return out
+	}
+	return v
+}
+
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			out[fmt.Sprint(k)] = val
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// scalarString 将 YAML 标量（字符串、数字、布尔）转为字符串。
+func scalarString(v interface{}) (string, bool) {
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case int, int64, uint64, float64, bool:
+		return fmt.Sprint(t), true
+	}
+	return "", false
+}
+
+func parseKeyValues(where string, v interface{}) (KeyValues, error) {
+	if v == nil {
+		return KeyValues{}, nil
+	}
+	if list, ok := v.([]interface{}); ok {
+		out := make(KeyValues, 0, len(list))
+		for i, item := range list {
+			s, ok := scalarString(item)
+			if !ok {
+				return nil, fmt.Errorf("%s[%d]: expected KEY=VALUE, got %T", where, i, item)
+			}
+			if idx := strings.Index(s, "="); idx >= 0 {
+				val := s[idx+1:]
+				out = append(out, KeyValue{Key: s[:idx], Value: &val})
+			} else {
+				out = append(out, KeyValue{Key: s})
+			}
+		}
+		return out, nil
+	}
+	m, ok := toStringMap(v)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected a list or mapping, got %T", where, v)
+	}
+	out := make(KeyValues, 0, len(m))
+	for _, k := range sortedMapKeys(m) {
+		if m[k] == nil {
+			out = append(out, KeyValue{Key: k})
+			continue
+		}
+		s, ok := scalarString(m[k])
+		if !ok {
+			return nil, fmt.Errorf("%s.%s: expected a scalar, got %T", where, k, m[k])
+		}
+		out = append(out, KeyValue{Key: k, Value: &s})
+	}
+	return out, nil
+}
+
+func (kv KeyValues) list() []interface{} {
+	out := make([]interface{}, 0, len(kv))
+	for _, item := range kv {
+		if item.Value == nil {
+			out = append(out, item.Key)
+		} else {
+			out = append(out, item.Key+"="+*item.Value)
+		}
+	}
+	return out
+}
+
+// splitOutside 按 sep 切分 s，跳过 ${...} 与 [...] 内部（变量默认值中的 :-、IPv6 地址中的冒号）。
+func splitOutside(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{', s[i] == '[':
+			depth++
+		case (s[i] == '}' || s[i] == ']') && depth > 0:
+			depth--
+		case s[i] == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func parsePorts(where string, v interface{}) ([]Port, error) {
+	list, ok := v.([]interface{})
+	if !ok && v != nil {
+		return nil, fmt.Errorf("%s: expected a list, got %T", where, v)
+	}
+	out := make([]Port, 0, len(list))
+	for i, item := range list {
+		if m, ok := toStringMap(item); ok {
+			p := Port{Extra: make(map[string]interface{})}
+			for k, val := range m {
+				switch k {
+				case "target", "published", "host_ip", "protocol":
+					s, ok := scalarString(val)
+					if !ok {
+						return nil, fmt.Errorf("%s[%d].%s: expected a scalar, got %T", where, i, k, val)
+					}
+					switch k {
+					case "target":
+						p.Target = s
+					case "published":
+						p.Published = s
+					case "host_ip":
+						p.HostIP = s
+					default:
+						p.Protocol = s
+					}
+				default:
+					p.Extra[k] = deepCopy(val)
+				}
+			}
+			out = append(out, p)
+			continue
+		}
+		s, ok := scalarString(item)
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: expected a port, got %T", where, i, item)
+		}
+		var p Port
+		if idx := strings.LastIndex(s, "/"); idx >= 0 && !strings.ContainsAny(s[idx:], "}]:") {
+			s, p.Protocol = s[:idx], s[idx+1:]
+		}
+		parts := splitOutside(s, ':')
+		switch len(parts) {
+		case 1:
+			p.Target = parts[0]
+		case 2:
+			p.Published, p.Target = parts[0], parts[1]
+		case 3:
+			p.HostIP, p.Published, p.Target = parts[0], parts[1], parts[2]
+		default:
+			return nil, fmt.Errorf("%s[%d]: invalid port %q", where, i, item)
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Short 返回端口的短语法；有长语法专属设置时返回空串。
+func (p Port) Short() string {
+	if len(p.Extra) > 0 {
+		return ""
+	}
+	s := p.Target
+	if p.Published != "" || p.HostIP != "" {
+		s = p.Published + ":" + s
+	}
+	if p.HostIP != "" {
+		s = p.HostIP + ":" + s
+	}
+	if p.Protocol != "" {
+		s += "/" + p.Protocol
+	}
+	return s
+}
+
+func (p Port) value() interface{} {
+	if s := p.Short(); s != "" {
+		return s
+	}
+	m := make(map[string]interface{}, len(p.Extra)+4)
+	for k, v := range p.Extra {
+		m[k] = v
+	}
+	if n, err := strconv.Atoi(p.Target); err == nil {
+		m["target"] = n
+	} else {
+		m["target"] = p.Target
+	}
+	if p.Published != "" {
+		m["published"] = p.Published
+	}
+	if p.HostIP != "" {
+		m["host_ip"] = p.HostIP
+	}
+	if p.Protocol != "" {
+		m["protocol"] = p.Protocol
+	}
+	return m
+}
+
+func parseDependsOn(where string, v interface{}) ([]Dependency, error) {
+	if list, ok := v.([]interface{}); ok {
+		out := make([]Dependency, 0, len(list))
+		for i, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s[%d]: expected a service name, got %T", where, i, item)
+			}
+			out = append(out, Dependency{Service: s})
+		}
+		return out, nil
+	}
+	m, ok := toStringMap(v)
+	if !ok && v != nil {
+		return nil, fmt.Errorf("%s: expected a list or mapping, got %T", where, v)
+	}
+	out := make([]Dependency, 0, len(m))
+	for _, name := range sortedMapKeys(m) {
+		d := Dependency{Service: name}
+		if m[name] != nil {
+			opts, ok := toStringMap(m[name])
+			if !ok {
+				return nil, fmt.Errorf("%s.%s: expected a mapping, got %T", where, name, m[name])
+			}
+			for k, val := range opts {
+				if k == "condition" {
+					d.Condition, _ = val.(string)
+					continue
+				}
+				if d.Extra == nil {
+					d.Extra = make(map[string]interface{})
+				}
+				d.Extra[k] = deepCopy(val)
+			}
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func dependsOnValue(deps []Dependency) interface{} {
+	short := true
+	for _, d := range deps {
+		if d.Condition != "" || len(d.Extra) > 0 {
+			short = false
+			break
+		}
+	}
+	if short {
+		out := make([]interface{}, 0, len(deps))
+		for _, d := range deps {
+			out = append(out, d.Service)
+		}
+		return out
+	}
+	out := make(map[string]interface{}, len(deps))
+	for _, d := range deps {
+		m := make(map[string]interface{}, len(d.Extra)+1)
+		for k, v := range d.Extra {
+			m[k] = v
+		}
+		m["condition"] = d.Condition
+		if d.Condition == "" {
+			m["condition"] = "service_started"
+		}
+		out[d.Service] = m
+	}
+	return out
+}
+
+// volumeSourceType 推断短语法 source 的类型：路径（含以变量开头的路径）为 bind，其余为命名卷，空为匿名卷。
+func volumeSourceType(source string) string {
+	if source == "" || strings.HasPrefix(source, "/") || strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~") || strings.HasPrefix(source, "$") {
+		return "bind"
+	}
+	return "volume"
+}
+
+func parseVolumes(where string, v interface{}) ([]Volume, error) {
+	list, ok := v.([]interface{})
+	if !ok && v != nil {
+		return nil, fmt.Errorf("%s: expected a list, got %T", where, v)
+	}
+	out := make([]Volume, 0, len(list))
+	for i, item := range list {
+		if m, ok := toStringMap(item); ok {
+			vol := Volume{Extra: make(map[string]interface{})}
+			for k, val := range m {
+				switch k {
+				case "type":
+					vol.Type, _ = val.(string)
+				case "source":
+					vol.Source, _ = val.(string)
+				case "target":
+					vol.Target, _ = val.(string)
+				case "read_only":
+					vol.ReadOnly, _ = val.(bool)
+				default:
+					vol.Extra[k] = deepCopy(val)
+				}
+			}
+			out = append(out, vol)
+			continue
+		}
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s[%d]: expected a volume, got %T", where, i, item)
+		}
+		var vol Volume
+		parts := splitOutside(s, ':')
+		switch len(parts) {
+		case 1:
+			vol.Target = parts[0]
+		case 2, 3:
+			vol.Source, vol.Target = parts[0], parts[1]
+		default:
+			return nil, fmt.Errorf("%s[%d]: invalid volume %q", where, i, s)
+		}
+		if vol.Source == "" {
+			vol.Type = "volume"
+		} else {
+			vol.Type = volumeSourceType(vol.Source)
+		}
+		if len(parts) == 3 {
+			var opts []string
+			for _, o := range strings.Split(parts[2], ",") {
+				switch o {
+				case "ro":
+					vol.ReadOnly = true
+				case "rw", "":
+				default:
+					opts = append(opts, o)
+				}
+			}
+			vol.Mode = strings.Join(opts, ",")
+		}
+		out = append(out, vol)
+	}
+	return out, nil
+}
+
+// Short 返回卷挂载的短语法；短语法无法表达（tmpfs、有长语法设置、source 会被推断为其他类型）时返回空串。
+func (v Volume) Short() string {
+	if len(v.Extra) > 0 {
+		return ""
+	}
+	if v.Source == "" {
+		if v.Type != "volume" || v.ReadOnly || v.Mode != "" {
+			return ""
+		}
+		return v.Target
+	}
+	if volumeSourceType(v.Source) != v.Type {
+		return ""
+	}
+	s := v.Source + ":" + v.Target
+	var opts []string
+	if v.ReadOnly {
+		opts = append(opts, "ro")
+	}
+	if v.Mode != "" {
+		opts = append(opts, v.Mode)
+	}
+	if len(opts) > 0 {
+		s += ":" + strings.Join(opts, ",")
+	}
+	return s
+}
+
+func (v Volume) value() interface{} {
+	if s := v.Short(); s != "" {
+		return s
+	}
+	m := make(map[string]interface{}, len(v.Extra)+4)
+	for k, val := range v.Extra {
+		m[k] = val
+	}
+	m["type"] = v.Type
+	m["target"] = v.Target
+	if v.Source != "" {
+		m["source"] = v.Source
+	}
+	if v.ReadOnly {
+		m["read_only"] = true
+	}
+	return m
+}
+
+func parseServiceNetworks(where string, v interface{}) ([]ServiceNetwork, error) {
+	if list, ok := v.([]interface{}); ok {
+		out := make([]ServiceNetwork, 0, len(list))
+		for i, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s[%d]: expected a network name, got %T", where, i, item)
+			}
+			out = append(out, ServiceNetwork{Name: s})
+		}
+		return out, nil
+	}
+	m, ok := toStringMap(v)
+	if !ok && v != nil {
+		return nil, fmt.Errorf("%s: expected a list or mapping, got %T", where, v)
+	}
+	out := make([]ServiceNetwork, 0, len(m))
+	for _, name := range sortedMapKeys(m) {
+		n := ServiceNetwork{Name: name}
+		if m[name] != nil {
+			settings, ok := toStringMap(m[name])
+			if !ok {
+				return nil, fmt.Errorf("%s.%s: expected a mapping, got %T", where, name, m[name])
+			}
+			if len(settings) > 0 {
+				n.Extra, _ = deepCopy(settings).(map[string]interface{})
+			}
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func serviceNetworksValue(networks []ServiceNetwork) interface{} {
+	short := true
+	for _, n := range networks {
+		if len(n.Extra) > 0 {
+			short = false
+			break
+		}
+	}
+	if short {
+		out := make([]interface{}, 0, len(networks))
+		for _, n := range networks {
+			out = append(out, n.Name)
+		}
+		return out
+	}
+	out := make(map[string]interface{}, len(networks))
+	for _, n := range networks {
+		if len(n.Extra) == 0 {
+			out[n.Name] = nil
+		} else {
+			out[n.Name] = n.Extra
+		}
+	}
+	return out
+}
@@ -0,0 +1,62 @@
+package composegen
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestProjectNormalizesServiceForms(t *testing.T) {
+	compose, err := ParseCompose([]byte(`
+services:
+  herald:
+    image: herald
+    environment:
+      REDIS_URL: redis:6379
+      PORT: 8082
+    ports:
+      - target: 8082
+        published: "${HERALD_PORT:-8082}"
+        protocol: tcp
+    depends_on:
+      - herald-redis
+    volumes:
+      - type: bind
+        source: ./data
+        target: /data
+        read_only: true
+    networks: [the-gate-network]
+`))
+	if err != nil {
+		t.Fatalf("ParseCompose: %v", err)
+	}
+	p, err := ProjectFromMap(compose)
+	if err != nil {
+		t.Fatalf("ProjectFromMap: %v", err)
+	}
+	svc := p.Services["herald"]
+	if v, _ := svc.Environment.Get("PORT"); v != "8082" {
+		t.Errorf("PORT = %q, want 8082", v)
+	}
+	svc.Environment.Set("REDIS_URL", "herald-redis:6379")
+	svc.AddDependency("herald-redis", "service_healthy")
+
+	out, err := yaml.Marshal(p.Map())
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	for _, want := range []string{
+		"- PORT=8082\n", "- REDIS_URL=herald-redis:6379\n",
+		"- ${HERALD_PORT:-8082}:8082/tcp\n", "- ./data:/data:ro\n",
+		"depends_on:\n            herald-redis:\n                condition: service_healthy\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("serialized service missing %q:\n%s", want, out)
+		}
+	}
+	env := compose["services"].(map[string]interface{})["herald"].(map[string]interface{})["environment"].(map[string]interface{})
+	if env["REDIS_URL"] != "redis:6379" {
+		t.Errorf("source compose was modified: REDIS_URL = %v", env["REDIS_URL"])
+	}
+}
@@ -0,0 +1,156 @@
+// Package composegen: split modes (config/modes.yaml) — which services, volumes and networks each compose mode keeps.
+package composegen
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/soulteary/the-gate/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Mode 网络方式（ModeDef.Network）。
+const (
+	ModeNetworkCanonical = "canonical" // 保留 canonical 的顶层 networks（含 Traefik 外部网络）
+	ModeNetworkExternal  = "external"  // the-gate-network 为外部网络，与其他独立 compose 共用；服务使用 traefik 网络时一并声明为外部网络
+	ModeNetworkBridge    = "bridge"    // 自建 bridge 网络、不接入 Traefik（按 Options.TraefikNetwork=false 处理）
+)
+
+// ModeDef 定义一个由 canonical 切分生成的 compose mode（见 config/modes.yaml）。
+type ModeDef struct {
+	Name     string   `yaml:"name"`
+	Services []string `yaml:"services"` // 为空表示保留全部服务及全部顶层 volumes
+	Volumes  []string `yaml:"volumes"`  // 保留的顶层命名卷（Services 非空时有效）
+	Network  string   `yaml:"network"`  // ModeNetwork*，为空时同 canonical
+	// RewriteStargateURLs 为 true 时 stargate 以容器名访问 Herald / Warden / herald-totp 与自身 forwardauth 地址，并去掉 depends_on（依赖服务在其他 compose 中）
+	RewriteStargateURLs bool                    `yaml:"rewriteStargateUrls"`
+	Build               map[string]BuildContext `yaml:"build"`  // 服务名 -> build 配置，生成时以 build 替换 image
+	Header              string                  `yaml:"header"` // 文件头说明，每行输出为一行注释
+}
+
+// BuildContext 为 ModeDef.Build 中单个服务的 build 配置（context 相对 stargate-suite 根目录）。
+type BuildContext struct {
+	Context    string `yaml:"context"`
+	Dockerfile string `yaml:"dockerfile"`
+}
+
+// modesFile 对应 config/modes.yaml。
+type modesFile struct {
+	Modes []ModeDef `yaml:"modes"`
+}
+
+// reservedModes 为非切分方式生成的 mode（swarm / k8s 以 traefik mode 的服务集合转换），不可在 modes.yaml 中定义。
+var reservedModes = map[string]bool{"swarm": true, "k8s": true}
+
+// DefaultModeDefs 为未提供 config/modes.yaml 时的内置 mode 定义：编译时嵌入的仓库 config/modes.yaml。
+var DefaultModeDefs = mustParseModes(config.ModesYAML)
+
+// mustParseModes 解析嵌入的 modes.yaml；内容无效属于构建错误，直接 panic。
+func mustParseModes(data []byte) []ModeDef {
+	defs, err := ParseModes(data)
+	if err != nil {
+		panic("embedded config/modes.yaml: " + err.Error())
+	}
+	return defs
+}
+
+// LoadModes 读取并校验 modes.yaml；文件不存在时返回 nil, nil（调用方使用 DefaultModeDefs）。
+func LoadModes(path string) ([]ModeDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read modes: %w", err)
+	}
+	return ParseModes(data)
+}
+
+// ParseModes 解析并校验 modes.yaml 内容：mode 名唯一且非 swarm / k8s，network 取值合法，且须定义 traefik（swarm / k8s 以其为基础）。
+func ParseModes(data []byte) ([]ModeDef, error) {
+	var f modesFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse modes: %w", err)
+	}
+	seen := make(map[string]bool, len(f.Modes))
+	for i, d := range f.Modes {
+		switch {
+		case d.Name == "":
+			return nil, fmt.Errorf("modes[%d]: name is required", i)
+		case reservedModes[d.Name]:
+			return nil, fmt.Errorf("modes[%d]: %q is generated from the traefik mode and cannot be redefined", i, d.Name)
+		case seen[d.Name]:
+			return nil, fmt.Errorf("modes[%d]: duplicate mode %q", i, d.Name)
+		}
+		seen[d.Name] = true
+		switch d.Network {
+		case "", ModeNetworkCanonical, ModeNetworkExternal, ModeNetworkBridge:
+		default:
+			return nil, fmt.Errorf("mode %s: unknown network %q (want %s, %s or %s)", d.Name, d.Network, ModeNetworkCanonical, ModeNetworkExternal, ModeNetworkBridge)
+		}
+		if len(d.Services) == 0 && len(d.Volumes) > 0 {
+			return nil, fmt.Errorf("mode %s: volumes requires services", d.Name)
+		}
+	}
+	if !seen["traefik"] {
+		return nil, fmt.Errorf("modes: traefik mode is required (swarm and k8s are generated from it)")
+	}
+	return f.Modes, nil
+}
+
+// ModeNames 返回 defs 中的 mode 名（按定义顺序）；defs 为空时为 DefaultModeDefs。
+func ModeNames(defs []ModeDef) []string {
+	if len(defs) == 0 {
+		defs = DefaultModeDefs
+	}
+	names := make([]string, 0, len(defs))
+	for _, d := range defs {
+		names = append(names, d.Name)
+	}
+	return names
+}
+
+// IsGeneratedMode 判断 mode 能否生成：defs（为空时为 DefaultModeDefs）中的 mode，或 swarm / k8s。
+func IsGeneratedMode(defs []ModeDef, mode string) bool {
+	return reservedModes[mode] || lookupModeDef(defs, mode) != nil
+}
+
+// lookupModeDef 在 defs（为空时为 DefaultModeDefs）中查找 mode；未定义时返回 nil。
+func lookupModeDef(defs []ModeDef, mode string) *ModeDef {
+	if len(defs) == 0 {
+		defs = DefaultModeDefs
+	}
+	for i := range defs {
+		if defs[i].Name == mode {
+			return &defs[i]
+		}
+	}
+	return nil
+}
+
+// modeDef 返回 s.Modes（为空时为 DefaultModeDefs）中名为 mode 的定义。
+func (s *Source) modeDef(mode string) (*ModeDef, error) {
+	if def := lookupModeDef(s.Modes, mode); def != nil {
+		return def, nil
+	}
+	return nil, fmt.Errorf("unknown mode: %s", mode)
+}
+
+// headerComment 将 Header 转为文件头注释：每行加 "# "，末尾以单独的 "#" 与正文分隔。
+func (d *ModeDef) headerComment() string {
+	text := strings.TrimRight(d.Header, "\n")
+	if text == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if line == "" {
+			b.WriteString("#\n")
+			continue
+		}
+		b.WriteString("# " + line + "\n")
+	}
+	b.WriteString("#\n")
+	return b.String()
+}
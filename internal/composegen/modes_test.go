@@ -0,0 +1,81 @@
+package composegen
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// TestModesConfig 确保内置 DefaultModeDefs 即嵌入的 config/modes.yaml，且新增的 mode 无需改代码即可生成。
+func TestModesConfig(t *testing.T) {
+	defs, err := LoadModes("../../config/modes.yaml")
+	if err != nil {
+		t.Fatalf("LoadModes: %v", err)
+	}
+	if !reflect.DeepEqual(defs, DefaultModeDefs) {
+		t.Errorf("config/modes.yaml differs from DefaultModeDefs:\n%#v", defs)
+	}
+	if d := lookupModeDef(nil, "traefik-stargate"); d == nil || !d.RewriteStargateURLs || d.Network != ModeNetworkExternal {
+		t.Errorf("default traefik-stargate mode = %+v", d)
+	}
+	if d := lookupModeDef(nil, "build"); d == nil || d.Build["herald"].Context != "../../herald" {
+		t.Errorf("default build mode = %+v", d)
+	}
+	if _, err := ParseModes([]byte("modes:\n  - name: image\n")); err == nil {
+		t.Error("modes without traefik should be rejected")
+	}
+
+	defs, err = ParseModes([]byte(`modes:
+  - name: traefik
+  - name: traefik-herald-warden
+    services: [herald, warden, warden-redis]
+    volumes: [warden-redis-data]
+    network: external
+    header: |
+      Herald + Warden
+`))
+	if err != nil {
+		t.Fatalf("ParseModes: %v", err)
+	}
+	src, err := ParseSource([]byte(`
+services:
+  herald:
+    image: herald:test
+    networks: [the-gate-network]
+  warden:
+    image: warden:test
+    networks: [the-gate-network]
+  warden-redis:
+    image: redis:test
+  stargate:
+    image: stargate:test
+volumes:
+  herald-redis-data:
+  warden-redis-data:
+`))
+	if err != nil {
+		t.Fatalf("ParseSource: %v", err)
+	}
+	src.Modes = defs
+	gen, err := src.Generate([]string{"traefik-herald-warden"}, "", nil, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	yml := gen.Composes["traefik-herald-warden"]
+	if !bytes.HasPrefix(yml, []byte("# Herald + Warden\n#\n")) {
+		t.Errorf("missing mode header:\n%s", yml)
+	}
+	p := generatedProject(t, gen, "traefik-herald-warden")
+	if len(p.Services) != 3 || p.Services["stargate"] != nil {
+		t.Errorf("services = %v, want herald, warden, warden-redis", p.Services)
+	}
+	if _, ok := p.Volumes["warden-redis-data"]; !ok || len(p.Volumes) != 1 {
+		t.Errorf("volumes = %v, want warden-redis-data", p.Volumes)
+	}
+	if n, _ := p.Networks["the-gate-network"].(map[string]interface{}); n["external"] != true {
+		t.Errorf("the-gate-network should be external: %v", p.Networks)
+	}
+	if _, err := src.Generate([]string{"traefik-herald"}, "", nil, nil); err == nil {
+		t.Error("modes missing from Source.Modes should be unknown")
+	}
+}
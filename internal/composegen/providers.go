@@ -0,0 +1,354 @@
+// Package composegen: Herald channel providers (config/providers.yaml) — optional channel services, their env keys, Herald-side wiring and local mock companions.
+package composegen
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/soulteary/the-gate/config"
+	"gopkg.in/yaml.v3"
+)
+
+// Provider 描述一个 Herald 通道（config/providers.yaml 中 composegen 读取的字段；sections 等 Web UI 字段由 serve 读取）。
+// 通道由 Options.Providers[Option] 启用；未启用时移除其服务、Herald 侧接线与 .env 变量。
+type Provider struct {
+	ID     string `yaml:"id"`     // 服务名，容器名为 <前缀><ID>；Builtin 时仅作标识
+	Option string `yaml:"option"` // 启用开关（Options.Providers 的键）；Builtin 时可省略，表示始终启用
+	// Builtin 为 true 表示通道内置于 herald（如短信 HTTP API），没有独立服务：mock 的 Env 写入 herald 服务，herald depends_on mock
+	Builtin    bool     `yaml:"builtin"`
+	Port       string   `yaml:"port"`       // 可覆盖主机端口的容器端口
+	PortOption string   `yaml:"portOption"` // 主机端口选项（Options.Providers 的键）
+	EnvKeys    []string `yaml:"envKeys"`    // 通道专属的 .env 变量，未启用时从 .env 移除
+	// Herald 为 herald 服务 environment 中的接线项（KEY=VALUE，如 HERALD_SMTP_API_URL=${HERALD_SMTP_API_URL:-http://herald-smtp:8085}）：
+	// 启用时写入（替换 canonical 中的同名项），其 ${VAR:-默认值} 的默认值在变量为空时写入 .env；未启用时移除
+	Herald []string `yaml:"herald"`
+	// Service 为服务定义（同 compose 的 services.<ID>）；canonical 中已定义同名服务时以 canonical 为准，可省略
+	Service map[string]interface{} `yaml:"service"`
+	Mock    *ProviderMock          `yaml:"mock"` // 可选的本地 mock（如 SMTP 通道的 OwlMail、钉钉的 dingtalk-mock、短信的 sms-sink），仅通道启用时生效
+}
+
+// ProviderMock 为通道的本地替身服务（测试时代替真实外部服务，如捕获邮件的 OwlMail、收集短信的 sms-sink）。
+type ProviderMock struct {
+	ID         string `yaml:"id"`         // 服务名，容器名为 <前缀><ID>
+	Option     string `yaml:"option"`     // 启用开关（Options.Providers 的键）
+	Port       string `yaml:"port"`       // 可覆盖主机端口的容器端口
+	PortOption string `yaml:"portOption"` // 主机端口选项（Options.Providers 的键）
+	// Env 为通道服务（Builtin 时为 herald）指向 mock 的 environment（KEY=VALUE），同时写入 .env 的同名变量
+	Env     []string               `yaml:"env"`
+	Service map[string]interface{} `yaml:"service"` // 服务定义，注入到 compose；通道服务 depends_on 该服务
+}
+
+// providersFile 对应 config/providers.yaml。
+type providersFile struct {
+	Providers []Provider `yaml:"providers"`
+}
+
+// DefaultProviders 为未提供 config/providers.yaml 时的内置通道：编译时嵌入的仓库 config/providers.yaml。
+var DefaultProviders = mustParseProviders(config.ProvidersYAML)
+
+// mustParseProviders 解析嵌入的 providers.yaml；内容无效属于构建错误，直接 panic。
+func mustParseProviders(data []byte) []Provider {
+	providers, err := ParseProviders(data)
+	if err != nil {
+		panic("embedded config/providers.yaml: " + err.Error())
+	}
+	return providers
+}
+
+// LoadProviders 读取并校验 providers.yaml；文件不存在时返回 nil, nil（调用方使用 DefaultProviders）。
+func LoadProviders(path string) ([]Provider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read providers: %w", err)
+	}
+	return ParseProviders(data)
+}
+
+// ParseProviders 解析并校验 providers.yaml 内容：id 必填，option 除 builtin 外必填，服务名与选项名不重复，端口为数字，
+// herald / env 为 KEY=VALUE，mock 须带服务定义，builtin 通道不可带服务定义。
+func ParseProviders(data []byte) ([]Provider, error) {
+	var f providersFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse providers: %w", err)
+	}
+	ids := make(map[string]bool)
+	options := make(map[string]bool)
+	claim := func(where string, seen map[string]bool, kind, v string) error {
+		if v == "" {
+			return nil
+		}
+		if seen[v] {
+			return fmt.Errorf("%s: duplicate %s %q", where, kind, v)
+		}
+		seen[v] = true
+		return nil
+	}
+	for i, p := range f.Providers {
+		where := fmt.Sprintf("providers[%d]", i)
+		if p.ID == "" {
+			return nil, fmt.Errorf("%s: id is required", where)
+		}
+		where = "provider " + p.ID
+		switch {
+		case p.Option == "" && !p.Builtin:
+			return nil, fmt.Errorf("%s: option is required", where)
+		case p.Builtin && (len(p.Service) > 0 || p.Port != ""):
+			return nil, fmt.Errorf("%s: builtin channel runs inside herald and cannot define service or port", where)
+		}
+		for _, err := range []error{
+			claim(where, ids, "service", p.ID),
+			claim(where, options, "option", p.Option),
+			claim(where, options, "option", p.PortOption),
+			checkProviderPort(where, p.Port),
+			checkKeyValueItems(where+": herald", p.Herald),
+		} {
+			if err != nil {
+				return nil, err
+			}
+		}
+		if m := p.Mock; m != nil {
+			where += ": mock"
+			switch {
+			case m.ID == "":
+				return nil, fmt.Errorf("%s: id is required", where)
+			case m.Option == "":
+				return nil, fmt.Errorf("%s %s: option is required", where, m.ID)
+			case len(m.Service) == 0:
+				return nil, fmt.Errorf("%s %s: service is required", where, m.ID)
+			}
+			for _, err := range []error{
+				claim(where, ids, "service", m.ID),
+				claim(where, options, "option", m.Option),
+				claim(where, options, "option", m.PortOption),
+				checkProviderPort(where, m.Port),
+				checkKeyValueItems(where+": env", m.Env),
+			} {
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return f.Providers, nil
+}
+
+// checkProviderPort 校验描述中的容器端口（可为空）。
+func checkProviderPort(where, port string) error {
+	if port == "" {
+		return nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%s: invalid port %q", where, port)
+	}
+	return nil
+}
+
+// checkKeyValueItems 校验 environment 形式的 KEY=VALUE 列表。
+func checkKeyValueItems(where string, items []string) error {
+	for _, item := range items {
+		if k, _, ok := strings.Cut(item, "="); !ok || strings.TrimSpace(k) == "" {
+			return fmt.Errorf("%s: expected KEY=VALUE, got %q", where, item)
+		}
+	}
+	return nil
+}
+
+// ProviderOptionKeys 返回 providers（为空时为 DefaultProviders）声明的全部选项名：开关与主机端口，含 mock 的。
+func ProviderOptionKeys(providers []Provider) []string {
+	var keys []string
+	for _, p := range providersOrDefault(providers) {
+		keys = appendNonEmpty(keys, p.Option, p.PortOption)
+		if p.Mock != nil {
+			keys = appendNonEmpty(keys, p.Mock.Option, p.Mock.PortOption)
+		}
+	}
+	return keys
+}
+
+func appendNonEmpty(dst []string, items ...string) []string {
+	for _, s := range items {
+		if s != "" {
+			dst = append(dst, s)
+		}
+	}
+	return dst
+}
+
+// providersOrDefault 返回 providers；为空时为 DefaultProviders。
+func providersOrDefault(providers []Provider) []Provider {
+	if len(providers) == 0 {
+		return DefaultProviders
+	}
+	return providers
+}
+
+// enabled 判断通道是否启用：Option 为空的内置通道始终启用，其余看 Options.Providers[Option]。
+func (pv *Provider) enabled(opts *Options) bool {
+	if pv.Option == "" {
+		return pv.Builtin
+	}
+	return opts.providerEnabled(pv.Option)
+}
+
+// providerOption 返回 Options.Providers 中 key 的值（去除首尾空白）；opts 为 nil 或 key 为空时为空串。
+func (o *Options) providerOption(key string) string {
+	if o == nil || key == "" {
+		return ""
+	}
+	return strings.TrimSpace(o.Providers[key])
+}
+
+// providerEnabled 判断 Options.Providers 中的开关 key 是否为 "true"。
+func (o *Options) providerEnabled(key string) bool {
+	return o.providerOption(key) == "true"
+}
+
+// validateProviderPorts 校验 Options.Providers 中各通道（及 mock）的主机端口。
+func validateProviderPorts(providers []Provider, opts *Options) error {
+	for _, p := range providersOrDefault(providers) {
+		if err := validatePort(p.PortOption, opts.providerOption(p.PortOption)); err != nil {
+			return err
+		}
+		if p.Mock != nil {
+			if err := validatePort(p.Mock.PortOption, opts.providerOption(p.Mock.PortOption)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// composeWithProviders 返回合并了通道服务定义的 compose：canonical 中没有的通道服务按 Provider.Service 补入 services（浅拷贝，不修改 s.Compose）。
+func (s *Source) composeWithProviders() map[string]interface{} {
+	services, _ := s.Compose["services"].(map[string]interface{})
+	var extra map[string]interface{}
+	for _, p := range providersOrDefault(s.Providers) {
+		if len(p.Service) == 0 {
+			continue
+		}
+		if _, ok := services[p.ID]; ok {
+			continue
+		}
+		if extra == nil {
+			extra = make(map[string]interface{})
+		}
+		extra[p.ID] = p.Service
+	}
+	if extra == nil {
+		return s.Compose
+	}
+	out := copyMap(s.Compose)
+	merged := copyMap(services)
+	for k, v := range extra {
+		merged[k] = v
+	}
+	out["services"] = merged
+	return out
+}
+
+// applyProviders 按 Options 处理 compose 中的通道服务：未启用的移除（herald 中 canonical 自带的接线保留，用户可指向外部通道服务），
+// 启用的随 herald 进入 mode（从 all 中取服务定义），设置容器名与主机端口、写入 herald 接线，并按需注入 mock 服务、
+// 让通道服务（内置通道为 herald）指向 mock。opts 为 nil 时除内置通道外全部视为未启用。
+func applyProviders(p *Project, all map[string]*Service, providers []Provider, opts *Options, prefix string) error {
+	svcs := p.Services
+	herald := svcs["herald"]
+	for _, pv := range providersOrDefault(providers) {
+		if !pv.enabled(opts) {
+			delete(svcs, pv.ID)
+			continue
+		}
+		// 本 mode 不含 herald（如 traefik-warden）时不注入通道服务；含 herald 但未列出通道服务（如 image、traefik-herald）时补上，
+		// 使 herald 接线的默认地址可达
+		svc, ok := svcs[pv.ID]
+		switch {
+		case pv.Builtin:
+			svc, ok = herald, herald != nil
+		case !ok && herald != nil:
+			if svc, ok = all[pv.ID]; ok {
+				svcs[pv.ID] = svc
+			}
+		}
+		if !ok {
+			continue
+		}
+		if !pv.Builtin {
+			svc.Extra["container_name"] = prefix + pv.ID
+			setHostPort(svc, pv.Port, opts.providerOption(pv.PortOption))
+		}
+		if herald != nil {
+			for _, e := range keyValues(pv.Herald...) {
+				herald.Environment.Set(e.Key, *e.Value)
+			}
+		}
+		m := pv.Mock
+		if m == nil || !opts.providerEnabled(m.Option) {
+			continue
+		}
+		mock, err := ServiceFromMap(m.ID, m.Service)
+		if err != nil {
+			return fmt.Errorf("provider %s: mock: %w", pv.ID, err)
+		}
+		mock.Extra["container_name"] = prefix + m.ID
+		setHostPort(mock, m.Port, opts.providerOption(m.PortOption))
+		svcs[m.ID] = mock
+		if svc.Environment != nil {
+			for _, e := range keyValues(m.Env...) {
+				svc.Environment.Set(e.Key, *e.Value)
+			}
+		}
+		if !svc.HasDependency(m.ID) {
+			svc.DependsOn = append(svc.DependsOn, Dependency{Service: m.ID})
+		}
+	}
+	return nil
+}
+
+// setHostPort 将容器端口为 target 的映射的主机端口改为 hostPort；任一为空时不修改。
+func setHostPort(svc *Service, target, hostPort string) {
+	if target == "" || hostPort == "" {
+		return
+	}
+	for i := range svc.Ports {
+		if svc.Ports[i].Target == target {
+			svc.Ports[i].Published = hostPort
+			return
+		}
+	}
+}
+
+// applyProviderEnvVars 按 Options 调整 .env 变量：移除未启用通道的 EnvKeys（用户为 herald 接线设置的非空值保留，如外部通道服务地址）；
+// 启用的通道补上 herald 接线的默认值，启用 mock 时写入其 Env。
+func applyProviderEnvVars(vars map[string]string, providers []Provider, opts *Options) {
+	for _, pv := range providersOrDefault(providers) {
+		if !pv.enabled(opts) {
+			wired := make(map[string]bool)
+			for _, e := range keyValues(pv.Herald...) {
+				if m := singleEnvRefRegex.FindStringSubmatch(*e.Value); m != nil {
+					wired[m[1]] = true
+				}
+			}
+			for _, k := range pv.EnvKeys {
+				if !wired[k] || vars[k] == "" {
+					delete(vars, k)
+				}
+			}
+			continue
+		}
+		// herald 接线的默认值（如通道服务地址）在变量未设置或为空时写入，使启用通道后无需再手动指定
+		for _, e := range keyValues(pv.Herald...) {
+			if m := singleEnvRefRegex.FindStringSubmatch(*e.Value); m != nil && m[2] != "" && vars[m[1]] == "" {
+				vars[m[1]] = m[2]
+			}
+		}
+		if pv.Mock != nil && opts.providerEnabled(pv.Mock.Option) {
+			for _, e := range keyValues(pv.Mock.Env...) {
+				vars[e.Key] = *e.Value
+			}
+		}
+	}
+}
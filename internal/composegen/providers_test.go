@@ -0,0 +1,202 @@
+package composegen
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestProvidersConfig 确保内置 DefaultProviders 即嵌入的 config/providers.yaml，且新增的通道无需改代码即可生成。
+func TestProvidersConfig(t *testing.T) {
+	providers, err := LoadProviders("../../config/providers.yaml")
+	if err != nil {
+		t.Fatalf("LoadProviders: %v", err)
+	}
+	if !reflect.DeepEqual(providers, DefaultProviders) {
+		t.Errorf("config/providers.yaml differs from DefaultProviders:\n%#v", providers)
+	}
+	if keys := ProviderOptionKeys(nil); !slices.Contains(keys, "dingtalkEnabled") || !slices.Contains(keys, "smtpUseOwlmail") {
+		t.Errorf("default provider options = %v", keys)
+	}
+	if _, err := ParseProviders([]byte("providers:\n  - id: herald-wecom\n")); err == nil {
+		t.Error("provider without option should be rejected")
+	}
+
+	// 仅在 providers.yaml 中定义的通道：启用时注入服务与 herald 接线，mock 替换通道 environment
+	providers, err = ParseProviders([]byte(`providers:
+  - id: herald-wecom
+    option: wecomEnabled
+    port: 8086
+    portOption: portHeraldWecom
+    envKeys: [WECOM_CORP_ID]
+    herald: [HERALD_WECOM_API_URL=http://herald-wecom:8086]
+    service:
+      image: herald-wecom:test
+      ports: ["8086:8086"]
+      environment:
+        - WECOM_CORP_ID=${WECOM_CORP_ID:-corp}
+        - WECOM_API_BASE=https://qyapi.weixin.qq.com
+      networks: [the-gate-network]
+    mock:
+      id: wecom-mock
+      option: wecomUseMock
+      env: [WECOM_API_BASE=http://wecom-mock:8080]
+      service:
+        image: wecom-mock:test
+`))
+	if err != nil {
+		t.Fatalf("ParseProviders: %v", err)
+	}
+	src, err := ParseSource([]byte(`
+services:
+  herald:
+    image: herald:test
+    environment:
+      - PORT=:8082
+networks:
+  the-gate-network:
+`))
+	if err != nil {
+		t.Fatalf("ParseSource: %v", err)
+	}
+	src.Providers = providers
+	opts := &Options{Providers: map[string]string{"wecomEnabled": "true", "wecomUseMock": "true", "portHeraldWecom": "9086"}, ExposePorts: true}
+	gen, err := src.Generate([]string{"traefik"}, "", opts, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	p := generatedProject(t, gen, "traefik")
+	wecom := p.Services["herald-wecom"]
+	if wecom == nil || p.Services["wecom-mock"] == nil {
+		t.Fatalf("services = %v, want herald-wecom and wecom-mock", p.Services)
+	}
+	if v, _ := wecom.Environment.Get("WECOM_API_BASE"); v != "http://wecom-mock:8080" || !wecom.HasDependency("wecom-mock") {
+		t.Errorf("herald-wecom should point at wecom-mock: %v", wecom.Map())
+	}
+	if wecom.Extra["container_name"] != "the-gate-herald-wecom" || wecom.Ports[0].Published != "9086" {
+		t.Errorf("herald-wecom container_name / port = %v / %v", wecom.Extra["container_name"], wecom.Ports)
+	}
+	if v, _ := p.Services["herald"].Environment.Get("HERALD_WECOM_API_URL"); v != "http://herald-wecom:8086" {
+		t.Errorf("herald should be wired to herald-wecom: %v", p.Services["herald"].Environment)
+	}
+	if !bytes.Contains(gen.Env, []byte("WECOM_CORP_ID=corp")) || !bytes.Contains(gen.Env, []byte("WECOM_API_BASE=http://wecom-mock:8080")) {
+		t.Errorf(".env should include channel and mock vars:\n%s", gen.Env)
+	}
+
+	if err := ValidateOptions(opts); err != nil {
+		t.Fatalf("ValidateOptions: %v", err)
+	}
+	opts.Providers["portHeraldWecom"] = "70000"
+	if _, err := src.Generate([]string{"traefik"}, "", opts, nil); err == nil {
+		t.Error("invalid provider port should be rejected")
+	}
+	gen, err = src.Generate([]string{"traefik"}, "", &Options{}, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if bytes.Contains(gen.Composes["traefik"], []byte("wecom")) || bytes.Contains(gen.Env, []byte("WECOM_")) {
+		t.Errorf("disabled channel should leave no trace:\n%s\n%s", gen.Composes["traefik"], gen.Env)
+	}
+}
+
+// 内置通道（herald 内置短信）无独立服务：启用 sms-sink 时注入替身并让 herald 指向它，未启用时 compose 不变。
+func TestBuiltinProviderSMSSink(t *testing.T) {
+	if _, err := ParseProviders([]byte("providers:\n  - id: herald-sms\n    builtin: true\n    service: {image: x}\n")); err == nil {
+		t.Error("builtin provider with service should be rejected")
+	}
+	src := loadCanonical(t)
+	opts := &Options{Providers: map[string]string{"smsUseSink": "true", "portSmsSink": "9086"}, ExposePorts: true}
+	gen, err := src.Generate([]string{"image", "traefik-stargate"}, "", opts, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	p := generatedProject(t, gen, "image")
+	sink, herald := p.Services["sms-sink"], p.Services["herald"]
+	if sink == nil || sink.Extra["container_name"] != "the-gate-sms-sink" || sink.Ports[0].Published != "9086" {
+		t.Fatalf("sms-sink = %v", sink)
+	}
+	if v, _ := herald.Environment.Get("SMS_API_BASE_URL"); v != "http://sms-sink:8086" || !herald.HasDependency("sms-sink") {
+		t.Errorf("herald should point at sms-sink: %v", herald.Map())
+	}
+	if bytes.Contains(gen.Composes["traefik-stargate"], []byte("sms-sink")) {
+		t.Error("mode without herald should not get sms-sink")
+	}
+	gen, err = src.Generate([]string{"image"}, "", &Options{ExposePorts: true}, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if bytes.Contains(gen.Composes["image"], []byte("sms-sink")) || !bytes.Contains(gen.Composes["image"], []byte("SMS_API_BASE_URL=${SMS_API_BASE_URL:-}")) {
+		t.Errorf("sms-sink disabled should keep herald SMS env unchanged:\n%s", gen.Composes["image"])
+	}
+}
+
+// 启用钉钉通道（及 mock）时 herald 的 HERALD_DINGTALK_API_URL 自动指向 herald-dingtalk，API 密钥与通道服务共用同一变量，
+// herald-dingtalk 的 DINGTALK_API_BASE_URL 指向从本仓库构建的 dingtalk-mock；
+// 通道服务随 herald 进入各 mode，未启用时保留用户指定的外部通道地址。
+func TestProviderHeraldWiring(t *testing.T) {
+	src := loadCanonical(t)
+	opts := &Options{Providers: map[string]string{"dingtalkEnabled": "true", "dingtalkUseMock": "true"}, ExposePorts: true}
+	gen, err := src.Generate([]string{"traefik"}, "", opts, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	p := generatedProject(t, gen, "traefik")
+	herald, channel := p.Services["herald"], p.Services["herald-dingtalk"]
+	if v, _ := herald.Environment.Get("HERALD_DINGTALK_API_URL"); v != "${HERALD_DINGTALK_API_URL:-http://herald-dingtalk:8083}" {
+		t.Errorf("herald HERALD_DINGTALK_API_URL = %q", v)
+	}
+	if v, _ := channel.Environment.Get("DINGTALK_API_BASE_URL"); v != "http://dingtalk-mock:8087" || !channel.HasDependency("dingtalk-mock") {
+		t.Errorf("herald-dingtalk DINGTALK_API_BASE_URL = %q, want it pointed at dingtalk-mock", v)
+	}
+	if build, _ := p.Services["dingtalk-mock"].Extra["build"].(map[string]interface{}); build["context"] != "../.." || p.Services["dingtalk-mock"].Extra["image"] != "stargate-suite:local" {
+		t.Errorf("dingtalk-mock should build stargate-suite:local from this repository: %v", p.Services["dingtalk-mock"].Map())
+	}
+	heraldKey, _ := herald.Environment.Get("HERALD_DINGTALK_API_KEY")
+	if channelKey, _ := channel.Environment.Get("API_KEY"); heraldKey != channelKey {
+		t.Errorf("API key wiring differs: herald %q, herald-dingtalk %q", heraldKey, channelKey)
+	}
+	env := string(gen.EnvFor("traefik"))
+	if !strings.Contains(env, "HERALD_DINGTALK_API_URL=http://herald-dingtalk:8083\n") {
+		t.Errorf(".env should set HERALD_DINGTALK_API_URL:\n%s", env)
+	}
+	opts.EnvOverrides = map[string]string{"HERALD_DINGTALK_API_URL": "http://dingtalk.internal:9000"}
+	if gen, err = src.Generate([]string{"traefik"}, "", opts, nil); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if !strings.Contains(string(gen.EnvFor("traefik")), "HERALD_DINGTALK_API_URL=http://dingtalk.internal:9000\n") {
+		t.Error("an explicit HERALD_DINGTALK_API_URL should be kept")
+	}
+
+	// 通道服务随 herald 进入未列出它的 mode；不含 herald 的 mode 不注入
+	opts.EnvOverrides = nil
+	if gen, err = src.Generate([]string{"image", "traefik-herald", "traefik-warden"}, "", opts, nil); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	for _, mode := range []string{"image", "traefik-herald"} {
+		y := string(gen.Composes[mode])
+		if !strings.Contains(y, "  herald-dingtalk:\n") || !strings.Contains(y, "  dingtalk-mock:\n") {
+			t.Errorf("%s should include herald-dingtalk and dingtalk-mock:\n%s", mode, y)
+		}
+		if !strings.Contains(string(gen.EnvFor(mode)), "HERALD_DINGTALK_API_URL=http://herald-dingtalk:8083\n") {
+			t.Errorf("%s .env should point Herald at herald-dingtalk", mode)
+		}
+	}
+	if bytes.Contains(gen.Composes["traefik-warden"], []byte("dingtalk")) {
+		t.Error("mode without herald should not get herald-dingtalk")
+	}
+
+	// 未启用通道时保留 canonical 中的接线与用户指定的外部通道地址
+	opts = &Options{EnvOverrides: map[string]string{"HERALD_DINGTALK_API_URL": "http://dingtalk.internal:9000"}}
+	if gen, err = src.Generate([]string{"traefik"}, "", opts, nil); err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	y := string(gen.Composes["traefik"])
+	if strings.Contains(y, "  herald-dingtalk:\n") || !strings.Contains(y, "HERALD_DINGTALK_API_URL=${HERALD_DINGTALK_API_URL:-}") {
+		t.Errorf("disabled channel should drop herald-dingtalk but keep Herald's wiring:\n%s", y)
+	}
+	if env := string(gen.EnvFor("traefik")); !strings.Contains(env, "HERALD_DINGTALK_API_URL=http://dingtalk.internal:9000\n") || strings.Contains(env, "DINGTALK_APP_KEY") {
+		t.Errorf("disabled channel should keep only the user-supplied URL:\n%s", env)
+	}
+}
@@ -0,0 +1,174 @@
+package composegen
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// secretsDir 为 secrets 文件相对 build/<mode>/ 的目录，文件名为小写的变量名（如 secrets/herald_api_key）。
+const secretsDir = "secrets"
+
+// compose 以绑定挂载传入 file: secret，容器内保留宿主机上的属主与权限：以非 root 用户运行的镜像（如 redis、warden）读不到
+// 属主为宿主机用户的 0600 文件。因此 secrets 文件对所有用户可读，由仅属主可进入的 secrets/ 目录挡住宿主机上的其他用户；
+// swarm 由 docker stack deploy 读取文件内容，容器内的 secret 为 root 属主 0444，不受影响。
+const (
+	SecretsDirPerm os.FileMode = 0o700
+	SecretFilePerm os.FileMode = 0o644
+)
+
+// GeneratedFilePerm 返回 Generated.Files 中相对路径 rel 写出时的权限：secrets/ 下为 SecretFilePerm，
+// 其余附加文件（Traefik 配置与证书私钥，由以 root 运行的 Traefik 读取）仅属主可读。
+func GeneratedFilePerm(rel string) os.FileMode {
+	if path.Dir(rel) == secretsDir {
+		return SecretFilePerm
+	}
+	return 0o600
+}
+
+// envSecrets 收集一次生成中的顶层 secrets: 定义与对应文件内容。
+type envSecrets struct {
+	defs  map[string]interface{} // secret 名 -> 顶层定义（file: ./secrets/<name>）
+	files map[string][]byte      // 相对 build/<mode>/ 的路径 -> 内容
+}
+
+func newEnvSecrets() *envSecrets {
+	return &envSecrets{defs: make(map[string]interface{}), files: make(map[string][]byte)}
+}
+
+// mountEnvSecrets 处理服务中以 ${VAR} 整值引用敏感变量（IsSecretEnvKey）且值非空、并声明了 NAME_FILE 变体的环境变量 NAME：
+// 值写入 secrets/<secret> 并挂载到服务，删除 NAME 并令 NAME_FILE=/run/secrets/<secret>。无变体时服务只能读环境变量，NAME 保持原样且
+// 不为其挂载 secret（否则同一密钥会在 .env 与 secrets/ 各存一份明文），生成结果中以提示列出（见 plaintextSecretWarnings）。
+// 返回服务需挂载的 secret 名；空值不生成 secret（swarm 不接受空 secret，空密码也无需保护）。
+func mountEnvSecrets(svc *Service, opts *Options, vars map[string]string, sec *envSecrets) []interface{} {
+	fileTargets := make(map[string]string) // NAME_FILE -> secret 名
+	drop := make(map[string]bool)
+	var svcSecrets []interface{}
+	mounted := make(map[string]bool)
+	for _, item := range svc.Environment {
+		if item.Value == nil {
+			continue
+		}
+		m := singleEnvRefRegex.FindStringSubmatch(*item.Value)
+		if m == nil || !IsSecretEnvKey(opts, m[1]) || vars[m[1]] == "" {
+			continue
+		}
+		if _, ok := svc.Environment.Get(item.Key + "_FILE"); !ok {
+			continue
+		}
+		secret := strings.ToLower(m[1])
+		fileTargets[item.Key+"_FILE"] = secret
+		drop[item.Key] = true
+		sec.defs[secret] = map[string]interface{}{"file": "./" + secretsDir + "/" + secret}
+		sec.files[secretsDir+"/"+secret] = []byte(vars[m[1]])
+		if !mounted[secret] {
+			mounted[secret] = true
+			svcSecrets = append(svcSecrets, secret)
+		}
+	}
+	for name, secret := range fileTargets {
+		svc.Environment.Replace(name, "/run/secrets/"+secret)
+	}
+	svc.Environment.Filter(func(item KeyValue) bool { return !drop[item.Key] })
+	return svcSecrets
+}
+
+// isKeysStepSecret 判断变量是否为 keys-step 密钥：opts.SecretKeys（config/keys-step.yaml）非空时仅限其中的键，
+// 否则按 IsSecretEnvKey（名称规则也会命中 HERALD_TOTP_EXPOSE_SECRET_IN_ENROLL 这类开关）。
+func isKeysStepSecret(opts *Options, key string) bool {
+	if opts == nil || len(opts.SecretKeys) == 0 {
+		return IsSecretEnvKey(opts, key)
+	}
+	for _, k := range opts.SecretKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// plaintextSecretWarnings 在 Options.SecretsFiles 为 true 时列出生成结果中仍以环境变量传入的非空 keys-step 密钥：服务没有 NAME_FILE 变体
+// （见 mountEnvSecrets），密钥因此仍明文保存在该 mode 的 .env 中；非 compose 输出（k8s）跳过。
+func plaintextSecretWarnings(g *Generated, opts *Options) ([]string, error) {
+	if opts == nil || !opts.SecretsFiles {
+		return nil, nil
+	}
+	modes := make([]string, 0, len(g.Composes))
+	for m := range g.Composes {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+	var warnings []string
+	for _, mode := range modes {
+		if OutputFileName(mode) != "docker-compose.yml" {
+			continue
+		}
+		compose, err := ParseCompose(g.Composes[mode])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mode, err)
+		}
+		vars, err := ParseDotEnv(string(g.EnvFor(mode)))
+		if err != nil {
+			return nil, fmt.Errorf("%s .env: %w", mode, err)
+		}
+		p, err := ProjectFromMap(compose)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", mode, err)
+		}
+		names := make([]string, 0, len(p.Services))
+		for n := range p.Services {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, item := range p.Services[name].Environment {
+				if item.Value == nil {
+					continue
+				}
+				m := singleEnvRefRegex.FindStringSubmatch(*item.Value)
+				if m == nil || !isKeysStepSecret(opts, m[1]) || vars[m[1]] == "" {
+					continue
+				}
+				warnings = append(warnings, fmt.Sprintf("%s: %s %s still reads %s from the environment (no %s_FILE variant), so the value stays in .env",
+					mode, name, item.Key, m[1], item.Key))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// mountSecrets 为 p 中各服务挂载其引用的密钥（见 mountEnvSecrets），有 secret 时写入顶层 secrets:，返回收集到的定义与文件。
+func mountSecrets(p *Project, opts *Options, vars map[string]string) *envSecrets {
+	names := make([]string, 0, len(p.Services))
+	for n := range p.Services {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	sec := newEnvSecrets()
+	for _, name := range names {
+		if svcSecrets := mountEnvSecrets(p.Services[name], opts, vars, sec); len(svcSecrets) > 0 {
+			p.Services[name].Extra["secrets"] = svcSecrets
+		}
+	}
+	if len(sec.defs) > 0 {
+		if p.Extra == nil {
+			p.Extra = make(map[string]interface{})
+		}
+		p.Extra["secrets"] = sec.defs
+	}
+	return sec
+}
+
+// applySecretsFiles 在 Options.SecretsFiles 为 true 时为 compose 中各服务挂载其引用的密钥（见 mountSecrets），
+// 并返回需随 compose 一同输出的 secrets 文件；未开启或没有可挂载的密钥时返回 nil。
+func applySecretsFiles(p *Project, opts *Options, vars map[string]string) map[string][]byte {
+	if opts == nil || !opts.SecretsFiles {
+		return nil
+	}
+	if sec := mountSecrets(p, opts, vars); len(sec.files) > 0 {
+		return sec.files
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package composegen
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestGenerateSecretsFiles 确保开启 SecretsFiles 时 Generate 为声明了 *_FILE 变体的非空密钥返回 secrets 文件，compose 声明顶层 secrets 并由
+// 读取它的服务挂载，*_FILE 变体替代明文变量（environment 为列表或映射写法均可），明文变量不再出现在 environment 与 .env 中；
+// 没有变体的密钥只保留在环境变量中（不另写 secrets 文件）并给出提示。
+func TestGenerateSecretsFiles(t *testing.T) {
+	full := map[string]interface{}{
+		"services": map[string]interface{}{
+			"warden": map[string]interface{}{
+				"image": "warden:test",
+				"environment": []interface{}{
+					"REDIS_PASSWORD=${WARDEN_REDIS_PASSWORD:-}",
+					"REDIS_PASSWORD_FILE=${WARDEN_REDIS_PASSWORD_FILE:-}",
+					"API_KEY=${WARDEN_API_KEY:-test-warden-api-key}",
+				},
+			},
+			"herald": map[string]interface{}{
+				"image": "herald:test",
+				"environment": map[string]interface{}{
+					"API_KEY":                    "${HERALD_API_KEY:-test-herald-api-key}",
+					"API_KEY_FILE":               "",
+					"HMAC_SECRET":                "${HERALD_HMAC_SECRET:-test-hmac-secret}",
+					"HERALD_TOTP_ENCRYPTION_KEY": "${HERALD_TOTP_ENCRYPTION_KEY:-}",
+				},
+			},
+			"stargate": map[string]interface{}{
+				"image": "stargate:test",
+				"environment": []interface{}{
+					"HERALD_API_KEY=${HERALD_API_KEY:-test-herald-api-key}",
+					"WARDEN_API_KEY=${WARDEN_API_KEY:-test-warden-api-key}",
+				},
+			},
+		},
+	}
+	keys := []string{"WARDEN_REDIS_PASSWORD", "WARDEN_API_KEY", "HERALD_API_KEY", "HERALD_HMAC_SECRET", "HERALD_TOTP_ENCRYPTION_KEY"}
+	opts := &Options{UseNamedVolume: true, SecretsFiles: true, SecretKeys: keys}
+	envBody := "WARDEN_REDIS_PASSWORD=s3cret\nWARDEN_API_KEY=wk\nHERALD_API_KEY=hk\nHERALD_HMAC_SECRET=hs\nHERALD_TOTP_ENCRYPTION_KEY=ek\n"
+	gen, err := Generate(full, []string{"image"}, envBody, opts, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	files := gen.Files["image"]
+	want := map[string]string{"secrets/warden_redis_password": "s3cret", "secrets/herald_api_key": "hk"}
+	if len(files) != len(want) {
+		t.Errorf("unexpected secrets files: %v", files)
+	}
+	for path, v := range want {
+		if string(files[path]) != v {
+			t.Errorf("%s = %q, want %q", path, files[path], v)
+		}
+	}
+	p := generatedProject(t, gen, "image")
+	for svc, kv := range map[string][2]string{
+		"warden": {"REDIS_PASSWORD", "/run/secrets/warden_redis_password"},
+		"herald": {"API_KEY", "/run/secrets/herald_api_key"},
+	} {
+		env := p.Services[svc].Environment
+		if _, ok := env.Get(kv[0]); ok {
+			t.Errorf("%s environment still has %s", svc, kv[0])
+		}
+		if v, _ := env.Get(kv[0] + "_FILE"); v != kv[1] {
+			t.Errorf("%s %s_FILE = %q, want %q", svc, kv[0], v, kv[1])
+		}
+		if secrets, _ := p.Services[svc].Extra["secrets"].([]interface{}); len(secrets) != 1 {
+			t.Errorf("%s secrets = %v", svc, secrets)
+		}
+	}
+	if v, _ := p.Services["herald"].Environment.Get("HMAC_SECRET"); v != "${HERALD_HMAC_SECRET:-test-hmac-secret}" {
+		t.Errorf("herald HMAC_SECRET = %q, want it left in the environment", v)
+	}
+	if secrets := p.Services["stargate"].Extra["secrets"]; secrets != nil {
+		t.Errorf("stargate should mount no secrets, got %v", secrets)
+	}
+	env := string(gen.EnvFor("image"))
+	if strings.Contains(env, "WARDEN_REDIS_PASSWORD=") || !strings.Contains(env, "HERALD_API_KEY=hk") {
+		t.Errorf(".env should drop WARDEN_REDIS_PASSWORD and keep HERALD_API_KEY for stargate:\n%s", env)
+	}
+	wantWarnings := []string{
+		"image: herald HERALD_TOTP_ENCRYPTION_KEY still reads HERALD_TOTP_ENCRYPTION_KEY",
+		"image: herald HMAC_SECRET still reads HERALD_HMAC_SECRET",
+		"image: stargate HERALD_API_KEY still reads HERALD_API_KEY",
+		"image: stargate WARDEN_API_KEY still reads WARDEN_API_KEY",
+		"image: warden API_KEY still reads WARDEN_API_KEY",
+	}
+	if len(gen.Warnings) != len(wantWarnings) {
+		t.Fatalf("warnings = %v, want %d", gen.Warnings, len(wantWarnings))
+	}
+	for i, w := range wantWarnings {
+		if !strings.HasPrefix(gen.Warnings[i], w) {
+			t.Errorf("warning %d = %q, want prefix %q", i, gen.Warnings[i], w)
+		}
+	}
+}
+
+// TestGenerateSecretsFilesCanonical 确保 canonical 中带 *_FILE 变体的 warden Redis 密码移出 environment 与 .env，
+// 仍读环境变量的密钥只留在 .env 中，不写入 secrets/。
+func TestGenerateSecretsFilesCanonical(t *testing.T) {
+	src := loadCanonical(t)
+	opts := &Options{UseNamedVolume: true, SecretsFiles: true, SecretKeys: []string{"WARDEN_REDIS_PASSWORD", "HERALD_API_KEY"}}
+	gen, err := src.Generate([]string{"traefik"}, "WARDEN_REDIS_PASSWORD=pw\nHERALD_API_KEY=hk\n", opts, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	warden := generatedProject(t, gen, "traefik").Services["warden"]
+	if _, ok := warden.Environment.Get("REDIS_PASSWORD"); ok {
+		t.Errorf("warden environment still has REDIS_PASSWORD: %v", warden.Environment.list())
+	}
+	if v, _ := warden.Environment.Get("REDIS_PASSWORD_FILE"); v != "/run/secrets/warden_redis_password" {
+		t.Errorf("REDIS_PASSWORD_FILE = %q", v)
+	}
+	if env := string(gen.EnvFor("traefik")); strings.Contains(env, "WARDEN_REDIS_PASSWORD=") || !strings.Contains(env, "HERALD_API_KEY=hk") {
+		t.Errorf(".env should drop WARDEN_REDIS_PASSWORD and keep HERALD_API_KEY:\n%s", env)
+	}
+	if files := gen.Files["traefik"]; len(files) != 1 || string(files["secrets/warden_redis_password"]) != "pw" {
+		t.Errorf("want only secrets/warden_redis_password, got %v", files)
+	}
+}
@@ -0,0 +1,122 @@
+package composegen
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// swarmStatefulConstraint 有状态服务（挂载命名卷，如 Redis）的放置约束：固定到 manager 节点，避免数据卷随调度漂移。
+const swarmStatefulConstraint = "node.role == manager"
+
+// swarmUnsupportedKeys 为 docker stack deploy 忽略或拒绝的服务键。
+var swarmUnsupportedKeys = []string{"container_name", "depends_on", "restart", "build"}
+
+// generateSwarm 生成 swarm 模式 stack 文件：服务集合与全量 traefik 模式一致，移除 stack 不支持的键，
+// 为各服务补充 deploy（副本数、重启策略、有状态服务放置约束），Traefik labels 移入 deploy.labels，
+// 只读挂载的相对路径文件（如 ./data.json:/app/data.json:ro，短语法或长语法）改为 configs:（config 在容器内只读，可写的绑定挂载保持原样），敏感变量在服务支持 *_FILE 变体时改为 secrets: 挂载（见 mountSecrets）。
+// stack 文件的顶层 secrets: 引用 ./secrets/<name>，缺少文件时 docker stack deploy 失败，因此无论 Options.SecretsFiles 是否开启都返回这些文件。
+func generateSwarm(src *Source, opts *Options, meta *EnvMeta, envOverride string) ([]byte, map[string][]byte, error) {
+	def, err := src.modeDef("traefik")
+	if err != nil {
+		return nil, nil, err
+	}
+	// 服务以 service 名互访；Redis 数据统一使用命名卷（绑定路径依赖具体节点）；Traefik 由集群提供，不注入内置 Traefik
+	var swarmOpts *Options
+	if opts != nil {
+		o := *opts
+		o.ContainerNamePrefix = ""
+		o.UseNamedVolume = true
+		o.BundledTraefik = false
+		swarmOpts = &o
+	}
+	p, err := buildSplitCompose(src, def, swarmOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars := resolvedEnvVars(src, swarmOpts, envOverride)
+	sec := mountSecrets(p, opts, vars)
+	replicas := 1
+	if opts != nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(opts.SwarmReplicas)); err == nil && n > 0 {
+			replicas = n
+		}
+	}
+
+	configs := make(map[string]interface{})
+	names := make([]string, 0, len(p.Services))
+	for n := range p.Services {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		svc := p.Services[name]
+		for _, k := range swarmUnsupportedKeys {
+			delete(svc.Extra, k)
+		}
+		svc.DependsOn = nil
+
+		stateful := false
+		if svc.Volumes != nil {
+			var kept []Volume
+			var svcConfigs []interface{}
+			for _, v := range svc.Volumes {
+				switch {
+				case v.Type == "volume" && hasKey(p.Volumes, v.Source):
+					stateful = true
+					kept = append(kept, v)
+				case v.Type == "bind" && v.ReadOnly && strings.HasPrefix(v.Source, "./"):
+					cfgName := fileResourceName(name, v.Source)
+					configs[cfgName] = map[string]interface{}{"file": v.Source}
+					svcConfigs = append(svcConfigs, map[string]interface{}{"source": cfgName, "target": v.Target})
+				default:
+					kept = append(kept, v)
+				}
+			}
+			svc.Volumes = kept
+			if len(svcConfigs) > 0 {
+				svc.Extra["configs"] = svcConfigs
+			}
+		}
+
+		deploy := map[string]interface{}{
+			"replicas":       replicas,
+			"restart_policy": map[string]interface{}{"condition": "on-failure"},
+		}
+		if stateful {
+			deploy["replicas"] = 1
+			deploy["placement"] = map[string]interface{}{"constraints": []interface{}{swarmStatefulConstraint}}
+		}
+		if svc.Labels != nil {
+			deploy["labels"] = svc.Labels.list()
+			svc.Labels = nil
+		}
+		svc.Extra["deploy"] = deploy
+	}
+
+	// stack 中服务跨节点通信需 overlay 网络；外部 Traefik 网络保持 external
+	for k, v := range p.Networks {
+		n, ok := v.(map[string]interface{})
+		if !ok || n["external"] == true {
+			continue
+		}
+		n = copyMap(n)
+		n["driver"] = "overlay"
+		n["attachable"] = true
+		p.Networks[k] = n
+	}
+	out := p.Map()
+	if len(configs) > 0 {
+		out["configs"] = configs
+	}
+
+	outData, err := encodeLayout(out, src.Layout, getComments(meta))
+	if err != nil {
+		return nil, nil, err
+	}
+	var files map[string][]byte
+	if len(sec.files) > 0 {
+		files = sec.files
+	}
+	return append([]byte(splitComposeComment("swarm")), outData...), files, nil
+}
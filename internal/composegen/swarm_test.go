@@ -0,0 +1,174 @@
+package composegen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestGenerateSwarmSecretsAndDeploy 确保 swarm 模式移除 container_name/depends_on、补充 deploy，并将有 *_FILE 变体的敏感变量改为 secrets 挂载。
+func TestGenerateSwarmSecretsAndDeploy(t *testing.T) {
+	full := map[string]interface{}{
+		"services": map[string]interface{}{
+			"warden": map[string]interface{}{
+				"image":          "warden:test",
+				"container_name": "the-gate-warden",
+				"environment": []interface{}{
+					"REDIS_PASSWORD=${WARDEN_REDIS_PASSWORD:-}",
+					"REDIS_PASSWORD_FILE=${WARDEN_REDIS_PASSWORD_FILE:-}",
+					"API_KEY=${WARDEN_API_KEY:-test-warden-api-key}",
+				},
+				"depends_on": map[string]interface{}{
+					"warden-redis": map[string]interface{}{"condition": "service_healthy"},
+				},
+			},
+			"warden-redis": map[string]interface{}{
+				"image":   "redis:test",
+				"volumes": []interface{}{"warden-redis-data:/data"},
+			},
+		},
+		"volumes": map[string]interface{}{"warden-redis-data": nil},
+	}
+	opts := &Options{UseNamedVolume: true, SwarmReplicas: "2", SecretKeys: []string{"WARDEN_REDIS_PASSWORD"}}
+	yml, files, err := generateSwarm(&Source{Compose: full}, opts, nil, "WARDEN_REDIS_PASSWORD=s3cret\n")
+	if err != nil {
+		t.Fatalf("generateSwarm: %v", err)
+	}
+	var out struct {
+		Secrets  map[string]map[string]string `yaml:"secrets"`
+		Services map[string]struct {
+			ContainerName string      `yaml:"container_name"`
+			DependsOn     interface{} `yaml:"depends_on"`
+			Environment   []string    `yaml:"environment"`
+			Secrets       []string    `yaml:"secrets"`
+			Deploy        struct {
+				Replicas  int `yaml:"replicas"`
+				Placement struct {
+					Constraints []string `yaml:"constraints"`
+				} `yaml:"placement"`
+			} `yaml:"deploy"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(yml, &out); err != nil {
+		t.Fatalf("yaml unmarshal: %v", err)
+	}
+	warden := out.Services["warden"]
+	if warden.ContainerName != "" || warden.DependsOn != nil {
+		t.Errorf("warden: container_name/depends_on must be removed, got %q / %v", warden.ContainerName, warden.DependsOn)
+	}
+	if warden.Deploy.Replicas != 2 {
+		t.Errorf("warden: deploy.replicas = %d, want 2", warden.Deploy.Replicas)
+	}
+	if len(warden.Secrets) != 1 || warden.Secrets[0] != "warden_redis_password" {
+		t.Errorf("warden: secrets = %v, want [warden_redis_password]", warden.Secrets)
+	}
+	for _, e := range warden.Environment {
+		if strings.HasPrefix(e, "REDIS_PASSWORD=") {
+			t.Errorf("warden: REDIS_PASSWORD should be replaced by REDIS_PASSWORD_FILE, got %q", e)
+		}
+	}
+	if out.Secrets["warden_redis_password"]["file"] != "./secrets/warden_redis_password" {
+		t.Errorf("top-level secrets = %v", out.Secrets)
+	}
+	// 未开启 SecretsFiles 时 stack 引用的 secret 文件同样随结果返回，否则 docker stack deploy 找不到文件
+	if string(files["secrets/warden_redis_password"]) != "s3cret" {
+		t.Errorf("secret files = %v, want secrets/warden_redis_password", files)
+	}
+	redis := out.Services["warden-redis"]
+	if redis.Deploy.Replicas != 1 || len(redis.Deploy.Placement.Constraints) == 0 {
+		t.Errorf("warden-redis: want 1 replica pinned by placement, got %+v", redis.Deploy)
+	}
+}
+
+// TestSwarmSecretFilesGenerated 确保 canonical 生成的 swarm stack 中每个 file: secret 都有对应的生成文件，与是否开启 SecretsFiles 无关。
+func TestSwarmSecretFilesGenerated(t *testing.T) {
+	src := loadCanonical(t)
+	env := "WARDEN_REDIS_PASSWORD=pw\nHERALD_API_KEY=hk\n"
+	for _, secretsFiles := range []bool{false, true} {
+		opts := &Options{SecretsFiles: secretsFiles, SecretKeys: []string{"WARDEN_REDIS_PASSWORD", "HERALD_API_KEY"}}
+		gen, err := src.Generate([]string{"swarm"}, env, opts, nil)
+		if err != nil {
+			t.Fatalf("Generate: %v", err)
+		}
+		var out struct {
+			Secrets map[string]struct {
+				File string `yaml:"file"`
+			} `yaml:"secrets"`
+		}
+		if err := yaml.Unmarshal(gen.Composes["swarm"], &out); err != nil {
+			t.Fatalf("yaml unmarshal: %v", err)
+		}
+		if len(out.Secrets) == 0 {
+			t.Fatalf("secretsFiles=%v: stack declares no secrets", secretsFiles)
+		}
+		for name, def := range out.Secrets {
+			rel := strings.TrimPrefix(def.File, "./")
+			if _, ok := gen.Files["swarm"][rel]; !ok {
+				t.Errorf("secretsFiles=%v: secret %s reads %s, which is not generated (files %v)", secretsFiles, name, def.File, gen.Files["swarm"])
+			}
+		}
+	}
+}
+
+// TestGenerateSwarmVolumes 确保短语法与长语法的只读相对路径文件都改为 configs:（目标取挂载点），长语法命名卷同样标记为有状态服务，
+// 可写的相对路径与绝对路径绑定挂载保持原样。
+func TestGenerateSwarmVolumes(t *testing.T) {
+	full := map[string]interface{}{
+		"services": map[string]interface{}{
+			"warden": map[string]interface{}{
+				"image": "warden:test",
+				"volumes": []interface{}{
+					"./data.json:/app/data.json:ro",
+					map[string]interface{}{"type": "bind", "source": "./rules.yaml", "target": "/app/rules.yaml", "read_only": true, "bind": map[string]interface{}{"create_host_path": false}},
+					"./logs:/app/logs",
+					"/etc/localtime:/etc/localtime:ro",
+				},
+			},
+			"warden-redis": map[string]interface{}{
+				"image":   "redis:test",
+				"volumes": []interface{}{map[string]interface{}{"type": "volume", "source": "warden-redis-data", "target": "/data", "volume": map[string]interface{}{"nocopy": true}}},
+			},
+		},
+		"volumes": map[string]interface{}{"warden-redis-data": nil},
+	}
+	yml, _, err := generateSwarm(&Source{Compose: full}, &Options{UseNamedVolume: true, SwarmReplicas: "3"}, nil, "")
+	if err != nil {
+		t.Fatalf("generateSwarm: %v", err)
+	}
+	var out struct {
+		Configs  map[string]map[string]string `yaml:"configs"`
+		Services map[string]struct {
+			Volumes []interface{}       `yaml:"volumes"`
+			Configs []map[string]string `yaml:"configs"`
+			Deploy  struct {
+				Replicas int `yaml:"replicas"`
+			} `yaml:"deploy"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(yml, &out); err != nil {
+		t.Fatalf("yaml unmarshal: %v", err)
+	}
+	wantConfigs := map[string]map[string]string{
+		"warden-data-json":  {"file": "./data.json"},
+		"warden-rules-yaml": {"file": "./rules.yaml"},
+	}
+	if !reflect.DeepEqual(out.Configs, wantConfigs) {
+		t.Errorf("configs = %v, want %v", out.Configs, wantConfigs)
+	}
+	warden := out.Services["warden"]
+	wantMounts := []map[string]string{
+		{"source": "warden-data-json", "target": "/app/data.json"},
+		{"source": "warden-rules-yaml", "target": "/app/rules.yaml"},
+	}
+	if !reflect.DeepEqual(warden.Configs, wantMounts) {
+		t.Errorf("warden configs = %v, want %v", warden.Configs, wantMounts)
+	}
+	if want := []interface{}{"./logs:/app/logs", "/etc/localtime:/etc/localtime:ro"}; !reflect.DeepEqual(warden.Volumes, want) {
+		t.Errorf("warden volumes = %v, want %v", warden.Volumes, want)
+	}
+	if redis := out.Services["warden-redis"]; redis.Deploy.Replicas != 1 || len(redis.Volumes) != 1 {
+		t.Errorf("warden-redis = %+v, want the named volume kept and 1 replica", redis)
+	}
+}
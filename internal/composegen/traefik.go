@@ -0,0 +1,527 @@
+package composegen
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 内置 Traefik（Options.BundledTraefik）的服务名、配置目录（相对 build/<mode>/）与容器内路径。
+const (
+	bundledTraefikService = "traefik"
+	bundledTraefikDir     = "traefik"
+	bundledTraefikConfDir = "/etc/traefik"
+)
+
+// canonical labels 中的入口与 forward-auth 中间件名，即对应 Options 留空时的取值。
+const (
+	defaultTraefikEntrypointHTTP  = "http"
+	defaultTraefikEntrypointHTTPS = "https"
+	defaultTraefikAuthMiddleware  = "stargate-auth"
+)
+
+// traefikNoMiddlewares 为中间件链选项的特殊值：路由不挂载额外的中间件（forward-auth 仍保留）。
+const traefikNoMiddlewares = "none"
+
+// bundledTraefikFilesList 为内置 Traefik 挂载的文件（相对 bundledTraefikDir），与 bundledTraefikFiles 的输出一一对应。
+var bundledTraefikFilesList = []string{"traefik.yml", "dynamic.yml", "certs/default.crt", "certs/default.key"}
+
+// bundledTraefikCertDays 为自签名默认证书的有效期（macOS 信任的自签名证书上限为 825 天）。
+const bundledTraefikCertDays = 825
+
+// bundledTraefikScopeLabel 标记由内置 Traefik 路由的容器：其 Docker provider 以该 label 为 constraints，不接管同一主机上
+// 其他 compose 中带 traefik.enable=true 的容器；值为内置 Traefik 的容器名，区分同一主机上的多份部署。
+const bundledTraefikScopeLabel = "com.soulteary.stargate-suite.traefik"
+
+// bundledTraefikMiddlewares 为 canonical labels 引用、由内置 Traefik 的 dynamic.yml 定义的中间件（labels 中改为 <name>@file 引用）。
+var bundledTraefikMiddlewares = map[string]interface{}{
+	"redir-https": map[string]interface{}{"redirectScheme": map[string]interface{}{"scheme": "https", "permanent": false}},
+	"gzip":        map[string]interface{}{"compress": map[string]interface{}{}},
+}
+
+// injectBundledTraefik 向接入 Traefik 网络（traefikName）的 compose 注入 traefik 服务：监听 80 / 443，Docker provider
+// 仅使用 traefikName 网络、只暴露 traefik.enable=true 且带 bundledTraefikScopeLabel 的容器（见 bundledTraefikFiles）。
+// traefik 服务自身不带 labels（不为自己生成路由）；本 compose 中 traefik.enable=true 的服务加上 bundledTraefikScopeLabel，
+// 路由对 redir-https、gzip 的引用改为 @file（定义在 dynamic.yml）。traefikName 网络改为本 compose 创建的 bridge 网络
+// （name 固定，与 traefik.docker.network 一致），无需事先 docker network create。在 applyOptionsToCompose 之后调用，
+// 端口不受 ExposePorts 影响。
+func injectBundledTraefik(p *Project, opts *Options, prefix, traefikName string) {
+	scope := prefix + bundledTraefikService
+	for _, other := range p.Services {
+		if v, _ := other.Labels.Get("traefik.enable"); v != "true" {
+			continue
+		}
+		other.Labels.Set(bundledTraefikScopeLabel, scope)
+		other.Labels.Update(func(key, value string) (string, bool) {
+			if !strings.HasPrefix(key, "traefik.http.routers.") || !strings.HasSuffix(key, ".middlewares") {
+				return "", false
+			}
+			items := splitList(value)
+			for i, m := range items {
+				if _, ok := bundledTraefikMiddlewares[m]; ok {
+					items[i] = m + "@file"
+				}
+			}
+			return strings.Join(items, ","), true
+		})
+	}
+	svc := &Service{
+		Ports:    []Port{{Published: "80", Target: "80"}, {Published: "443", Target: "443"}},
+		Networks: []ServiceNetwork{{Name: traefikName}},
+		Volumes:  []Volume{{Type: "bind", Source: "/var/run/docker.sock", Target: "/var/run/docker.sock", ReadOnly: true}},
+		Extra: map[string]interface{}{
+			"image":          "${TRAEFIK_IMAGE:-traefik:v3.3}",
+			"container_name": scope,
+			"restart":        "unless-stopped",
+		},
+	}
+	for _, f := range bundledTraefikFilesList {
+		svc.Volumes = append(svc.Volumes, Volume{
+			Type:     "bind",
+			Source:   "./" + path.Join(bundledTraefikDir, f),
+			Target:   path.Join(bundledTraefikConfDir, f),
+			ReadOnly: true,
+		})
+	}
+	if opts.HealthCheck {
+		svc.Extra["healthcheck"] = map[string]interface{}{
+			"test":     []interface{}{"CMD", "traefik", "healthcheck", "--ping"},
+			"interval": "10s",
+			"timeout":  "3s",
+			"retries":  3,
+		}
+	}
+	p.Services[bundledTraefikService] = svc
+	delete(p.Networks, "traefik")
+	p.Networks[traefikName] = map[string]interface{}{"name": traefikName, "driver": "bridge"}
+}
+
+// bundledTraefikFiles 返回内置 Traefik 的静态配置（入口名取自 Options，Docker provider 只接管 bundledTraefikScopeLabel 为
+// scope 的容器）、动态配置（默认证书与 bundledTraefikMiddlewares）与自签名证书；证书覆盖 vars 中的
+// STARGATE_DOMAIN、PROTECTED_DOMAIN 及其上级域名通配（如 *.test.localhost），每次生成重新签发。
+// routes 非 nil 时（labels 已移除）其 http 路由、服务与中间件一并写入动态配置。
+func bundledTraefikFiles(opts *Options, vars map[string]string, routes map[string]interface{}, scope string) (map[string][]byte, error) {
+	static := map[string]interface{}{
+		"entryPoints": map[string]interface{}{
+			orDefault(opts.TraefikEntrypointHTTP, defaultTraefikEntrypointHTTP):   map[string]interface{}{"address": ":80"},
+			orDefault(opts.TraefikEntrypointHTTPS, defaultTraefikEntrypointHTTPS): map[string]interface{}{"address": ":443"},
+		},
+		"ping": map[string]interface{}{},
+		"log":  map[string]interface{}{"level": "INFO"},
+		"providers": map[string]interface{}{
+			"docker": map[string]interface{}{
+				"exposedByDefault": false,
+				"network":          traefikNetworkName(opts),
+				"constraints":      fmt.Sprintf("Label(`%s`, `%s`)", bundledTraefikScopeLabel, scope),
+			},
+			"file": map[string]interface{}{"filename": path.Join(bundledTraefikConfDir, "dynamic.yml"), "watch": true},
+		},
+	}
+	cert := map[string]interface{}{
+		"certFile": path.Join(bundledTraefikConfDir, "certs/default.crt"),
+		"keyFile":  path.Join(bundledTraefikConfDir, "certs/default.key"),
+	}
+	dynamic := map[string]interface{}{
+		"tls": map[string]interface{}{
+			"certificates": []interface{}{cert},
+			"stores":       map[string]interface{}{"default": map[string]interface{}{"defaultCertificate": cert}},
+		},
+	}
+	httpConf := make(map[string]interface{})
+	if routes != nil {
+		// 已移除 labels 时由 file provider 提供路由（见 traefikDynamicConfig）
+		if h, ok := routes["http"].(map[string]interface{}); ok {
+			httpConf = h
+		}
+	}
+	middlewares, _ := httpConf["middlewares"].(map[string]interface{})
+	if middlewares == nil {
+		middlewares = make(map[string]interface{})
+	}
+	for name, m := range bundledTraefikMiddlewares {
+		middlewares[name] = m
+	}
+	httpConf["middlewares"] = middlewares
+	dynamic["http"] = httpConf
+	files := make(map[string][]byte)
+	for name, doc := range map[string]map[string]interface{}{"traefik.yml": static, "dynamic.yml": dynamic} {
+		b, err := encodeTraefikConfig(doc, "内置 Traefik 配置（由 stargate-suite 生成）")
+		if err != nil {
+			return nil, err
+		}
+		files[path.Join(bundledTraefikDir, name)] = b
+	}
+	var hosts []string
+	seen := map[string]bool{}
+	for _, key := range []string{"STARGATE_DOMAIN", "PROTECTED_DOMAIN"} {
+		host := strings.TrimSpace(vars[key])
+		if host == "" {
+			continue
+		}
+		candidates := []string{host}
+		if _, parent, ok := strings.Cut(host, "."); ok && strings.Contains(parent, ".") {
+			candidates = append(candidates, "*."+parent)
+		}
+		for _, h := range candidates {
+			if !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	hosts = append(hosts, "localhost")
+	certPEM, keyPEM, err := selfSignedCert(hosts)
+	if err != nil {
+		return nil, fmt.Errorf("bundled traefik certificate: %w", err)
+	}
+	files[path.Join(bundledTraefikDir, "certs/default.crt")] = certPEM
+	files[path.Join(bundledTraefikDir, "certs/default.key")] = keyPEM
+	return files, nil
+}
+
+// encodeTraefikConfig 以两空格缩进序列化 Traefik 配置，并加上一行注释 comment。
+func encodeTraefikConfig(doc map[string]interface{}, comment string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("# " + comment + "\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// selfSignedCert 签发覆盖 hosts 的 ECDSA P-256 自签名证书，返回 PEM 编码的证书与私钥。
+func selfSignedCert(hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"Stargate Suite"}},
+		DNSNames:              hosts,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(0, 0, bundledTraefikCertDays),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// applyTraefikLabelOptions 按 Options 改写服务的 Traefik labels。路由按 canonical 的 entrypoints 区分：值为 http 的是跳转路由，
+// https 的是 TLS 路由，其余路由不改写。入口名、中间件链（forward-auth 中间件保留在链尾）、Stargate 路由优先级
+// 与 forward-auth 中间件名（定义与引用）按选项替换，链为空时去掉 middlewares label；设置 certresolver 时在 tls=true 后追加 tls.certresolver。
+func applyTraefikLabelOptions(svc *Service, opts *Options) {
+	if len(svc.Labels) == 0 {
+		return
+	}
+	auth := orDefault(opts.TraefikAuthMiddleware, defaultTraefikAuthMiddleware)
+	entrypoints := map[string]string{
+		defaultTraefikEntrypointHTTP:  orDefault(opts.TraefikEntrypointHTTP, defaultTraefikEntrypointHTTP),
+		defaultTraefikEntrypointHTTPS: orDefault(opts.TraefikEntrypointHTTPS, defaultTraefikEntrypointHTTPS),
+	}
+	chains := map[string]string{
+		defaultTraefikEntrypointHTTP:  strings.TrimSpace(opts.TraefikHTTPMiddlewares),
+		defaultTraefikEntrypointHTTPS: strings.TrimSpace(opts.TraefikHTTPSMiddlewares),
+	}
+	kinds := make(map[string]string) // 路由名 -> canonical 入口（http / https）
+	for _, l := range svc.Labels {
+		if router, field, ok := traefikRouterLabel(l.Key); ok && field == "entrypoints" && l.Value != nil {
+			if _, known := entrypoints[*l.Value]; known {
+				kinds[router] = *l.Value
+			}
+		}
+	}
+	out := make(KeyValues, 0, len(svc.Labels))
+	for _, l := range svc.Labels {
+		key := l.Key
+		if rest, ok := strings.CutPrefix(key, "traefik.http.middlewares."+defaultTraefikAuthMiddleware+"."); ok {
+			key = "traefik.http.middlewares." + auth + "." + rest
+		}
+		router, field, ok := traefikRouterLabel(key)
+		kind := kinds[router]
+		if !ok || kind == "" || l.Value == nil {
+			out = append(out, KeyValue{Key: key, Value: l.Value})
+			continue
+		}
+		v := *l.Value
+		switch field {
+		case "entrypoints":
+			v = entrypoints[kind]
+		case "middlewares":
+			if v = middlewareChain(v, chains[kind], auth); v == "" {
+				continue
+			}
+		case "priority":
+			v = orDefault(opts.TraefikRouterPriority, v)
+		}
+		out = append(out, KeyValue{Key: key, Value: &v})
+		if resolver := strings.TrimSpace(opts.TraefikCertResolver); field == "tls" && v == "true" && resolver != "" {
+			out = append(out, KeyValue{Key: key + ".certresolver", Value: &resolver})
+		}
+	}
+	svc.Labels = out
+}
+
+// traefikRouterLabel 拆分 traefik.http.routers.<router>.<field> 形式的 label 键。
+func traefikRouterLabel(key string) (router, field string, ok bool) {
+	rest, ok := strings.CutPrefix(key, "traefik.http.routers.")
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ".")
+}
+
+// middlewareChain 返回路由新的中间件链：chain 为空时保留 value 中原有的中间件，为 traefikNoMiddlewares 时清空，否则替换为 chain；
+// value 引用了 canonical 的 forward-auth 中间件时以 auth 置于链尾。
+func middlewareChain(value, chain, auth string) string {
+	var kept []string
+	hasAuth := false
+	for _, m := range splitList(value) {
+		if m == defaultTraefikAuthMiddleware {
+			hasAuth = true
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	switch chain {
+	case "":
+	case traefikNoMiddlewares:
+		kept = nil
+	default:
+		kept = splitList(chain)
+	}
+	if hasAuth {
+		kept = append(kept, auth)
+	}
+	return strings.Join(kept, ",")
+}
+
+// splitList 按逗号拆分并去掉空白与空项。
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// orDefault 返回去掉空白后的 v，为空时返回 def。
+func orDefault(v, def string) string {
+	if v = strings.TrimSpace(v); v != "" {
+		return v
+	}
+	return def
+}
+
+// applyTraefikFiles 返回 compose（p）需随附的 Traefik 文件：Options.TraefikDynamicFile 时为由 labels 转换的 traefik-dynamic.yml
+// （TraefikStripLabels 时随后移除 labels），注入了内置 Traefik 时为其配置与证书。动态配置须在移除 labels 前转换，
+// 移除 labels 后路由改由内置 Traefik 的 file provider 提供（与其中间件同在 dynamic.yml）。
+func applyTraefikFiles(p *Project, opts *Options, vars map[string]string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	var routes map[string]interface{}
+	if opts.TraefikDynamicFile {
+		dynamic, err := traefikDynamicConfig(p, vars)
+		if err != nil {
+			return nil, err
+		}
+		if dynamic != nil {
+			b, err := encodeTraefikConfig(dynamic, "Traefik file provider 动态配置（由 stargate-suite 从 labels 生成）")
+			if err != nil {
+				return nil, err
+			}
+			files[traefikDynamicFileName] = b
+			if opts.TraefikStripLabels {
+				stripTraefikLabels(p)
+				routes = dynamic
+			}
+		}
+	}
+	if svc, ok := p.Services[bundledTraefikService]; opts.BundledTraefik && ok {
+		scope, _ := svc.Extra["container_name"].(string)
+		bundled, err := bundledTraefikFiles(opts, vars, routes, scope)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range bundled {
+			files[k] = v
+		}
+	}
+	return files, nil
+}
+
+// traefikDynamicFileName 为 file provider 动态配置（Options.TraefikDynamicFile）相对 build/<mode>/ 的路径。
+const traefikDynamicFileName = "traefik-dynamic.yml"
+
+// traefikLabelFields 为 label 路径中（不区分大小写）的字段名到 file provider 配置键的映射，其余字段名原样保留。
+var traefikLabelFields = map[string]string{
+	"entrypoints":              "entryPoints",
+	"loadbalancer":             "loadBalancer",
+	"passhostheader":           "passHostHeader",
+	"certresolver":             "certResolver",
+	"forwardauth":              "forwardAuth",
+	"authresponseheaders":      "authResponseHeaders",
+	"authresponseheadersregex": "authResponseHeadersRegex",
+	"authrequestheaders":       "authRequestHeaders",
+	"trustforwardheader":       "trustForwardHeader",
+	"redirectscheme":           "redirectScheme",
+}
+
+// traefikListFields 的值按逗号拆为列表；traefikIntFields 的值为整数；traefikBlockFields 为 true 时为空配置块（如 tls: {}）。
+var (
+	traefikListFields  = map[string]bool{"entryPoints": true, "middlewares": true, "authResponseHeaders": true, "authRequestHeaders": true}
+	traefikIntFields   = map[string]bool{"priority": true, "port": true}
+	traefikBlockFields = map[string]bool{"tls": true, "compress": true}
+)
+
+// traefikDynamicConfig 将 compose 各服务的 traefik.http.* labels（按 vars 代入变量）转换为 file provider 的动态配置：
+// 路由与中间件按 label 路径还原为配置树，服务的 loadbalancer.server.{scheme,port} 改为以容器名（无 container_name 时为服务名）
+// 寻址的 loadBalancer.servers[].url。没有 Traefik 配置 labels 时返回 nil。
+func traefikDynamicConfig(p *Project, vars map[string]string) (map[string]interface{}, error) {
+	names := make([]string, 0, len(p.Services))
+	for n := range p.Services {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	lookup := MapLookup(vars)
+	conf := make(map[string]interface{})
+	hosts := make(map[string]string) // Traefik 服务名 -> 所属容器
+	for _, name := range names {
+		svc := p.Services[name]
+		host := name
+		if cn, ok := svc.Extra["container_name"].(string); ok && cn != "" {
+			host = cn
+		}
+		for _, l := range svc.Labels {
+			if l.Value == nil {
+				continue
+			}
+			key, val := l.Key, *l.Value
+			rest, ok := strings.CutPrefix(key, "traefik.http.")
+			if !ok {
+				continue
+			}
+			rest, err := Interpolate(rest, lookup)
+			if err != nil {
+				return nil, fmt.Errorf("service %s label %s: %w", name, key, err)
+			}
+			if val, err = Interpolate(val, lookup); err != nil {
+				return nil, fmt.Errorf("service %s label %s: %w", name, key, err)
+			}
+			parts := strings.Split(rest, ".")
+			if len(parts) < 3 {
+				continue
+			}
+			if parts[0] == "services" {
+				hosts[parts[1]] = host
+			}
+			setTraefikField(conf, parts, val)
+		}
+	}
+	if len(conf) == 0 {
+		return nil, nil
+	}
+	backends, _ := conf["services"].(map[string]interface{})
+	for name, b := range backends {
+		lb, _ := b.(map[string]interface{})["loadBalancer"].(map[string]interface{})
+		server, ok := lb["server"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		scheme := "http"
+		if v, ok := server["scheme"].(string); ok && v != "" {
+			scheme = v
+		}
+		url := scheme + "://" + hosts[name]
+		if port, ok := server["port"]; ok {
+			url += fmt.Sprintf(":%v", port)
+		}
+		delete(lb, "server")
+		lb["servers"] = []interface{}{map[string]interface{}{"url": url}}
+	}
+	return map[string]interface{}{"http": conf}, nil
+}
+
+// setTraefikField 将 label 路径 parts（如 routers/<name>/tls/certresolver）对应的值写入配置树 root；
+// 前两段为类别与名称，其后的字段名按 traefikLabelFields 改写。
+func setTraefikField(root map[string]interface{}, parts []string, val string) {
+	m := root
+	for i, p := range parts {
+		key := p
+		if f, ok := traefikLabelFields[strings.ToLower(p)]; ok && i >= 2 {
+			key = f
+		}
+		if i < len(parts)-1 {
+			next, ok := m[key].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				m[key] = next
+			}
+			m = next
+			continue
+		}
+		switch {
+		case traefikBlockFields[key] && val == "true":
+			if _, ok := m[key].(map[string]interface{}); !ok {
+				m[key] = map[string]interface{}{}
+			}
+		case traefikListFields[key]:
+			list := make([]interface{}, 0)
+			for _, item := range splitList(val) {
+				list = append(list, item)
+			}
+			m[key] = list
+		case traefikIntFields[key]:
+			if n, err := strconv.Atoi(val); err == nil {
+				m[key] = n
+			} else {
+				m[key] = val
+			}
+		case val == "true" || val == "false":
+			m[key] = val == "true"
+		default:
+			m[key] = val
+		}
+	}
+}
+
+// stripTraefikLabels 移除各服务的 traefik.* labels，不再有 labels 的服务删除该键。
+func stripTraefikLabels(p *Project) {
+	for _, svc := range p.Services {
+		svc.Labels.Filter(func(l KeyValue) bool { return !strings.HasPrefix(l.Key, "traefik.") })
+		if len(svc.Labels) == 0 {
+			svc.Labels = nil
+		}
+	}
+}
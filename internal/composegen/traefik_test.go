@@ -0,0 +1,193 @@
+package composegen
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TestBundledTraefik 确保开启 BundledTraefik 时接入 Traefik 网络的 mode 注入 traefik 服务与配置文件、网络改由 compose 创建，swarm 不受影响。
+func TestBundledTraefik(t *testing.T) {
+	src := loadCanonical(t)
+	opts := &Options{BundledTraefik: true, TraefikNetwork: true, TraefikNetworkName: "edge", ExposePorts: true, UseNamedVolume: true}
+	gen, err := src.Generate([]string{"traefik", "image", "swarm"}, "", opts, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	p := generatedProject(t, gen, "traefik")
+	if svc := p.Services["traefik"]; svc == nil || len(svc.Ports) != 2 || svc.Networks[0].Name != "edge" || svc.Labels != nil {
+		t.Fatalf("traefik service = %v", svc)
+	}
+	for _, name := range []string{"stargate", "protected-service"} {
+		labels := p.Services[name].Labels
+		if v, _ := labels.Get(bundledTraefikScopeLabel); v != "the-gate-traefik" {
+			t.Errorf("%s scope label = %q", name, v)
+		}
+		for _, l := range labels {
+			if strings.HasSuffix(l.Key, ".middlewares") && l.Value != nil && (strings.Contains(*l.Value, "redir-https") || strings.Contains(*l.Value, "gzip")) &&
+				!strings.Contains(*l.Value, "@file") {
+				t.Errorf("%s %s = %s; want @file middleware", name, l.Key, *l.Value)
+			}
+		}
+	}
+	if !bytes.Contains(gen.Files["traefik"]["traefik/traefik.yml"], []byte("constraints: Label(`"+bundledTraefikScopeLabel+"`, `the-gate-traefik`)")) {
+		t.Errorf("traefik.yml missing docker provider constraints:\n%s", gen.Files["traefik"]["traefik/traefik.yml"])
+	}
+	for _, m := range []string{"redir-https:", "gzip:"} {
+		if !bytes.Contains(gen.Files["traefik"]["traefik/dynamic.yml"], []byte(m)) {
+			t.Errorf("dynamic.yml missing middleware %s", m)
+		}
+	}
+	if !bytes.Contains(gen.Composes["traefik"], []byte("  traefik:\n    image: ${TRAEFIK_IMAGE:-traefik:v3.3}\n    container_name: the-gate-traefik\n    ports:")) {
+		t.Error("traefik service keys should follow the canonical order")
+	}
+	if n, _ := p.Networks["edge"].(map[string]interface{}); n["name"] != "edge" || n["external"] != nil {
+		t.Errorf("edge network should be created by compose: %v", p.Networks)
+	}
+	for _, f := range []string{"traefik/traefik.yml", "traefik/dynamic.yml", "traefik/certs/default.crt", "traefik/certs/default.key"} {
+		if len(gen.Files["traefik"][f]) == 0 {
+			t.Errorf("missing %s", f)
+		}
+	}
+	block, _ := pem.Decode(gen.Files["traefik"]["traefik/certs/default.crt"])
+	if block == nil {
+		t.Fatal("default.crt is not PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if err := cert.VerifyHostname("auth.test.localhost"); err != nil {
+		t.Error(err)
+	}
+	if req, err := Requirements(gen, "traefik"); err != nil || len(req.Networks) != 0 || len(req.Files) != 1 {
+		t.Errorf("Requirements = %+v, %v; want no external network and only data.json", req, err)
+	}
+	if gen.Files["image"] != nil || gen.Files["swarm"] != nil || bytes.Contains(gen.Composes["swarm"], []byte("traefik:v3")) {
+		t.Error("bridge and swarm modes should not get the bundled traefik")
+	}
+}
+
+// TestTraefikLabelOptions 确保 Traefik 入口、中间件链、certresolver、优先级与 forward-auth 中间件名按 Options 改写 labels。
+func TestTraefikLabelOptions(t *testing.T) {
+	svc := &Service{Labels: keyValues(
+		"traefik.http.routers.p-http.entrypoints=http",
+		"traefik.http.routers.p-http.middlewares=redir-https",
+		"traefik.http.routers.p-https.entrypoints=https",
+		"traefik.http.routers.p-https.tls=true",
+		"traefik.http.routers.p-https.middlewares=gzip,stargate-auth",
+		"traefik.http.routers.p-https.priority=100",
+		"traefik.http.middlewares.stargate-auth.forwardauth.address=http://stargate/_auth",
+	)}
+	applyTraefikLabelOptions(svc, &Options{
+		TraefikEntrypointHTTP: "web", TraefikEntrypointHTTPS: "websecure", TraefikHTTPMiddlewares: "none",
+		TraefikHTTPSMiddlewares: "gzip@file,headers", TraefikCertResolver: "le", TraefikRouterPriority: "200", TraefikAuthMiddleware: "sg-auth",
+	})
+	want := keyValues(
+		"traefik.http.routers.p-http.entrypoints=web",
+		"traefik.http.routers.p-https.entrypoints=websecure",
+		"traefik.http.routers.p-https.tls=true",
+		"traefik.http.routers.p-https.tls.certresolver=le",
+		"traefik.http.routers.p-https.middlewares=gzip@file,headers,sg-auth",
+		"traefik.http.routers.p-https.priority=200",
+		"traefik.http.middlewares.sg-auth.forwardauth.address=http://stargate/_auth",
+	)
+	if !reflect.DeepEqual(svc.Labels, want) {
+		t.Errorf("labels = %v\nwant %v", svc.Labels.list(), want.list())
+	}
+	if err := ValidateOptions(&Options{TraefikHTTPSMiddlewares: "gzip,a b"}); err == nil {
+		t.Error("invalid middleware name should be rejected")
+	}
+}
+
+// TestTraefikDynamicFile 确保 TraefikDynamicFile 由 labels 输出 file provider 配置（服务以容器名寻址），TraefikStripLabels 时 compose 不再含 Traefik labels。
+func TestTraefikDynamicFile(t *testing.T) {
+	src := loadCanonical(t)
+	opts := &Options{TraefikNetwork: true, TraefikDynamicFile: true, TraefikStripLabels: true, ContainerNamePrefix: "x-", UseNamedVolume: true}
+	gen, err := src.Generate([]string{"traefik-stargate"}, "", opts, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	var dynamic struct {
+		HTTP struct {
+			Routers     map[string]map[string]interface{} `yaml:"routers"`
+			Middlewares map[string]map[string]interface{} `yaml:"middlewares"`
+			Services    map[string]struct {
+				LoadBalancer struct {
+					Servers []struct{ URL string } `yaml:"servers"`
+				} `yaml:"loadBalancer"`
+			} `yaml:"services"`
+		} `yaml:"http"`
+	}
+	if err := yaml.Unmarshal(gen.Files["traefik-stargate"]["traefik-dynamic.yml"], &dynamic); err != nil {
+		t.Fatalf("traefik-dynamic.yml: %v", err)
+	}
+	if servers := dynamic.HTTP.Services["stargate-backend"].LoadBalancer.Servers; len(servers) != 1 || servers[0].URL != "http://x-stargate:80" {
+		t.Errorf("stargate-backend servers = %v", servers)
+	}
+	if r := dynamic.HTTP.Routers["protected-https"]; r["rule"] != "Host(`whoami.test.localhost`)" || r["tls"] == nil {
+		t.Errorf("protected-https = %v", r)
+	}
+	if dynamic.HTTP.Middlewares["stargate-auth"]["forwardAuth"] == nil {
+		t.Errorf("missing stargate-auth forwardAuth: %v", dynamic.HTTP.Middlewares)
+	}
+	if bytes.Contains(gen.Composes["traefik-stargate"], []byte("traefik.http.")) {
+		t.Error("labels should be stripped")
+	}
+}
+
+// TestTraefikDynamicFileMapLabels 确保映射写法的 labels 同样转换为 file provider 配置，移除 Traefik labels 后保留其他 labels，
+// 只有 Traefik labels 的服务不再有 labels 键。
+func TestTraefikDynamicFileMapLabels(t *testing.T) {
+	full := map[string]interface{}{
+		"services": map[string]interface{}{
+			"whoami": map[string]interface{}{
+				"image":          "whoami:test",
+				"container_name": "w",
+				"labels": map[string]interface{}{
+					"traefik.enable":                                   "true",
+					"traefik.http.routers.w.rule":                      "Host(`${W_HOST:-w.localhost}`)",
+					"traefik.http.services.w.loadbalancer.server.port": "8080",
+					"com.example.keep":                                 "1",
+				},
+			},
+			"api": map[string]interface{}{
+				"image":  "api:test",
+				"labels": map[string]interface{}{"traefik.http.routers.api.entrypoints": "web,websecure"},
+			},
+		},
+	}
+	opts := &Options{TraefikNetwork: true, TraefikDynamicFile: true, TraefikStripLabels: true, UseNamedVolume: true}
+	gen, err := Generate(full, []string{"traefik"}, "W_HOST=example.test\n", opts, nil)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	var dynamic map[string]interface{}
+	if err := yaml.Unmarshal(gen.Files["traefik"]["traefik-dynamic.yml"], &dynamic); err != nil {
+		t.Fatalf("traefik-dynamic.yml: %v", err)
+	}
+	want := map[string]interface{}{"http": map[string]interface{}{
+		"routers": map[string]interface{}{
+			"w":   map[string]interface{}{"rule": "Host(`example.test`)"},
+			"api": map[string]interface{}{"entryPoints": []interface{}{"web", "websecure"}},
+		},
+		"services": map[string]interface{}{
+			"w": map[string]interface{}{"loadBalancer": map[string]interface{}{"servers": []interface{}{map[string]interface{}{"url": "http://w:8080"}}}},
+		},
+	}}
+	if !reflect.DeepEqual(dynamic, want) {
+		t.Errorf("dynamic config = %v\nwant %v", dynamic, want)
+	}
+	p := generatedProject(t, gen, "traefik")
+	if labels := p.Services["whoami"].Labels; len(labels) != 1 || labels[0].Key != "com.example.keep" {
+		t.Errorf("whoami labels = %v, want only com.example.keep", labels.list())
+	}
+	if labels := p.Services["api"].Labels; labels != nil {
+		t.Errorf("api labels = %v, want none", labels.list())
+	}
+}
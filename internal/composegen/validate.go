@@ -4,11 +4,18 @@ package composegen
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 )
 
-// ValidateOptions 校验 Options 中端口范围（1-65535）及可选 URL 格式；返回首个错误。
+// traefikNamePattern 为入口、certresolver、中间件等 Traefik 名称的合法形式；traefikMiddlewareRefPattern 另允许 @provider 后缀（如 gzip@file）。
+var (
+	traefikNamePattern          = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+	traefikMiddlewareRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*(@[A-Za-z0-9_-]+)?$`)
+)
+
+// ValidateOptions 校验 Options 中端口范围（1-65535）、Traefik 名称与优先级及可选 URL 格式；返回首个错误。通道（Options.Providers）的端口在生成时按描述校验。
 func ValidateOptions(opts *Options) error {
 	if opts == nil {
 		return nil
@@ -21,34 +28,70 @@ func ValidateOptions(opts *Options) error {
 		{"portWarden", opts.PortWarden},
 		{"portHeraldRedis", opts.PortHeraldRedis},
 		{"portHeraldTotp", opts.PortHeraldTotp},
-		{"portHeraldSmtp", opts.PortHeraldSmtp},
-		{"portOwlmail", opts.PortOwlmail},
 	}
 	for _, f := range portFields {
-		v := strings.TrimSpace(f.value)
-		if v == "" {
-			continue
+		if err := validatePort(f.name, f.value); err != nil {
+			return err
 		}
-		// 允许 "8082" 或 ":8082" 形式
-		numStr := v
-		if strings.HasPrefix(numStr, ":") {
-			numStr = numStr[1:]
+	}
+	for _, f := range []struct{ name, value string }{
+		{"traefikEntrypointHttp", opts.TraefikEntrypointHTTP},
+		{"traefikEntrypointHttps", opts.TraefikEntrypointHTTPS},
+		{"traefikCertResolver", opts.TraefikCertResolver},
+		{"traefikAuthMiddleware", opts.TraefikAuthMiddleware},
+	} {
+		if v := strings.TrimSpace(f.value); v != "" && !traefikNamePattern.MatchString(v) {
+			return fmt.Errorf("%s: invalid name %q", f.name, f.value)
 		}
-		if idx := strings.Index(numStr, ":"); idx >= 0 {
-			numStr = numStr[:idx]
+	}
+	for _, f := range []struct{ name, value string }{
+		{"traefikHttpMiddlewares", opts.TraefikHTTPMiddlewares},
+		{"traefikHttpsMiddlewares", opts.TraefikHTTPSMiddlewares},
+	} {
+		if v := strings.TrimSpace(f.value); v == "" || v == traefikNoMiddlewares {
+			continue
 		}
-		num, err := strconv.Atoi(numStr)
-		if err != nil {
-			return fmt.Errorf("%s: invalid port %q", f.name, f.value)
+		for _, m := range strings.Split(f.value, ",") {
+			if !traefikMiddlewareRefPattern.MatchString(strings.TrimSpace(m)) {
+				return fmt.Errorf("%s: invalid middleware %q", f.name, m)
+			}
 		}
-		if num < 1 || num > 65535 {
-			return fmt.Errorf("%s: port %d out of range (1-65535)", f.name, num)
+	}
+	if v := strings.TrimSpace(opts.TraefikRouterPriority); v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 {
+			return fmt.Errorf("traefikRouterPriority: invalid priority %q", opts.TraefikRouterPriority)
 		}
 	}
+	if v := strings.TrimSpace(opts.SwarmReplicas); v != "" {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 {
+			return fmt.Errorf("swarmReplicas: invalid replica count %q", opts.SwarmReplicas)
+		}
+	}
+	return nil
+}
+
+// validatePort 校验单个主机端口选项：允许 "8082" 或 ":8082" 形式，为空时跳过。
+func validatePort(name, value string) error {
+	v := strings.TrimSpace(value)
+	if v == "" {
+		return nil
+	}
+	numStr := strings.TrimPrefix(v, ":")
+	if idx := strings.Index(numStr, ":"); idx >= 0 {
+		numStr = numStr[:idx]
+	}
+	num, err := strconv.Atoi(numStr)
+	if err != nil {
+		return fmt.Errorf("%s: invalid port %q", name, value)
+	}
+	if num < 1 || num > 65535 {
+		return fmt.Errorf("%s: port %d out of range (1-65535)", name, num)
+	}
 	return nil
 }
 
 // ValidateEnvOverrides 校验 EnvOverrides 中 URL 类值的格式（可选）；allowed 为 nil 时不校验白名单。
+// 跨服务密钥一致性按生成结果检查（见 GeneratedSecretIssues）。
 func ValidateEnvOverrides(overrides map[string]string, allowed map[string]map[string]bool) []string {
 	var errs []string
 	urlKeys := map[string]bool{
@@ -1,5 +1,5 @@
 #!/bin/bash
-# 通过 Web API 生成 compose 到 build/（供 Makefile/CI 使用，无 CLI gen 子命令）
+# 通过 Web API 生成 compose 到 build/（make gen-api；无需 serve 的场景请直接使用 go run ./cmd/suite gen）
 set -e
 
 SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
@@ -44,13 +44,29 @@ RESP=$(curl -sf -X POST "http://127.0.0.1:$PORT/api/generate" \
   -H "Content-Type: application/json" \
   -d "$BODY")
 
-ENV_BODY=$(echo "$RESP" | jq -r '.env')
 mkdir -p "$BUILD_DIR"
 for mode in $MODES; do
   dir="$BUILD_DIR/$mode"
   mkdir -p "$dir"
-  echo "$RESP" | jq -r --arg m "$mode" '.composes[$m]' > "$dir/docker-compose.yml"
-  echo "$ENV_BODY" > "$dir/.env"
-  echo "  $dir/docker-compose.yml, $dir/.env"
+  file="docker-compose.yml"
+  [ "$mode" = "k8s" ] && file="k8s.yaml"
+  echo "$RESP" | jq -r --arg m "$mode" '.composes[$m]' > "$dir/$file"
+  # 每个 mode 的 .env 仅含其服务引用的变量（旧版 serve 无 envs 时回退为共用的 .env）
+  echo "$RESP" | jq -r --arg m "$mode" '.envs[$m] // .env' > "$dir/.env"
+  echo "  $dir/$file, $dir/.env"
+  # 附加文件（如 options.secretsFiles 生成的 secrets/<name>），权限同 composegen.GeneratedFilePerm：
+  # secrets/ 目录 0700、其中文件 0644（非 root 容器需能读取绑定挂载），其余文件 0600
+  for rel in $(echo "$RESP" | jq -r --arg m "$mode" '(.files[$m] // {}) | keys[]'); do
+    sub=$(dirname "$rel")
+    mkdir -p "$dir/$sub"
+    echo "$RESP" | jq -j --arg m "$mode" --arg r "$rel" '.files[$m][$r]' > "$dir/$rel"
+    if [ "$sub" = "secrets" ]; then
+      chmod 700 "$dir/secrets"
+      chmod 644 "$dir/$rel"
+    else
+      chmod 600 "$dir/$rel"
+    fi
+    echo "  $dir/$rel"
+  done
 done
 echo "Generated into $BUILD_DIR/ for mode(s): $MODES"